@@ -5,15 +5,22 @@ import (
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/caddyserver/caddy/v2/pkg/cluster"
+	"github.com/caddyserver/caddy/v2/pkg/codec"
 	"github.com/caddyserver/caddy/v2/pkg/config"
 	"github.com/caddyserver/caddy/v2/pkg/model"
 	"github.com/caddyserver/caddy/v2/pkg/repository"
 	"github.com/caddyserver/caddy/v2/pkg/storage"
+	"github.com/caddyserver/caddy/v2/pkg/storage/invalidation"
+	"github.com/caddyserver/caddy/v2/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
 	"net/http"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
-	"unsafe"
 )
 
 var _ caddy.Module = (*CacheMiddleware)(nil)
@@ -38,14 +45,20 @@ type CacheMiddleware struct {
 	ConfigPath       string
 	ctx              context.Context
 	cfg              *config.Cache
+	inlineCfg        *config.Cache // fields parsed from inline Caddyfile blocks; see UnmarshalCaddyfile
 	store            storage.Storage
 	backend          repository.Backender
 	refresher        storage.Refresher
 	evictor          storage.Evictor
+	evacuator        *storage.Evacuator
 	dumper           storage.Dumper
 	upstreamRateSema chan struct{}
 	counterCh        chan struct{}
 	errorCh          chan error
+	forwarder        *cluster.Forwarder
+	invalidator      *invalidation.Coordinator
+	tracer           telemetry.Tracer // Traces cache.lookup/cache.upstream_fetch (no-op unless Cache.Telemetry.TracingEnabled)
+	tracingShutdown  func(context.Context) error
 }
 
 func (*CacheMiddleware) CaddyModule() caddy.ModuleInfo {
@@ -85,9 +98,14 @@ func (middleware *CacheMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Requ
 
 	w.Header().Add(contentTypeKey, applicationJsonValue)
 
-	_, cancel := middleware.setUpCtxTimeout(r)
+	ctx, cancel := middleware.setUpCtxTimeout(r)
 	defer cancel()
 
+	// Join whatever trace the client (or an upstream proxy in front of Caddy) is already running,
+	// instead of starting a disconnected one; a no-op propagator/carrier leaves ctx unchanged.
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(r.Header))
+	r = r.WithContext(ctx)
+
 	// Build request (return error on rule missing for current path)
 	req, err := model.NewRequestFromNetHttp(middleware.cfg, r)
 	if err != nil {
@@ -95,53 +113,90 @@ func (middleware *CacheMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Requ
 		return next.ServeHTTP(w, r)
 	}
 
-	resp, isHit := middleware.store.Get(req)
-	if !isHit {
-		captured := newCaptureResponseWriter(w)
+	// If clustering is enabled and some other peer owns this key, forward instead of caching it
+	// redundantly here too.
+	if middleware.forwarder != nil && !middleware.forwarder.Owns(req.MapKey()) {
+		return middleware.forwarder.Forward(w, r, req.MapKey())
+	}
+
+	lookupCtx, lookupSpan := middleware.tracer.Start(ctx, "cache.lookup", lookupAttrs(req)...)
+	defer lookupSpan.End()
+
+	// GetOrLoad coalesces concurrent misses on the same key: only the goroutine that wins the
+	// race (the leader) hits the upstream; everyone else blocks and reuses its *model.Response.
+	// Followers never touch upstreamRateSema, since they never execute this closure.
+	built, shared, _ := middleware.store.GetOrLoad(req, func() (*model.Response, error) {
+		fetchCtx, fetchSpan := middleware.tracer.Start(lookupCtx, "cache.upstream_fetch", lookupAttrs(req)...)
+		defer fetchSpan.End()
+
+		captured := newCaptureResponseWriter(w, middleware.cfg.Cache.Stream.MaxCacheableBodyBytes)
+		defer captured.release()
 
 		select {
 		case s := <-middleware.upstreamRateSema:
 			defer func() { middleware.upstreamRateSema <- s }()
 
 			// Handle request manually due to store it
-			if srvErr := next.ServeHTTP(captured, r); srvErr != nil {
+			if srvErr := next.ServeHTTP(captured, r.WithContext(fetchCtx)); srvErr != nil {
 				middleware.errorCh <- srvErr
+				fetchSpan.SetAttributes(attribute.String("outcome", "error"))
 				captured.body.Reset()
 				captured.headers = immutableEmptyHeader
 				captured.WriteHeader(captured.statusCode)
 				_, _ = captured.Write(serviceTemporaryUnavailableBody)
 			}
 		default:
+			fetchSpan.SetAttributes(attribute.String("outcome", "throttled"))
 			captured.body.Reset()
 			captured.headers = immutableEmptyHeader
 			captured.WriteHeader(http.StatusTooManyRequests)
 			_, _ = captured.Write(tooManyRequestsBody)
 		}
 
+		// A body larger than Cache.Stream.MaxCacheableBodyBytes has already been streamed to
+		// the client in full by captureResponseWriter; it was never buffered, so skip caching.
+		if captured.nonCacheable {
+			fetchSpan.SetAttributes(attribute.String("outcome", "non_cacheable"))
+			return nil, nil
+		}
+
 		// Build new response
-		path := unsafe.Slice(unsafe.StringData(r.URL.Path), len(r.URL.Path))
-		data := model.NewData(middleware.cfg, path, captured.statusCode, captured.headers, captured.body.Bytes())
-		resp, _ = model.NewResponse(data, req, middleware.cfg, middleware.backend.RevalidatorMaker(req))
-
-		// Store response in cache
-		middleware.store.Set(resp)
-	} else {
-		// Write status code on hit
-		w.WriteHeader(resp.Data().StatusCode())
-
-		// Write response data
-		_, _ = w.Write(resp.Data().Body())
-
-		// Apply custom http headers
-		for key, vv := range resp.Data().Headers() {
-			for _, value := range vv {
-				w.Header().Add(key, value)
-			}
+		data := model.NewData(req.Rule(), captured.statusCode, captured.headers, captured.body.Bytes())
+		built, buildErr := model.NewResponse(data, req, middleware.cfg, middleware.backend.RevalidatorMaker(req), middleware.backend.ConditionalRevalidatorMaker(req))
+		if buildErr != nil {
+			fetchSpan.SetAttributes(attribute.String("outcome", "error"))
+			return nil, buildErr
+		}
+		built.SetTraceContext(ctx)
+		fetchSpan.SetAttributes(attribute.String("outcome", "fetched"), attribute.Int("bodyBytes", len(captured.body.Bytes())))
+
+		return built, nil
+	})
+
+	lookupSpan.SetAttributes(attribute.Bool("hit", shared))
+
+	// A hit (cached or a singleflight follower) never streamed bytes to its own w (only the
+	// leader did, while the loader ran), so write it here.
+	if shared {
+		if built == nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write(serviceTemporaryUnavailableBody)
+			return nil
 		}
+		writeCachedResponse(w, r, built)
+	}
+
+	if built == nil {
+		return nil
 	}
 
+	lookupSpan.SetAttributes(
+		attribute.Int64("ageSeconds", int64(time.Since(built.RevalidatedAt()).Seconds())),
+		attribute.Int("bodyBytes", len(built.Data().Body())),
+	)
+
 	// Apply standard http headers
-	w.Header().Add(lastModifiedKey, resp.RevalidatedAt().Format(http.TimeFormat))
+	w.Header().Add(lastModifiedKey, built.RevalidatedAt().Format(http.TimeFormat))
 
 	// Record the duration in debug mode for metrics.
 	if middleware.cfg.Cache.Logs.Stats {
@@ -150,3 +205,62 @@ func (middleware *CacheMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Requ
 
 	return err
 }
+
+// lookupAttrs builds the common cache.lookup/cache.upstream_fetch span attributes keyed by req,
+// mirroring pkg/storage/lru.Storage's requestAttrs.
+func lookupAttrs(req *model.Request) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("mapKey", strconv.FormatUint(req.MapKey(), 16)),
+	}
+	if rule := req.Rule(); rule != nil {
+		attrs = append(attrs, attribute.String("rule.path", rule.Path))
+	}
+	return attrs
+}
+
+// writeCachedResponse writes a cached *model.Response onto w, used both for regular cache hits
+// and for singleflight followers that weren't the goroutine which actually talked to upstream. The
+// body is re-negotiated against r's Accept-Encoding on every call (see negotiatedBody), so two
+// requests sharing the same cached Response can still walk away with different wire encodings.
+func writeCachedResponse(w http.ResponseWriter, r *http.Request, resp *model.Response) {
+	body, usedCodec, negotiated := negotiatedBody(r, resp)
+
+	w.WriteHeader(resp.Data().StatusCode())
+	_, _ = w.Write(body)
+	for key, vv := range resp.Data().Headers() {
+		if strings.EqualFold(key, "Content-Encoding") || strings.EqualFold(key, "Content-Length") {
+			continue
+		}
+		for _, value := range vv {
+			w.Header().Add(key, value)
+		}
+	}
+	if usedCodec != codec.None {
+		w.Header().Set("Content-Encoding", usedCodec)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if negotiated {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+}
+
+// negotiatedBody picks the body/codec from resp.Data()'s stored variant set that best matches r's
+// Accept-Encoding, falling back to on-the-fly decode+encode (via Response.NegotiateVariant) only
+// when no precomputed variant already matches. negotiated is true whenever the response's rule has
+// compression enabled (not Compression.Disabled), and the caller then adds Vary: Accept-Encoding;
+// it is not narrowed to rules that actually end up offering more than one encoding.
+func negotiatedBody(r *http.Request, resp *model.Response) (body []byte, usedCodec string, negotiated bool) {
+	rule := resp.Request().Rule()
+	if rule == nil || rule.Compression.Disabled {
+		return resp.Data().Body(), resp.Data().Codec(), false
+	}
+
+	candidates := append([]string{resp.Data().Codec()}, rule.Compression.Negotiate...)
+	best := codec.NegotiateEncoding(r.Header.Get("Accept-Encoding"), candidates)
+
+	body, usedCodec, err := resp.NegotiateVariant(best)
+	if err != nil {
+		return resp.Data().Body(), resp.Data().Codec(), true
+	}
+	return body, usedCodec, true
+}
@@ -1,13 +1,24 @@
 package advancedcache
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/pkg/config"
+	"github.com/caddyserver/caddy/v2/pkg/telemetry"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+// UnmarshalCaddyfile parses both config_path (pointing at an external YAML file, the historic
+// behavior) and a full inline config.Cache tree, so a classic Caddyfile-only deployment never has
+// to ship a second YAML file just to customize this module. Recognized blocks mirror config.Cache's
+// own sections: upstream, eviction, refresh, storage, logs, and any number of repeated rule blocks.
+// Inline values are kept on inlineCfg rather than applied directly; configure() merges them onto
+// whatever config_path loaded (see config.MergeInline) once both are known.
 func (middleware *CacheMiddleware) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	inline := &config.Cache{}
 	for d.Next() {
 		for d.NextBlock(0) {
 			switch d.Val() {
@@ -15,20 +26,274 @@ func (middleware *CacheMiddleware) UnmarshalCaddyfile(d *caddyfile.Dispenser) er
 				if !d.Args(&middleware.ConfigPath) {
 					return d.Errf("advancedcache config path expected by found in Caddyfile")
 				}
+			case "upstream":
+				if err := parseUpstreamBlock(d, &inline.Cache.Upstream); err != nil {
+					return err
+				}
+			case "eviction":
+				if err := parseEvictionBlock(d, &inline.Cache.Eviction); err != nil {
+					return err
+				}
+			case "refresh":
+				if err := parseRefreshBlock(d, &inline.Cache.Refresh); err != nil {
+					return err
+				}
+			case "storage":
+				if err := parseStorageBlock(d, &inline.Cache.Storage); err != nil {
+					return err
+				}
+			case "logs":
+				if err := parseLogsBlock(d, &inline.Cache.Logs); err != nil {
+					return err
+				}
+			case "rule":
+				rule, err := parseRuleBlock(d)
+				if err != nil {
+					return err
+				}
+				inline.Cache.Rules = append(inline.Cache.Rules, rule)
 			default:
 				return d.Errf("unknown directive: %s", d.Val())
 			}
 		}
 	}
+	middleware.inlineCfg = inline
+	return nil
+}
+
+func parseUpstreamBlock(d *caddyfile.Dispenser, up *config.Upstream) error {
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "url":
+			if !d.Args(&up.Url) {
+				return d.ArgErr()
+			}
+		case "rate":
+			rate, err := parseArgInt(d)
+			if err != nil {
+				return err
+			}
+			up.Rate = rate
+		case "timeout":
+			timeout, err := parseArgDuration(d)
+			if err != nil {
+				return err
+			}
+			up.Timeout = timeout
+		default:
+			return d.Errf("unknown upstream directive: %s", d.Val())
+		}
+	}
+	return nil
+}
+
+func parseEvictionBlock(d *caddyfile.Dispenser, ev *config.Eviction) error {
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "policy":
+			if !d.Args(&ev.Policy) {
+				return d.ArgErr()
+			}
+		case "threshold":
+			threshold, err := parseArgFloat(d)
+			if err != nil {
+				return err
+			}
+			ev.Threshold = threshold
+		default:
+			return d.Errf("unknown eviction directive: %s", d.Val())
+		}
+	}
+	return nil
+}
+
+func parseRefreshBlock(d *caddyfile.Dispenser, refresh *config.Refresh) error {
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "ttl":
+			ttl, err := parseArgDuration(d)
+			if err != nil {
+				return err
+			}
+			refresh.TTL = ttl
+		case "error_ttl":
+			errorTTL, err := parseArgDuration(d)
+			if err != nil {
+				return err
+			}
+			refresh.ErrorTTL = errorTTL
+		case "beta":
+			beta, err := parseArgFloat(d)
+			if err != nil {
+				return err
+			}
+			refresh.Beta = beta
+		case "min_stale":
+			// MinStale is normally derived from TTL*Beta (see config.Normalize); accepting it here
+			// too is harmless since Normalize recomputes and overwrites it afterwards.
+			if _, err := parseArgDuration(d); err != nil {
+				return err
+			}
+		default:
+			return d.Errf("unknown refresh directive: %s", d.Val())
+		}
+	}
+	return nil
+}
+
+func parseStorageBlock(d *caddyfile.Dispenser, st *config.Storage) error {
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "type":
+			if !d.Args(&st.Type) {
+				return d.ArgErr()
+			}
+		case "size":
+			var raw string
+			if !d.Args(&raw) {
+				return d.ArgErr()
+			}
+			size, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				return d.Errf("invalid storage size %q: %v", raw, err)
+			}
+			st.Size = uint(size)
+		default:
+			return d.Errf("unknown storage directive: %s", d.Val())
+		}
+	}
+	return nil
+}
+
+func parseLogsBlock(d *caddyfile.Dispenser, logs *config.Logs) error {
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "level":
+			if !d.Args(&logs.Level) {
+				return d.ArgErr()
+			}
+			if _, err := zerolog.ParseLevel(logs.Level); err != nil {
+				return d.Errf("invalid logs level %q: %v", logs.Level, err)
+			}
+		case "stats":
+			logs.Stats = true
+		default:
+			return d.Errf("unknown logs directive: %s", d.Val())
+		}
+	}
 	return nil
 }
 
+// parseRuleBlock parses "rule <path> { ... }", mirroring config.Rule's own YAML shape.
+func parseRuleBlock(d *caddyfile.Dispenser) (*config.Rule, error) {
+	rule := &config.Rule{}
+	if !d.Args(&rule.Path) {
+		return nil, d.Errf("rule path expected but not found in Caddyfile")
+	}
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "ttl":
+			ttl, err := parseArgDuration(d)
+			if err != nil {
+				return nil, err
+			}
+			rule.TTL = ttl
+		case "error_ttl":
+			errorTTL, err := parseArgDuration(d)
+			if err != nil {
+				return nil, err
+			}
+			rule.ErrorTTL = errorTTL
+		case "beta":
+			beta, err := parseArgFloat(d)
+			if err != nil {
+				return nil, err
+			}
+			rule.Beta = beta
+		case "cache_key":
+			for d.NextBlock(2) {
+				switch d.Val() {
+				case "query":
+					rule.CacheKey.Query = append(rule.CacheKey.Query, d.RemainingArgs()...)
+				case "headers":
+					rule.CacheKey.Headers = append(rule.CacheKey.Headers, d.RemainingArgs()...)
+				default:
+					return nil, d.Errf("unknown cache_key directive: %s", d.Val())
+				}
+			}
+		case "cache_value":
+			for d.NextBlock(2) {
+				switch d.Val() {
+				case "headers":
+					rule.CacheValue.Headers = append(rule.CacheValue.Headers, d.RemainingArgs()...)
+				default:
+					return nil, d.Errf("unknown cache_value directive: %s", d.Val())
+				}
+			}
+		default:
+			return nil, d.Errf("unknown rule directive: %s", d.Val())
+		}
+	}
+	return rule, nil
+}
+
+func parseArgInt(d *caddyfile.Dispenser) (int, error) {
+	var raw string
+	if !d.Args(&raw) {
+		return 0, d.ArgErr()
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, d.Errf("invalid integer %q for %s: %v", raw, d.Val(), err)
+	}
+	return v, nil
+}
+
+func parseArgFloat(d *caddyfile.Dispenser) (float64, error) {
+	var raw string
+	if !d.Args(&raw) {
+		return 0, d.ArgErr()
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, d.Errf("invalid float %q for %s: %v", raw, d.Val(), err)
+	}
+	return v, nil
+}
+
+func parseArgDuration(d *caddyfile.Dispenser) (time.Duration, error) {
+	var raw string
+	if !d.Args(&raw) {
+		return 0, d.ArgErr()
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, d.Errf("invalid duration %q for %s: %v", raw, d.Val(), err)
+	}
+	return v, nil
+}
+
+// configure builds the effective *config.Cache for this middleware: config_path (if set) supplies
+// the base, inline Caddyfile blocks parsed by UnmarshalCaddyfile are merged on top (inline wins
+// field-by-field -- see config.MergeInline), and the merged result is validated through the exact
+// same config.Normalize pass LoadConfig already runs, so there's no behavioral difference between a
+// YAML-only, Caddyfile-only, or mixed deployment.
 func (middleware *CacheMiddleware) configure() (err error) {
-	log.Info().Msgf("[advanced-cache] loading config by path %s", middleware.ConfigPath)
-	if middleware.cfg, err = config.LoadConfig(middleware.ConfigPath); err != nil {
-		return err
+	var cfg *config.Cache
+	if middleware.ConfigPath != "" {
+		log.Info().Msgf("[advanced-cache] loading config by path %s", middleware.ConfigPath)
+		if cfg, err = config.LoadConfig(middleware.ConfigPath); err != nil {
+			return err
+		}
+	} else {
+		cfg = &config.Cache{}
 	}
 
+	cfg = config.MergeInline(cfg, middleware.inlineCfg)
+	config.Normalize(cfg)
+	middleware.cfg = cfg
+	middleware.tracer = telemetry.New(cfg.Cache.Telemetry.TracingEnabled, "advancedcache.CacheMiddleware")
+
 	log.Info().Msgf("[config] loaded=%+v", middleware.cfg)
 
 	level, err := zerolog.ParseLevel(middleware.cfg.Cache.Logs.Level)
@@ -0,0 +1,30 @@
+package advancedcache
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// serveMetrics runs a standalone HTTP server exposing the process's VictoriaMetrics registry on
+// addr, independent of whatever (if anything) the operator's own Caddyfile routes the
+// modules/metrics handler onto. Exits once ctx is canceled.
+func serveMetrics(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		metrics.WritePrometheus(w, true)
+	})
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	log.Info().Str("addr", addr).Msg("[advanced-cache] metrics server listening")
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Error().Err(err).Str("addr", addr).Msg("[advanced-cache] metrics server failed")
+	}
+}
@@ -0,0 +1,185 @@
+package advancedcache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/caddyserver/caddy/v2/pkg/storage"
+	"github.com/caddyserver/caddy/v2/pkg/storage/invalidation"
+)
+
+const purgeModuleName = "advanced_cache_purge"
+
+func init() {
+	caddy.RegisterModule(&PurgeHandler{})
+	httpcaddyfile.RegisterHandlerDirective(purgeModuleName, parsePurgeCaddyfile)
+}
+
+// defaultCacheID is the registration key used when neither a CacheMiddleware's Cache.Purge.ID nor a
+// PurgeHandler's CacheID is set, so the common single-cache-per-process deployment needs no extra
+// configuration to wire the two together.
+const defaultCacheID = "default"
+
+// activeCache is how PurgeHandler reaches the storage.Storage a CacheMiddleware instance built:
+// Caddy provisions handler modules independently, so PurgeHandler never otherwise sees it. Keyed by
+// cache ID rather than a single slot, so distinct CacheMiddleware instances sharing one process
+// (several sites in one Caddyfile) each get their own store/token instead of the last one to
+// provision silently replacing every other's.
+var activeCache = struct {
+	mu      sync.RWMutex
+	entries map[string]activeCacheEntry
+}{entries: make(map[string]activeCacheEntry)}
+
+type activeCacheEntry struct {
+	store storage.Storage
+	token string
+}
+
+// registerActiveCache publishes store/token under id for PurgeHandler to serve requests against,
+// called once store is finalized (see CacheMiddleware.run). An empty token leaves the endpoint
+// disabled for that id; an empty id falls back to defaultCacheID.
+func registerActiveCache(id string, store storage.Storage, token string) {
+	if id == "" {
+		id = defaultCacheID
+	}
+	activeCache.mu.Lock()
+	defer activeCache.mu.Unlock()
+	activeCache.entries[id] = activeCacheEntry{store: store, token: token}
+}
+
+func activeCacheSnapshot(id string) (store storage.Storage, token string) {
+	if id == "" {
+		id = defaultCacheID
+	}
+	activeCache.mu.RLock()
+	defer activeCache.mu.RUnlock()
+	entry := activeCache.entries[id]
+	return entry.store, entry.token
+}
+
+var _ caddy.Module = (*PurgeHandler)(nil)
+
+// PurgeHandler serves an authenticated POST /cache/purge admin endpoint accepting
+// {"tags": [...]}, {"paths": [...]}, and/or {"keys": [...]}, invalidating every matching cache
+// entry across shards (and, with Cache.Invalidation enabled, cluster-wide) and replying with how
+// much was actually freed. Tags and paths only remove entries from a backend that implements
+// invalidation.PatternRemover (lru.Storage), and keys only from one reachable through
+// storage.KeyRemover; elsewhere that part of the request removes nothing and counts zero. The
+// shared secret and live store come from whichever CacheMiddleware
+// instance registered under the matching CacheID (see registerActiveCache), since Caddy provisions
+// handler modules independently of one another.
+type PurgeHandler struct {
+	// CacheID must match the Cache.Purge.ID of the CacheMiddleware instance this handler should
+	// purge. Required whenever a process runs more than one CacheMiddleware; left empty it matches a
+	// CacheMiddleware that also left Cache.Purge.ID unset.
+	CacheID string `json:"cache_id,omitempty"`
+}
+
+func (*PurgeHandler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers." + purgeModuleName,
+		New: func() caddy.Module { return new(PurgeHandler) },
+	}
+}
+
+type purgeRequest struct {
+	Tags  []string `json:"tags"`
+	Paths []string `json:"paths"`
+	Keys  []uint64 `json:"keys"`
+}
+
+type purgeResult struct {
+	FreedBytes int64 `json:"freed_bytes"`
+	Removed    int   `json:"removed"`
+}
+
+func (h *PurgeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, _ caddyhttp.Handler) error {
+	store, token := activeCacheSnapshot(h.CacheID)
+	if token == "" {
+		http.NotFound(w, r)
+		return nil
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+	if !bearerMatches(r.Header.Get("Authorization"), token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+
+	var req purgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return nil
+	}
+
+	result := purgeResult{}
+
+	patternRemover, _ := store.(invalidation.PatternRemover)
+	for _, tag := range req.Tags {
+		if patternRemover == nil {
+			break
+		}
+		freed, removed := patternRemover.RemoveByPattern("tag:" + tag)
+		result.FreedBytes += freed
+		result.Removed += removed
+	}
+	for _, path := range req.Paths {
+		if patternRemover == nil {
+			break
+		}
+		freed, removed := patternRemover.RemoveByPattern("path:" + path)
+		result.FreedBytes += freed
+		result.Removed += removed
+	}
+
+	keyRemover, _ := store.(storage.KeyRemover)
+	for _, key := range req.Keys {
+		if keyRemover == nil {
+			break
+		}
+		if freed, isHit := keyRemover.RemoveByKey(key); isHit {
+			result.FreedBytes += freed
+			result.Removed++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+	return nil
+}
+
+// bearerMatches reports whether header is an "Authorization: Bearer <token>" value matching token
+// exactly; token is already known non-empty by the only caller. Uses a constant-time comparison
+// since this guards an admin endpoint that can purge the whole cache — a variable-time == would
+// leak how many leading bytes of a guess matched via response timing.
+func bearerMatches(header, token string) bool {
+	const prefix = "Bearer "
+	if !strings.HasPrefix(header, prefix) {
+		return false
+	}
+	presented := strings.TrimPrefix(header, prefix)
+	return subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1
+}
+
+// parsePurgeCaddyfile handles the `advanced_cache_purge [cache_id]` directive; the shared secret
+// itself still only comes from Cache.Purge.Token in the config CacheMiddleware loads. cache_id is
+// only required when more than one CacheMiddleware shares this process (see PurgeHandler.CacheID).
+func parsePurgeCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := &PurgeHandler{}
+	args := h.RemainingArgs()
+	if len(args) > 1 {
+		return nil, h.ArgErr()
+	}
+	if len(args) == 1 {
+		handler.CacheID = args[0]
+	}
+	return handler, nil
+}
@@ -2,6 +2,8 @@ package advancedcache
 
 import (
 	"context"
+
+	"github.com/caddyserver/caddy/v2/pkg/telemetry"
 	"github.com/rs/zerolog/log"
 )
 
@@ -14,7 +16,18 @@ func (middleware *CacheMiddleware) run(ctx context.Context) error {
 		return err
 	}
 
+	shutdown, err := telemetry.Configure(ctx, middleware.cfg.Cache.Observability)
+	if err != nil {
+		log.Error().Err(err).Msg("[telemetry] failed to configure OTLP export, spans stay local to this process")
+	}
+	middleware.tracingShutdown = shutdown
+
+	if addr := middleware.cfg.Cache.Observability.MetricsAddr; addr != "" {
+		go serveMetrics(ctx, addr)
+	}
+
 	middleware.setUpCache()
+	registerActiveCache(middleware.cfg.Cache.Purge.ID, middleware.store, middleware.cfg.Cache.Purge.Token)
 
 	if err := middleware.loadDump(); err != nil {
 		log.Error().Err(err).Msg("[dump] failed to load")
@@ -29,6 +42,16 @@ func (middleware *CacheMiddleware) run(ctx context.Context) error {
 	middleware.store.Run()
 	middleware.evictor.Run()
 	middleware.refresher.Run()
+	if middleware.invalidator != nil {
+		go middleware.invalidator.Run()
+		if middleware.cfg.Cache.Invalidation.ResyncOnStart {
+			go func() {
+				if err := middleware.invalidator.ResyncIfSupported(ctx); err != nil {
+					log.Error().Err(err).Msg("[invalidation] resync failed")
+				}
+			}()
+		}
+	}
 	middleware.runControllerLogger()
 
 	log.Info().Msg("[advanced-cache] has been started")
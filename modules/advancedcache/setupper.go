@@ -1,20 +1,194 @@
 package advancedcache
 
 import (
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2/pkg/cluster"
+	"github.com/caddyserver/caddy/v2/pkg/config"
 	"github.com/caddyserver/caddy/v2/pkg/model"
 	"github.com/caddyserver/caddy/v2/pkg/repository"
 	"github.com/caddyserver/caddy/v2/pkg/storage"
+	"github.com/caddyserver/caddy/v2/pkg/storage/coordinator"
+	"github.com/caddyserver/caddy/v2/pkg/storage/invalidation"
 	"github.com/caddyserver/caddy/v2/pkg/storage/lfu"
 	"github.com/caddyserver/caddy/v2/pkg/storage/lru"
 	sharded "github.com/caddyserver/caddy/v2/pkg/storage/map"
+	"github.com/caddyserver/caddy/v2/pkg/storage/namespace"
+	"github.com/caddyserver/caddy/v2/pkg/storage/observability"
+	"github.com/caddyserver/caddy/v2/pkg/storage/tiered"
+
+	// Blank-imported purely for their init()-time storage.RegisterDriver side effect: setupper.go
+	// dispatches to these backends by name through pkg/storage's driver registry, not by calling
+	// into these packages directly.
+	_ "github.com/caddyserver/caddy/v2/pkg/storage/memcached"
+	_ "github.com/caddyserver/caddy/v2/pkg/storage/pebble"
+	_ "github.com/caddyserver/caddy/v2/pkg/storage/redis"
+	"github.com/rs/zerolog/log"
 )
 
 func (middleware *CacheMiddleware) setUpCache() {
+	middleware.backend = repository.NewBackend(middleware.ctx, middleware.cfg)
+
+	var ring *cluster.Ring
+	if middleware.cfg.Cache.Cluster.IsEnabled {
+		ring = cluster.NewRing(middleware.cfg.Cache.Cluster.Peers)
+		middleware.forwarder = cluster.NewForwarder(middleware.cfg.Cache.Cluster.Self, ring, nil)
+	}
+
+	// A non-empty Tiers list takes precedence over Type: it chains several backends (e.g. malloc L1
+	// in front of a redis L2) behind pkg/storage/tiered instead of picking exactly one.
+	if len(middleware.cfg.Cache.Storage.Tiers) > 0 {
+		middleware.setUpTieredCache(ring)
+		return
+	}
+
+	// Remote/on-disk backends (redis, memcached, pebble, and anything else registered against
+	// pkg/storage's driver registry) persist and expire entries themselves, so none of them have a
+	// balancer/shard model for this package's threshold-driven eviction, sampling-based refresh, or
+	// shard-file Dump to operate on; those subsystems are left as no-ops for anything but "malloc".
+	switch middleware.cfg.Cache.Storage.Type {
+	case "", "malloc":
+		middleware.setUpMallocCache(ring)
+	default:
+		store, err := storage.NewStorage(middleware.ctx, middleware.cfg.Cache.Storage.Type, middleware.cfg, middleware.backend)
+		if err != nil {
+			log.Error().Err(err).Str("type", middleware.cfg.Cache.Storage.Type).Msg("[advanced-cache] failed to open storage backend, falling back to malloc")
+			middleware.setUpMallocCache(ring)
+			return
+		}
+		middleware.store = observability.Wrap(middleware.wrapInvalidation(middleware.wrapNamespace(store)))
+		middleware.refresher = storage.NoopRunner{}
+		middleware.evictor = storage.NoopRunner{}
+		middleware.dumper = storage.NoopDumper{}
+	}
+}
+
+// wrapNamespace layers pkg/storage/namespace over store when Cache.Storage.Namespace is set, so
+// several independently configured Caddy sites can share one physical backend without their keys
+// colliding. It's the innermost decorator: invalidation/observability instrument this namespace's
+// slice of traffic, not the shared backend's full traffic.
+func (middleware *CacheMiddleware) wrapNamespace(store storage.Storage) storage.Storage {
+	ns := middleware.cfg.Cache.Storage.Namespace
+	if ns == "" {
+		return store
+	}
+	return namespace.Wrap(store, ns)
+}
+
+// wrapInvalidation constructs middleware.invalidator and layers cross-instance purge broadcast over
+// store when Cache.Invalidation.IsEnabled and store opts into storage.KeyRemover; otherwise store is
+// returned unchanged and middleware.invalidator stays nil (runner.go skips starting it).
+func (middleware *CacheMiddleware) wrapInvalidation(store storage.Storage) storage.Storage {
+	if !middleware.cfg.Cache.Invalidation.IsEnabled {
+		return store
+	}
+	remover, ok := store.(storage.KeyRemover)
+	if !ok {
+		return store
+	}
+	middleware.invalidator = invalidation.NewCoordinator(middleware.ctx, middleware.cfg, remover)
+	return invalidation.Wrap(store, middleware.invalidator)
+}
+
+// setUpMallocCache wires the historic in-process backend: a sharded map with per-shard LRU lists,
+// TinyLFU admission, threshold-driven eviction, background refresh sampling, and shard-file Dump.
+func (middleware *CacheMiddleware) setUpMallocCache(ring *cluster.Ring) {
+	store, balancer, shardedMap := middleware.buildMallocStore()
+
+	// wrapInvalidation must run before NewRefresher: it's what populates middleware.invalidator,
+	// which the refresher needs (via refreshBroadcaster) to suppress refreshes a peer already did.
+	wrapped := middleware.wrapInvalidation(middleware.wrapNamespace(store))
+	middleware.refresher = storage.NewRefresher(middleware.ctx, middleware.cfg, balancer, newRefreshCoordinator(middleware.cfg, ring), refreshBroadcaster(middleware.invalidator))
+	middleware.dumper = storage.NewDumper(middleware.cfg, shardedMap, store, middleware.backend)
+	middleware.evictor = storage.NewEvictor(middleware.ctx, middleware.cfg, store, balancer)
+	middleware.evacuator = storage.NewEvacuator(middleware.ctx, middleware.cfg, store, balancer)
+	middleware.store = observability.Wrap(wrapped)
+}
+
+// buildMallocStore constructs the in-process backend's store plus the balancer/shardedMap that back
+// it, without wiring up the middleware-wide refresher/dumper/evictor/evacuator fields; shared by
+// setUpMallocCache and setUpTieredCache, which only wants those subsystems pointed at the malloc
+// tier specifically.
+func (middleware *CacheMiddleware) buildMallocStore() (*lru.Storage, lru.Balancer, *sharded.Map[*model.Response]) {
 	shardedMap := sharded.NewMap[*model.Response](middleware.ctx, middleware.cfg.Cache.Preallocate.PerShard)
-	middleware.backend = repository.NewBackend(middleware.cfg)
 	balancer := lru.NewBalancer(middleware.ctx, shardedMap)
-	middleware.refresher = storage.NewRefresher(middleware.ctx, middleware.cfg, balancer)
-	middleware.store = lru.NewStorage(middleware.ctx, middleware.cfg, balancer, middleware.backend, lfu.NewTinyLFU(middleware.ctx), shardedMap)
-	middleware.dumper = storage.NewDumper(middleware.cfg, shardedMap, middleware.store, middleware.backend)
-	middleware.evictor = storage.NewEvictor(middleware.ctx, middleware.cfg, middleware.store, balancer)
+	capacityHint := middleware.cfg.Cache.Preallocate.PerShard * int(sharded.NumOfShards)
+	admitter := lfu.NewComposite(middleware.ctx, middleware.cfg.Cache.Rules, middleware.cfg.Cache.Eviction.Policy, capacityHint)
+	store := lru.NewStorage(middleware.ctx, middleware.cfg, balancer, middleware.backend, admitter, shardedMap)
+	return store, balancer, shardedMap
+}
+
+// setUpTieredCache builds one storage.Storage per entry in Cache.Storage.Tiers (hottest first) and
+// composes them behind pkg/storage/tiered.Storage. The refresher/dumper/evictor/evacuator
+// subsystems only make sense against the in-process shard model, so if one tier is "malloc" they're
+// wired against that tier's own balancer/shardedMap; otherwise (an all-remote chain) they're left as
+// no-ops, same as a single remote Type.
+func (middleware *CacheMiddleware) setUpTieredCache(ring *cluster.Ring) {
+	tiers := middleware.cfg.Cache.Storage.Tiers
+	stores := make([]storage.Storage, 0, len(tiers))
+	opts := make([]tiered.TierOption, 0, len(tiers))
+	var mallocBalancer lru.Balancer
+
+	middleware.refresher = storage.NoopRunner{}
+	middleware.evictor = storage.NoopRunner{}
+	middleware.dumper = storage.NoopDumper{}
+
+	for i, t := range tiers {
+		opt := tiered.TierOption{Label: fmt.Sprintf("%s-%d", t.Type, i), Async: t.Async, Breaker: t.CircuitBreaker}
+
+		switch t.Type {
+		case "", "malloc":
+			store, balancer, shardedMap := middleware.buildMallocStore()
+			middleware.evictor = storage.NewEvictor(middleware.ctx, middleware.cfg, store, balancer)
+			middleware.evacuator = storage.NewEvacuator(middleware.ctx, middleware.cfg, store, balancer)
+			middleware.dumper = storage.NewDumper(middleware.cfg, shardedMap, store, middleware.backend)
+			stores = append(stores, store)
+			mallocBalancer = balancer
+		default:
+			store, err := storage.NewStorage(middleware.ctx, t.Type, middleware.cfg, middleware.backend)
+			if err != nil {
+				log.Error().Err(err).Str("tier", opt.Label).Msg("[advanced-cache] failed to open storage tier, skipping it")
+				continue
+			}
+			stores = append(stores, store)
+		}
+		opts = append(opts, opt)
+	}
+
+	// wrapInvalidation must run before NewRefresher: it's what populates middleware.invalidator,
+	// which the refresher needs (via refreshBroadcaster) to suppress refreshes a peer already did.
+	tieredStore := tiered.NewStorage(middleware.ctx, middleware.cfg, stores, opts)
+	wrapped := middleware.wrapInvalidation(middleware.wrapNamespace(tieredStore))
+	if mallocBalancer != nil {
+		middleware.refresher = storage.NewRefresher(middleware.ctx, middleware.cfg, mallocBalancer, newRefreshCoordinator(middleware.cfg, ring), refreshBroadcaster(middleware.invalidator))
+	}
+	middleware.store = observability.Wrap(wrapped)
+}
+
+// refreshBroadcaster adapts middleware.invalidator (a *invalidation.Coordinator, possibly nil) to
+// storage.RefreshBroadcaster. Assigning a nil *invalidation.Coordinator straight to the interface
+// parameter would produce a non-nil interface wrapping a nil pointer, breaking refresher.go's
+// `r.broadcaster != nil` checks; returning a literal nil here keeps them meaningful.
+func refreshBroadcaster(c *invalidation.Coordinator) storage.RefreshBroadcaster {
+	if c == nil {
+		return nil
+	}
+	return c
+}
+
+// newRefreshCoordinator picks the storage.RefreshCoordinator implied by Cache.Refresh.Coordinator.Mode.
+// "peers" reuses the cluster ring (built only when clustering is enabled), so it falls back to no
+// coordination if clustering is off.
+func newRefreshCoordinator(cfg *config.Cache, ring *cluster.Ring) storage.RefreshCoordinator {
+	switch cfg.Cache.Refresh.Coordinator.Mode {
+	case "redis":
+		return coordinator.NewRedisCoordinator(cfg.Cache.Refresh.Coordinator.RedisAddr, cfg.Cache.Refresh.Coordinator.LeaseTTL)
+	case "peers":
+		if ring == nil {
+			return nil
+		}
+		return coordinator.NewPeerCoordinator(cfg.Cache.Cluster.Self, ring)
+	default:
+		return nil
+	}
 }
@@ -3,25 +3,43 @@ package advancedcache
 import (
 	"bytes"
 	"net/http"
+	"sync"
 )
 
+// bufferPool hands out the *bytes.Buffer instances captureResponseWriter accumulates cacheable
+// bodies into. Pooling them keeps the stream-through path from allocating a fresh buffer per miss.
+var bufferPool = &sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// captureResponseWriter mirrors upstream writes straight through to the client (so first-byte
+// latency isn't affected by caching) while fanning body chunks out into a pooled buffer, up to
+// maxCacheableBytes. Once that budget is exceeded the buffer is released and the response is
+// marked nonCacheable, so the bytes already sent to the client are never duplicated in memory.
 type captureResponseWriter struct {
-	wrapped     http.ResponseWriter
-	body        *bytes.Buffer
-	statusCode  int
-	headers     http.Header
-	wroteHeader bool
+	wrapped           http.ResponseWriter
+	body              *bytes.Buffer
+	statusCode        int
+	headers           http.Header
+	wroteHeader       bool
+	maxCacheableBytes int64
+	nonCacheable      bool
 }
 
-func newCaptureResponseWriter(w http.ResponseWriter) *captureResponseWriter {
+func newCaptureResponseWriter(w http.ResponseWriter, maxCacheableBytes int64) *captureResponseWriter {
 	return &captureResponseWriter{
-		wrapped:    w,
-		body:       new(bytes.Buffer),
-		statusCode: http.StatusOK,
-		headers:    make(http.Header),
+		wrapped:           w,
+		body:              bufferPool.Get().(*bytes.Buffer),
+		statusCode:        http.StatusOK,
+		headers:           make(http.Header),
+		maxCacheableBytes: maxCacheableBytes,
 	}
 }
 
+// release returns the capture's buffer to the pool. Call once the response has been consumed.
+func (w *captureResponseWriter) release() {
+	w.body.Reset()
+	bufferPool.Put(w.body)
+}
+
 func (w *captureResponseWriter) Header() http.Header {
 	// intercept and work with our copy of headers
 	return w.headers
@@ -43,11 +61,27 @@ func (w *captureResponseWriter) WriteHeader(code int) {
 	w.wrapped.WriteHeader(code)
 }
 
+// Write streams b to the client unconditionally, then fans it out into the cacheable buffer.
+// Once maxCacheableBytes is crossed, the buffer is dropped and nonCacheable is latched so the
+// caller knows not to hand this response to the store.
 func (w *captureResponseWriter) Write(b []byte) (int, error) {
 	// ensure WriteHeader is called if not already done
 	if !w.wroteHeader {
 		w.WriteHeader(http.StatusOK)
 	}
-	w.body.Write(b) // Save to buffer
-	return w.wrapped.Write(b)
+
+	if !w.nonCacheable {
+		if w.maxCacheableBytes > 0 && int64(w.body.Len()+len(b)) > w.maxCacheableBytes {
+			w.nonCacheable = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+
+	n, err := w.wrapped.Write(b)
+	if flusher, ok := w.wrapped.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
 }
@@ -0,0 +1,39 @@
+// Package metrics registers a standalone Caddy HTTP handler that exposes the process's
+// VictoriaMetrics registry (everything advancedcache and its storage/repository packages record)
+// as a single `/metrics` endpoint, so operators get one scrape target instead of assembling one
+// from the ad-hoc per-handler counters the rest of this module writes directly.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+const moduleName = "metrics"
+
+func init() {
+	caddy.RegisterModule(&Handler{})
+	httpcaddyfile.RegisterHandlerDirective(moduleName, parseCaddyfile)
+}
+
+var _ caddy.Module = (*Handler)(nil)
+
+// Handler writes the process-wide Prometheus exposition format directly to the response; it takes
+// no configuration of its own.
+type Handler struct{}
+
+func (*Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers." + moduleName,
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+func (*Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, _ caddyhttp.Handler) error {
+	metrics.WritePrometheus(w, true)
+	return nil
+}
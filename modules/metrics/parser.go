@@ -0,0 +1,11 @@
+package metrics
+
+import (
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// parseCaddyfile handles the bare `metrics` directive; it takes no arguments or block.
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	return &Handler{}, nil
+}
@@ -0,0 +1,75 @@
+package cluster
+
+import (
+	"io"
+	"net/http"
+)
+
+// Forwarder proxies a request to whichever peer owns its key, so only the key's ReplicationFactor
+// owners in the cluster ever cache (and fetch) it.
+type Forwarder struct {
+	self   string
+	ring   *Ring
+	client *http.Client
+}
+
+// NewForwarder builds a Forwarder. self is this instance's own peer address, as it appears in
+// the peer list, so Owner lookups can be compared against it to detect local ownership.
+func NewForwarder(self string, ring *Ring, client *http.Client) *Forwarder {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Forwarder{self: self, ring: ring, client: client}
+}
+
+// Owns reports whether this instance is one of key's ReplicationFactor owners (primary or
+// backup) and should serve/cache it locally.
+func (f *Forwarder) Owns(key uint64) bool {
+	if f.ring == nil {
+		return true
+	}
+	owners := f.ring.Owners(key, ReplicationFactor)
+	if len(owners) == 0 {
+		return true
+	}
+	for _, owner := range owners {
+		if owner == f.self {
+			return true
+		}
+	}
+	return false
+}
+
+// Forward re-issues r against key's owners in ring order (the primary first, then each backup)
+// and copies the first successful response onto w verbatim, so one owner being unreachable
+// degrades to the next replica instead of failing the request outright. Used when this instance
+// isn't one of key's owners: rather than caching the key locally too (and duplicating origin
+// load), it proxies to an instance that does.
+func (f *Forwarder) Forward(w http.ResponseWriter, r *http.Request, key uint64) error {
+	owners := f.ring.Owners(key, ReplicationFactor)
+
+	var lastErr error
+	for _, owner := range owners {
+		req := r.Clone(r.Context())
+		req.RequestURI = ""
+		req.URL.Scheme = "http"
+		req.URL.Host = owner
+
+		resp, err := f.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		for key, vv := range resp.Header {
+			for _, v := range vv {
+				w.Header().Add(key, v)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, err = io.Copy(w, resp.Body)
+		_ = resp.Body.Close()
+		return err
+	}
+	return lastErr
+}
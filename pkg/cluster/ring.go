@@ -0,0 +1,87 @@
+// Package cluster lets several instances of the advanced-cache module share one logical cache by
+// consistently hashing each key to a primary owning peer plus ReplicationFactor-1 backups and
+// forwarding requests from every other peer there, instead of every instance independently caching
+// (and independently hammering the origin for) the same keys.
+package cluster
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/zeebo/xxh3"
+)
+
+// virtualNodesPerPeer trades ring-balance for lookup cost: more points per peer spread load more
+// evenly across the hash space at the price of a larger sorted slice to binary-search.
+const virtualNodesPerPeer = 160
+
+// ReplicationFactor is how many distinct peers Owners returns for a key: the primary owner plus
+// ReplicationFactor-1 backups, so a Forwarder can fall back to a backup when the primary is
+// unreachable instead of failing the request outright.
+const ReplicationFactor = 2
+
+// Ring is a consistent-hash ring over a static list of peer addresses. It is read-only once
+// built; peer set changes (detected via config reload or service discovery) replace the whole
+// Ring rather than mutating it, so lookups never need locking.
+type Ring struct {
+	points []point
+}
+
+type point struct {
+	hash uint64
+	peer string
+}
+
+// NewRing builds a consistent-hash ring over peers, each represented by virtualNodesPerPeer
+// points so ownership is distributed roughly evenly regardless of how peer addresses happen to
+// hash.
+func NewRing(peers []string) *Ring {
+	r := &Ring{points: make([]point, 0, len(peers)*virtualNodesPerPeer)}
+	for _, peer := range peers {
+		for v := 0; v < virtualNodesPerPeer; v++ {
+			r.points = append(r.points, point{
+				hash: xxh3.HashString(peer + "#" + strconv.Itoa(v)),
+				peer: peer,
+			})
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i].hash < r.points[j].hash })
+	return r
+}
+
+// Owner returns the primary peer address responsible for key. Returns "" if the ring has no
+// peers.
+func (r *Ring) Owner(key uint64) string {
+	owners := r.Owners(key, 1)
+	if len(owners) == 0 {
+		return ""
+	}
+	return owners[0]
+}
+
+// Owners returns up to n distinct peers responsible for key, walking the ring clockwise starting
+// at the primary owner: owners[0] is what Owner would return, owners[1:] are the backups a
+// Forwarder falls back to when the primary is unreachable. Returns fewer than n if the ring has
+// fewer than n distinct peers, and nil if the ring has none.
+func (r *Ring) Owners(key uint64, n int) []string {
+	if len(r.points) == 0 || n <= 0 {
+		return nil
+	}
+
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i].hash >= key })
+	if start == len(r.points) {
+		start = 0
+	}
+
+	owners := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(r.points) && len(owners) < n; i++ {
+		peer := r.points[(start+i)%len(r.points)].peer
+		if seen[peer] {
+			continue
+		}
+		seen[peer] = true
+		owners = append(owners, peer)
+	}
+	return owners
+}
@@ -0,0 +1,46 @@
+// Package codec provides the pluggable body compression used by pkg/model.Data: cached response
+// bodies above a configurable size are transparently encoded with one of these and decoded lazily
+// on read, so weight accounting (and therefore eviction/admission) reflects the stored, compressed
+// footprint rather than the original body size.
+package codec
+
+// Codec encodes/decodes a cached response body.
+type Codec interface {
+	Encode(in []byte) ([]byte, error)
+	Decode(in []byte) ([]byte, error)
+	// Name identifies the codec; stored alongside the encoded body so Decode always uses the codec
+	// that produced it, even if the configured default changes later.
+	Name() string
+	// MinSize is the smallest input worth handing to Encode: below it the framing/header overhead of
+	// this particular codec tends to outweigh whatever it saves, so callers negotiating a variant
+	// (see model.Data.NegotiateVariant) skip straight to the identity encoding instead.
+	MinSize() int64
+}
+
+// None is the identity codec: Set skips compression entirely (body too small, opted out, or
+// content already compressed).
+const None = ""
+
+// New resolves a codec by name as configured in config.Cache.Storage.Compression.Algo (or a rule's
+// override). Unknown names fall back to the identity codec rather than failing the request.
+func New(name string) Codec {
+	switch name {
+	case "gzip":
+		return gzipCodec{}
+	case "zstd":
+		return zstdCodec{}
+	case "s2":
+		return s2Codec{}
+	case "br":
+		return brotliCodec{}
+	default:
+		return noopCodec{}
+	}
+}
+
+type noopCodec struct{}
+
+func (noopCodec) Encode(in []byte) ([]byte, error) { return in, nil }
+func (noopCodec) Decode(in []byte) ([]byte, error) { return in, nil }
+func (noopCodec) Name() string                     { return None }
+func (noopCodec) MinSize() int64                   { return 0 }
@@ -0,0 +1,55 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+var (
+	gzipWriterPool = &sync.Pool{New: func() any {
+		w, err := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+		if err != nil {
+			panic("codec: failed to init gzip writer: " + err.Error())
+		}
+		return w
+	}}
+	gzipBufferPool = &sync.Pool{New: func() any { return new(bytes.Buffer) }}
+)
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+// MinSize: gzip's header/trailer/Huffman-table overhead rarely pays for itself below this.
+func (gzipCodec) MinSize() int64 { return 256 }
+
+func (gzipCodec) Encode(in []byte) ([]byte, error) {
+	w := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(w)
+
+	buf := gzipBufferPool.Get().(*bytes.Buffer)
+	defer gzipBufferPool.Put(buf)
+	buf.Reset()
+
+	w.Reset(buf)
+	if _, err := w.Write(in); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+func (gzipCodec) Decode(in []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(in))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+
+	return io.ReadAll(r)
+}
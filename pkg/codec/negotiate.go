@@ -0,0 +1,71 @@
+package codec
+
+import (
+	"strconv"
+	"strings"
+)
+
+// NegotiateEncoding parses acceptEncoding (an HTTP Accept-Encoding request header, RFC 7231 §5.3.4,
+// q-values included) and returns whichever of candidates it ranks highest. candidates should list
+// the Codec names actually available for this response (e.g. the canonical stored codec plus
+// whatever a rule's Compression.Negotiate allows computing on demand); None (identity) is always an
+// implicit candidate and does not need to be listed.
+//
+// identity is treated as acceptable with an implicit preference just below an explicit, unweighted
+// 1.0: a client sending "gzip, br" with no q-values is assumed to prefer paying for either of those
+// over identity's larger transfer, while a bare "identity" or an empty/unparseable header still
+// resolves to None.
+func NegotiateEncoding(acceptEncoding string, candidates []string) string {
+	if acceptEncoding == "" {
+		return None
+	}
+
+	prefs := parseAcceptEncoding(acceptEncoding)
+
+	best, bestQ := None, qFor(prefs, "identity", 0.999)
+	for _, name := range candidates {
+		if name == None {
+			continue
+		}
+		if q := qFor(prefs, name, 0); q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+func qFor(prefs map[string]float64, token string, fallback float64) float64 {
+	if q, ok := prefs[token]; ok {
+		return q
+	}
+	if q, ok := prefs["*"]; ok {
+		return q
+	}
+	return fallback
+}
+
+func parseAcceptEncoding(header string) map[string]float64 {
+	prefs := make(map[string]float64, strings.Count(header, ",")+1)
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		token, params, hasParams := strings.Cut(part, ";")
+		token = strings.ToLower(strings.TrimSpace(token))
+
+		q := 1.0
+		if hasParams {
+			for _, p := range strings.Split(params, ";") {
+				if v, ok := strings.CutPrefix(strings.TrimSpace(p), "q="); ok {
+					if parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+						q = parsed
+					}
+				}
+			}
+		}
+		prefs[token] = q
+	}
+	return prefs
+}
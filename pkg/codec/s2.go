@@ -0,0 +1,20 @@
+package codec
+
+import "github.com/klauspost/compress/s2"
+
+// s2Codec is S2, the Snappy-compatible, faster successor shipped in the same module — cheaper to
+// encode/decode than zstd at the cost of a worse compression ratio, for latency-sensitive rules.
+type s2Codec struct{}
+
+func (s2Codec) Name() string { return "s2" }
+
+// MinSize: s2's block header overhead is smaller than gzip/zstd's, so it pays off sooner.
+func (s2Codec) MinSize() int64 { return 128 }
+
+func (s2Codec) Encode(in []byte) ([]byte, error) {
+	return s2.Encode(nil, in), nil
+}
+
+func (s2Codec) Decode(in []byte) ([]byte, error) {
+	return s2.Decode(nil, in)
+}
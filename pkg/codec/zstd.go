@@ -0,0 +1,30 @@
+package codec
+
+import "github.com/klauspost/compress/zstd"
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string { return "zstd" }
+
+// MinSize: zstd's frame header makes it a wash below this, similar reasoning to gzipCodec.MinSize.
+func (zstdCodec) MinSize() int64 { return 256 }
+
+func (zstdCodec) Encode(in []byte) ([]byte, error) {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = enc.Close() }()
+
+	return enc.EncodeAll(in, make([]byte, 0, len(in))), nil
+}
+
+func (zstdCodec) Decode(in []byte) ([]byte, error) {
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+
+	return dec.DecodeAll(in, nil)
+}
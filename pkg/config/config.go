@@ -5,6 +5,7 @@ import (
 	"gopkg.in/yaml.v3"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"time"
 )
 
@@ -35,16 +36,121 @@ type Env struct {
 }
 
 type CacheBox struct {
-	Env         string        `yaml:"env"`
-	Enabled     bool          `yaml:"enabled"`
-	LifeTime    Lifetime      `yaml:"lifetime"`
-	Upstream    Upstream      `yaml:"upstream"`
-	Persistence Persistence   `yaml:"persistence"`
-	Preallocate Preallocation `yaml:"preallocate"`
-	Eviction    Eviction      `yaml:"eviction"`
-	Refresh     Refresh       `yaml:"refresh"`
-	Storage     Storage       `yaml:"storage"`
-	Rules       []*Rule       `yaml:"rules"`
+	Env           string        `yaml:"env"`
+	Enabled       bool          `yaml:"enabled"`
+	LifeTime      Lifetime      `yaml:"lifetime"`
+	Upstream      Upstream      `yaml:"upstream"`
+	Persistence   Persistence   `yaml:"persistence"`
+	Preallocate   Preallocation `yaml:"preallocate"`
+	Eviction      Eviction      `yaml:"eviction"`
+	Refresh       Refresh       `yaml:"refresh"`
+	Storage       Storage       `yaml:"storage"`
+	Stream        Stream        `yaml:"stream"`
+	Cluster       Cluster       `yaml:"cluster"`
+	Invalidation  Invalidation  `yaml:"invalidation"`
+	Telemetry     Telemetry     `yaml:"telemetry"`
+	Observability Observability `yaml:"observability"`
+	Purge         Purge         `yaml:"purge"`
+	Logs          Logs          `yaml:"logs"`
+	Rules         []*Rule       `yaml:"rules"`
+}
+
+// Logs configures the module's own logging, independent of the access/error logs Caddy itself emits.
+type Logs struct {
+	Level string `yaml:"level"` // zerolog level name, e.g. "debug", "info", "warn"
+	Stats bool   `yaml:"stats"` // emit periodic hit/miss/eviction counters (see CacheMiddleware.counterCh)
+}
+
+// Invalidation configures pkg/storage/invalidation's Redis Streams-backed cross-instance purge
+// broadcast: a Remove on one node publishes onto Stream, and every other node's consumer (grouped
+// by Group, identified individually by NodeID) applies it locally.
+type Invalidation struct {
+	IsEnabled bool `yaml:"enabled"`
+	// RedisAddr is the Redis instance the stream lives on; it's independent of Cache.Storage.Redis
+	// (invalidation broadcast and the cache backend itself don't have to share a Redis).
+	RedisAddr string `yaml:"redis_addr"`
+	// Stream is the Redis Streams key purge events are XADDed to and XREADGROUP'd from.
+	Stream string `yaml:"stream"`
+	// Group is the consumer-group name every node in the cluster shares, so Redis tracks one
+	// delivery cursor for the whole cluster rather than replaying history to late joiners.
+	Group string `yaml:"group"`
+	// NodeID uniquely identifies this instance within Group (its consumer name, and the tag
+	// stamped on every event it publishes so its own consumer can skip re-applying it).
+	NodeID string `yaml:"node_id"`
+	// MaxLen bounds the stream via XADD MAXLEN ~, trading exact trimming for O(1) amortized cost.
+	MaxLen int64 `yaml:"max_len"`
+	// BlockTimeout is how long one XREADGROUP BLOCK call waits for new entries before looping
+	// (letting it observe ctx cancellation instead of blocking forever).
+	BlockTimeout time.Duration `yaml:"block_timeout"`
+	// ResyncOnStart publishes a bloom filter of this node's locally-held keys right after the
+	// consumer group is joined, so peers can reconcile anything purged while this node was down.
+	ResyncOnStart bool `yaml:"resync_on_start"`
+	// ReclaimIdle is how long a message may sit pending (delivered but never XACKed, e.g. because
+	// the consumer that claimed it crashed) before another node's consumer is allowed to XCLAIM and
+	// retry it. Zero disables reclaim entirely.
+	ReclaimIdle time.Duration `yaml:"reclaim_idle"`
+	// ReclaimInterval is how often the reclaim loop scans the consumer group's pending entries list
+	// via XPENDING. Ignored when ReclaimIdle is zero.
+	ReclaimInterval time.Duration `yaml:"reclaim_interval"`
+	// RefreshSuppressWindow is how long a "refreshed" broadcast (see invalidation.Coordinator.
+	// PublishRefreshed) suppresses this node's own refresher from redoing the same upstream fetch,
+	// since a peer already revalidated that key within the Refresh.Rate budget. Zero disables the
+	// suppression (every node refreshes independently, the historic behavior).
+	RefreshSuppressWindow time.Duration `yaml:"refresh_suppress_window"`
+}
+
+// Telemetry toggles OpenTelemetry tracing (pkg/telemetry) across storage, refresh, and cache-key
+// construction. Disabled by default so the hot path pays nothing beyond a no-op Tracer dispatch.
+type Telemetry struct {
+	TracingEnabled bool `yaml:"tracing_enabled"`
+}
+
+// Observability configures where pkg/telemetry exports the spans Telemetry.TracingEnabled turns on,
+// and where the process's own Prometheus metrics (modules/metrics, or this struct's MetricsAddr) can
+// be scraped from, independent of whatever the user's own Caddyfile routes.
+type Observability struct {
+	// OTLPEndpoint is the OTLP/gRPC collector address (host:port) spans are exported to. Empty
+	// disables export entirely: pkg/telemetry.Configure becomes a no-op and the global TracerProvider
+	// is left untouched, so a Tracer built with Telemetry.TracingEnabled still starts real spans
+	// (useful for local in-process inspection) but nothing leaves the process.
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+	// SampleRate is the fraction (0..1) of traces recorded, via a parent-based trace-ID-ratio
+	// sampler. Zero or unset defaults to 1 (sample everything), since an operator turning tracing on
+	// at all almost always wants to see every trace until they've found a reason to sample down.
+	SampleRate float64 `yaml:"sample_rate"`
+	// MetricsAddr, when set, binds a standalone HTTP server exposing the process's VictoriaMetrics
+	// registry on "/metrics", so a scrape target exists even when the operator's Caddyfile never
+	// routes the modules/metrics handler onto anything. Empty disables it.
+	MetricsAddr string `yaml:"metrics_addr"`
+}
+
+// Purge configures the authenticated POST /cache/purge admin endpoint (see
+// modules/advancedcache.PurgeHandler), which accepts {"tags": [...]}, {"paths": [...]}, or
+// {"keys": [...]} and invalidates every matching entry.
+type Purge struct {
+	// Token is the shared secret a caller must present as "Authorization: Bearer <token>". Empty
+	// (the default) disables the endpoint entirely: PurgeHandler always responds 404, so nobody gets
+	// an unauthenticated purge endpoint by omission.
+	Token string `yaml:"token"`
+	// ID scopes this cache instance's registration so a PurgeHandler with a matching CacheID reaches
+	// it specifically. Caddy provisions CacheMiddleware and PurgeHandler independently, so a process
+	// running more than one CacheMiddleware (several sites in one Caddyfile) needs this to tell them
+	// apart; otherwise the last one to finish provisioning would silently win, possibly handing one
+	// site's purge token authority over another site's cache. Empty (the default) registers under
+	// "default", matching a PurgeHandler that also leaves CacheID unset — fine for the common
+	// single-cache-per-process deployment, but every additional instance sharing a process must set
+	// a distinct ID (and pair it with the same cache_id on its PurgeHandler).
+	ID string `yaml:"id"`
+}
+
+// Cluster configures consistent-hash peer forwarding (pkg/cluster) so that several instances of
+// this module share one logical cache instead of each independently caching every key.
+type Cluster struct {
+	IsEnabled bool `yaml:"enabled"`
+	// Self is this instance's own address, exactly as it appears in Peers.
+	Self string `yaml:"self"`
+	// Peers lists every instance in the cluster, including Self.
+	Peers []string `yaml:"peers"`
 }
 
 type Lifetime struct {
@@ -56,6 +162,26 @@ type Upstream struct {
 	Url     string        `yaml:"url"`     // Reverse Proxy url (can be found in Caddyfile). URL to underlying backend.
 	Rate    int           `yaml:"rate"`    // Rate limiting reqs to backend per second.
 	Timeout time.Duration `yaml:"timeout"` // Timeout for requests to backend.
+	// RateLimit selects the algorithm and burst/shedding behavior of pkg/ratelimit's per-upstream-
+	// host limiter, applied around every fetch in Backend.requestExternalBackend. Rate (above) is
+	// left as the steady-state throughput so existing configs keep working unchanged; Rate == 0
+	// disables limiting entirely, the historic behavior.
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+}
+
+// RateLimitConfig configures pkg/ratelimit. It never carries the steady-state rate itself — that's
+// Upstream.Rate (or a Rule's RateLimit.Rate override) — only how bursts are handled.
+type RateLimitConfig struct {
+	// Algorithm is "token_bucket" (default; replenishes continuously, allows bursts up to Burst)
+	// or "leaky_bucket" (drains a fixed-capacity queue at a constant rate, smoothing bursts rather
+	// than allowing them).
+	Algorithm string `yaml:"algorithm"`
+	// Burst is the token-bucket capacity, or the leaky-bucket queue capacity.
+	Burst int `yaml:"burst"`
+	// ShedOnFull, when true, rejects immediately with ratelimit.ErrUpstreamThrottled instead of
+	// waiting for capacity to free up; the refresher uses this to fall back to serving a stale
+	// cached entry rather than blocking a refresh slot on a saturated limiter.
+	ShedOnFull bool `yaml:"shed_on_full"`
 }
 
 type Dump struct {
@@ -63,10 +189,19 @@ type Dump struct {
 	Format       string `yaml:"format"` // gzip or raw
 	Dir          string `yaml:"dump_dir"`
 	Name         string `yaml:"dump_name"`
-	MaxFiles     int    `yaml:"max_files"`
+	MaxFiles     int    `yaml:"max_files"`     // full snapshots to keep
 	RotatePolicy string `yaml:"rotate_policy"` // fixed or ring
+	// Incremental, when true, makes every Dump cycle after the first a delta (only entries whose
+	// RevalidatedAt is newer than the previous cycle, plus a tombstone log of evictor removals)
+	// instead of rewriting every shard in full.
+	Incremental bool `yaml:"incremental"`
+	MaxDeltas   int  `yaml:"max_deltas"` // delta cycles to keep per full snapshot under RotatePolicy "ring"
 }
 
+// Persistence only offers Dump today. An earlier bbolt-backed tier (requested as a lazy
+// populate-on-miss alternative to Dump's warm-restart snapshots) was added, found never wired
+// into CacheMiddleware and missing that lazy-populate/eviction design, and removed again in the
+// same series rather than merged half-finished; it remains unimplemented, not just reverted.
 type Persistence struct {
 	Dump Dump `yaml:"dump"`
 }
@@ -76,13 +211,137 @@ type Preallocation struct {
 }
 
 type Eviction struct {
-	Policy    string  `yaml:"policy"`    // at now, it's only "lru" + TinyLFU
+	// Policy selects the admission filter consulted before a new entry is allowed to displace the
+	// balancer's chosen victim: "lru" (no filtering, evict whatever the balancer picked), "lfu"/
+	// "tinylfu" (Count-Min Sketch frequency estimate, the default), "w-tinylfu" (tinylfu plus a
+	// small always-admit window for recent arrivals), or "arc"/"s3-fifo" (accepted but not yet
+	// implemented; falls back to "tinylfu"). See pkg/storage/lfu.NewAdmitter.
+	Policy    string  `yaml:"policy"`
 	Threshold float64 `yaml:"threshold"` // 0.9 means 90%
 }
 
 type Storage struct {
-	Type string `yaml:"type"` // "malloc"
-	Size uint   `yaml:"size"` // 21474836480=2gb(bytes)
+	Type        string      `yaml:"type"` // "malloc", "redis", "memcached" or "pebble"
+	Size        uint        `yaml:"size"` // 21474836480=2gb(bytes)
+	Compression Compression `yaml:"compression"`
+	// Redis configures the remote Storage backend used when Type == "redis".
+	Redis RedisStorage `yaml:"redis"`
+	// Memcached configures the remote Storage backend used when Type == "memcached".
+	Memcached MemcachedStorage `yaml:"memcached"`
+	// Pebble configures the on-disk Storage backend used when Type == "pebble".
+	Pebble PebbleStorage `yaml:"pebble"`
+	// Tiers, when non-empty, builds a pkg/storage/tiered.Storage chaining these backends in order
+	// (e.g. malloc L1 -> redis L2) instead of using the single backend named by Type.
+	Tiers []TierConfig `yaml:"tiers"`
+	// Namespace, when non-empty, wraps the configured backend in pkg/storage/namespace, so several
+	// independently configured Caddy sites can share one Redis/Pebble instance without their keys
+	// colliding. Empty (the default) leaves the backend unwrapped.
+	Namespace string `yaml:"namespace"`
+}
+
+// TierConfig describes one level of a pkg/storage/tiered.Storage chain.
+type TierConfig struct {
+	// Type selects the backend for this tier: "malloc", "redis", "memcached" or "pebble".
+	Type string `yaml:"type"`
+	// Async writes this tier in the background instead of blocking Set on it; typically set for
+	// every tier below L1 so a slow remote write-through never adds latency to the request path.
+	Async bool `yaml:"async"`
+	// CircuitBreaker governs when this tier is temporarily skipped after repeated Ping failures.
+	CircuitBreaker CircuitBreaker `yaml:"circuit_breaker"`
+}
+
+// CircuitBreaker configures pkg/storage/tiered's per-tier health tracking.
+type CircuitBreaker struct {
+	// FailureThreshold is the fraction (0, 1] of failed Pings within Window that opens the breaker.
+	// Zero disables circuit breaking for this tier (it's always probed).
+	FailureThreshold float64 `yaml:"failure_threshold"`
+	// Window is the rolling period over which FailureThreshold is evaluated.
+	Window time.Duration `yaml:"window"`
+	// Cooldown is how long the breaker stays open (calls skip straight to the next tier) before
+	// allowing another Ping through to test for recovery.
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// RedisStorage configures pkg/storage/redis.Storage.
+type RedisStorage struct {
+	Addr string `yaml:"addr"`
+	// Namespace prefixes every key this instance writes, so several rule sets (or unrelated
+	// applications) can safely share one Redis without colliding, and GetRandom can restrict its
+	// scan to keys this instance actually owns.
+	Namespace string `yaml:"namespace"`
+}
+
+// MemcachedStorage configures pkg/storage/memcached.Storage.
+type MemcachedStorage struct {
+	Addrs     []string `yaml:"addrs"`
+	Namespace string   `yaml:"namespace"`
+}
+
+// PebbleStorage configures pkg/storage/pebble.Storage.
+type PebbleStorage struct {
+	// Dir is the on-disk directory Pebble keeps its LSM tree in; it must persist across restarts
+	// for Pebble's durability to be worth anything over the in-memory "malloc" backend.
+	Dir string `yaml:"dir"`
+}
+
+// Compression configures the default pkg/codec used to transparently shrink cached response
+// bodies. A Rule may override or opt out of it via Rule.Compression.
+type Compression struct {
+	// Algo selects the codec: "" (disabled), "gzip", "zstd", "s2", or "br".
+	Algo string `yaml:"algo"`
+	// ThresholdBytes: only bodies (uncompressed) strictly larger than this are compressed.
+	ThresholdBytes int64 `yaml:"threshold_bytes"`
+	// ExcludeContentTypes skips compression for Content-Types that are typically already
+	// compressed (e.g. "image/", "video/", "application/zip"), matched by prefix.
+	ExcludeContentTypes []string `yaml:"exclude_content_types"`
+	// Negotiate lists codec names (beyond Algo) that may be computed on demand, the first time a
+	// request's Accept-Encoding asks for one, and cached on the Data for subsequent requests.
+	Negotiate []string `yaml:"negotiate"`
+	// EagerEncodings lists codec names (a subset of Negotiate) to precompute at Set time instead of
+	// waiting for the first matching request, trading extra work at fetch time for a guaranteed hit
+	// on the first request that asks for that encoding.
+	EagerEncodings []string `yaml:"eager_encodings"`
+}
+
+// RuleCompression lets a Rule override or opt out of Cache.Storage.Compression. Unset fields
+// (empty Algo, zero ThresholdBytes) fall back to the global defaults; Disabled always wins.
+type RuleCompression struct {
+	Disabled            bool     `yaml:"disabled"`
+	Algo                string   `yaml:"algo"`
+	ThresholdBytes      int64    `yaml:"threshold_bytes"`
+	ExcludeContentTypes []string `yaml:"exclude_content_types"`
+	// Negotiate lists codec names (beyond Algo) that may be computed on demand; see
+	// Compression.Negotiate.
+	Negotiate []string `yaml:"negotiate"`
+	// EagerEncodings lists codec names to precompute at Set time; see Compression.EagerEncodings.
+	EagerEncodings []string `yaml:"eager_encodings"`
+}
+
+// Tags configures how a Rule extracts the surrogate-key/cache-tag values a response is filed
+// under, the way Fastly/Varnish operators expect: a backend sets a header (or embeds a value in its
+// JSON body) once, and any node in the cluster can later purge every response carrying it in one
+// call instead of waiting for TTL expiry. Both sources are additive; a response gets the union of
+// whatever either finds.
+type Tags struct {
+	// HeaderNames lists response header names to read tags from (commonly "Surrogate-Key" or
+	// "Cache-Tag"). Each header's value is split on commas/spaces, matching the Fastly
+	// Surrogate-Key convention of packing several tags into one header.
+	HeaderNames []string `yaml:"header_names"`
+	// BodyJSONPaths lists dot-separated paths into a JSON response body (e.g. "data.project.id", or
+	// "data.tags.0" for an array element) to pull single tag values from. Only attempted when
+	// Content-Type is JSON-ish; a path that doesn't resolve (missing field, non-JSON body) is
+	// skipped rather than failing the request.
+	BodyJSONPaths []string `yaml:"body_json_paths"`
+}
+
+// Stream configures how upstream response bodies are captured while being streamed to the client.
+type Stream struct {
+	// ChunkSize is parsed but not read by the capture path: every upstream Write is forwarded to
+	// the client (and appended to the cacheable buffer) as-is, whatever this is set to.
+	ChunkSize int `yaml:"chunk_size"`
+	// MaxCacheableBodyBytes is the largest response body (uncompressed) that will still be buffered
+	// for caching. Bodies exceeding it are streamed to the client and never stored in the cache.
+	MaxCacheableBodyBytes int64 `yaml:"max_cacheable_body_bytes"`
 }
 
 type Refresh struct {
@@ -100,6 +359,29 @@ type Refresh struct {
 	// beta: "0.4"
 	Beta     float64       `yaml:"beta"` // between 0 and 1
 	MinStale time.Duration // computed=time.Duration(float64(TTL/ErrorTTL) * Beta)
+	// Jitter adds a random [0, Jitter) offset on top of MinStale for every ShouldBeRefreshed check,
+	// so entries cached at the same time don't all cross their stale threshold in lockstep.
+	Jitter time.Duration `yaml:"jitter"`
+	// QueueHighWaterMark is the refresher's queue-depth/capacity ratio (0 to disable, otherwise a
+	// value in (0, 1]) above which ShouldBeRefreshed downgrades beta, self-throttling how eagerly
+	// entries are offered for refresh instead of piling more work onto an already-backed-up queue.
+	QueueHighWaterMark float64 `yaml:"queue_high_water_mark"`
+
+	// Coordinator elects, across several Caddy instances sharing an origin, at most one refresher
+	// per key, so they don't all independently revalidate the same hot keys simultaneously.
+	Coordinator RefreshCoordination `yaml:"coordinator"`
+}
+
+// RefreshCoordination picks and configures a storage.RefreshCoordinator implementation.
+type RefreshCoordination struct {
+	// Mode selects the coordinator: "" (none, every instance refreshes what it samples), "redis"
+	// (lease-based via SET NX PX) or "peers" (consistent-hash ring ownership, reusing Cache.Cluster).
+	Mode string `yaml:"mode"`
+	// LeaseTTL is how long a node's claim on a key's refresh lasts in "redis" mode. Should comfortably
+	// exceed one refresh round-trip so a slow revalidation isn't raced by another node.
+	LeaseTTL time.Duration `yaml:"lease_ttl"`
+	// RedisAddr is the Redis instance used to hold leases in "redis" mode.
+	RedisAddr string `yaml:"redis_addr"`
 }
 
 type Rule struct {
@@ -111,6 +393,78 @@ type Rule struct {
 	CacheKey   Key           `yaml:"cache_key"`
 	CacheValue Value         `yaml:"cache_value"`
 	MinStale   time.Duration // computed=time.Duration(float64(TTL/ErrorTTL) * Beta)
+	HTTPCache  HTTPCache     `yaml:"http_cache"`
+	// Compression overrides/opts out of Cache.Storage.Compression for this rule.
+	Compression RuleCompression `yaml:"compression"`
+	// RateLimit overrides Cache.Upstream's rate limiter for requests matching this rule, so one
+	// misbehaving rule's traffic can be capped without affecting every other rule sharing the same
+	// upstream host.
+	RateLimit RuleRateLimit `yaml:"rate_limit"`
+	// Eviction overrides Cache.Eviction.Policy for entries matched by this rule, so e.g. one rule
+	// known to churn with little repeat traffic can opt out of TinyLFU admission filtering (policy
+	// "lru") while the rest of the config keeps it. Nil (the default) uses Cache.Eviction.Policy
+	// unchanged. Threshold isn't overridable per rule: eviction is still driven by one shared
+	// Storage.Size budget, not a separate per-rule allowance.
+	Eviction *Eviction `yaml:"eviction"`
+	// Tags declares how to extract surrogate-key/cache-tag values from matching responses, feeding
+	// the tag -> cache-key reverse index a tag-based POST /cache/purge request is served from (see
+	// pkg/storage/lru.Storage.RemoveByPattern and modules/advancedcache.PurgeHandler). Empty (the
+	// default) means responses matched by this rule are never tagged.
+	Tags Tags `yaml:"tags"`
+	// varyHeaders holds the request header names most recently discovered from an origin response's
+	// Vary header (see SetVaryHeaders), not configured directly. It's a derived, runtime-only field
+	// in the same spirit as PathBytes/MinStale above, just computed from traffic instead of at load
+	// time.
+	varyHeaders atomic.Pointer[[][]byte]
+}
+
+// VaryHeaders returns the request header names (already in the []byte form a cache-key header
+// allow-list expects) discovered from the most recent origin response's Vary header for this rule,
+// or nil if HTTPCache is disabled or no response has carried one yet.
+func (r *Rule) VaryHeaders() [][]byte {
+	names := r.varyHeaders.Load()
+	if names == nil {
+		return nil
+	}
+	return *names
+}
+
+// SetVaryHeaders records the request header names a fresh origin response declared via Vary, so
+// the next request matching this rule gets its cache key split on them too (see
+// model.getFilteredAndSortedKeyHeadersFastHttp and friends). This is an eventually-consistent
+// convergence -- the very response that first reveals a Vary header is itself cached under a key
+// that doesn't yet account for it -- rather than RFC 7234's full two-phase secondary-key lookup,
+// which this module's single hash-keyed storage has no room for.
+func (r *Rule) SetVaryHeaders(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	bs := make([][]byte, len(names))
+	for i, name := range names {
+		bs[i] = []byte(name)
+	}
+	r.varyHeaders.Store(&bs)
+}
+
+// RuleRateLimit lets a Rule override Cache.Upstream.Rate/RateLimit. Unset fields (zero Rate, empty
+// Algorithm) fall back to the global Upstream settings, matching RuleCompression's fallback style.
+type RuleRateLimit struct {
+	Rate       int    `yaml:"rate"`
+	Burst      int    `yaml:"burst"`
+	Algorithm  string `yaml:"algorithm"`
+	ShedOnFull bool   `yaml:"shed_on_full"`
+}
+
+// HTTPCache toggles RFC 7234 compliance for a rule. Disabled (the default) keeps the historic
+// behavior of caching purely off config TTLs, ignoring whatever the origin's Cache-Control says.
+type HTTPCache struct {
+	// Enabled turns on parsing of the origin's Cache-Control/Expires/Vary/ETag and lets it
+	// override the rule's TTL/ErrorTTL.
+	Enabled bool `yaml:"enabled"`
+	// Strict additionally honors "private" as non-cacheable, matching a shared-cache reading of
+	// RFC 7234. Permissive mode (the default when Enabled) caches private responses anyway, since
+	// this module has no notion of per-user cache partitions.
+	Strict bool `yaml:"strict"`
 }
 
 type Key struct {
@@ -150,21 +504,49 @@ func LoadConfig(path string) (*Cache, error) {
 		return nil, fmt.Errorf("unmarshal yaml from %s: %w", path, err)
 	}
 
+	Normalize(cfg)
+
+	return cfg, nil
+}
+
+// Normalize fills in every field that's computed rather than configured directly: the byte-slice
+// mirrors of string-keyed fields used on cache-key/value hot paths, each Rule's Compression
+// fallback onto Cache.Storage.Compression, and the MinStale derived from TTL/Beta. It must be run
+// once over a *Cache built any way other than LoadConfig (e.g. advancedcache's Caddyfile-sourced
+// config, see MergeInline) so both paths validate identically.
+func Normalize(cfg *Cache) {
 	for k, rule := range cfg.Cache.Rules {
 		cfg.Cache.Rules[k].PathBytes = []byte(rule.Path)
+		cfg.Cache.Rules[k].CacheKey.QueryBytes = nil
 		for _, param := range rule.CacheKey.Query {
 			cfg.Cache.Rules[k].CacheKey.QueryBytes = append(cfg.Cache.Rules[k].CacheKey.QueryBytes, []byte(param))
 		}
+		cfg.Cache.Rules[k].CacheKey.HeadersBytes = nil
 		for _, param := range rule.CacheKey.Headers {
 			cfg.Cache.Rules[k].CacheKey.HeadersBytes = append(cfg.Cache.Rules[k].CacheKey.HeadersBytes, []byte(param))
 		}
+		cfg.Cache.Rules[k].CacheValue.HeadersBytes = nil
 		for _, param := range rule.CacheValue.Headers {
 			cfg.Cache.Rules[k].CacheValue.HeadersBytes = append(cfg.Cache.Rules[k].CacheValue.HeadersBytes, []byte(param))
 		}
 		cfg.Cache.Rules[k].MinStale = time.Duration(float64(rule.TTL) * rule.Beta)
+
+		if rule.Compression.Algo == "" {
+			cfg.Cache.Rules[k].Compression.Algo = cfg.Cache.Storage.Compression.Algo
+		}
+		if rule.Compression.ThresholdBytes == 0 {
+			cfg.Cache.Rules[k].Compression.ThresholdBytes = cfg.Cache.Storage.Compression.ThresholdBytes
+		}
+		if len(rule.Compression.ExcludeContentTypes) == 0 {
+			cfg.Cache.Rules[k].Compression.ExcludeContentTypes = cfg.Cache.Storage.Compression.ExcludeContentTypes
+		}
+		if len(rule.Compression.Negotiate) == 0 {
+			cfg.Cache.Rules[k].Compression.Negotiate = cfg.Cache.Storage.Compression.Negotiate
+		}
+		if len(rule.Compression.EagerEncodings) == 0 {
+			cfg.Cache.Rules[k].Compression.EagerEncodings = cfg.Cache.Storage.Compression.EagerEncodings
+		}
 	}
 
 	cfg.Cache.Refresh.MinStale = time.Duration(float64(cfg.Cache.Refresh.TTL) * cfg.Cache.Refresh.Beta)
-
-	return cfg, nil
 }
@@ -0,0 +1,99 @@
+package config
+
+// MergeInline overlays the fields an operator actually set in an inline Caddyfile block (overlay)
+// onto a *Cache loaded from config_path (base, may be a zero-value &Cache{} if config_path was
+// omitted entirely). It implements the override semantics advancedcache's Caddyfile integration
+// documents: inline values win field-by-field, and any field the Caddyfile block didn't mention
+// (left at its zero value on overlay) falls back to whatever base already had -- the same
+// leave-unset-fields-alone convention Rule.Compression already uses against Storage.Compression.
+// Inline rule blocks are merged by Path: one whose Path matches an existing base rule replaces it
+// in place, so a site can override a single shared rule without repeating the rest of the YAML
+// registry; any other Path is appended. Normalize must still be run on the result.
+func MergeInline(base, overlay *Cache) *Cache {
+	if overlay == nil {
+		return base
+	}
+
+	if overlay.Cache.Env != "" {
+		base.Cache.Env = overlay.Cache.Env
+	}
+
+	mergeUpstream(&base.Cache.Upstream, overlay.Cache.Upstream)
+	mergeEviction(&base.Cache.Eviction, overlay.Cache.Eviction)
+	mergeRefresh(&base.Cache.Refresh, overlay.Cache.Refresh)
+	mergeStorage(&base.Cache.Storage, overlay.Cache.Storage)
+	mergeLogs(&base.Cache.Logs, overlay.Cache.Logs)
+
+	base.Cache.Rules = mergeRules(base.Cache.Rules, overlay.Cache.Rules)
+
+	return base
+}
+
+func mergeUpstream(base *Upstream, overlay Upstream) {
+	if overlay.Url != "" {
+		base.Url = overlay.Url
+	}
+	if overlay.Rate != 0 {
+		base.Rate = overlay.Rate
+	}
+	if overlay.Timeout != 0 {
+		base.Timeout = overlay.Timeout
+	}
+}
+
+func mergeEviction(base *Eviction, overlay Eviction) {
+	if overlay.Policy != "" {
+		base.Policy = overlay.Policy
+	}
+	if overlay.Threshold != 0 {
+		base.Threshold = overlay.Threshold
+	}
+}
+
+func mergeRefresh(base *Refresh, overlay Refresh) {
+	if overlay.TTL != 0 {
+		base.TTL = overlay.TTL
+	}
+	if overlay.ErrorTTL != 0 {
+		base.ErrorTTL = overlay.ErrorTTL
+	}
+	if overlay.Beta != 0 {
+		base.Beta = overlay.Beta
+	}
+	// MinStale is always recomputed by Normalize from TTL/Beta, so there's nothing to merge here.
+}
+
+func mergeStorage(base *Storage, overlay Storage) {
+	if overlay.Type != "" {
+		base.Type = overlay.Type
+	}
+	if overlay.Size != 0 {
+		base.Size = overlay.Size
+	}
+}
+
+func mergeLogs(base *Logs, overlay Logs) {
+	if overlay.Level != "" {
+		base.Level = overlay.Level
+	}
+	if overlay.Stats {
+		base.Stats = overlay.Stats
+	}
+}
+
+func mergeRules(base, overlay []*Rule) []*Rule {
+	for _, rule := range overlay {
+		replaced := false
+		for i, existing := range base {
+			if existing.Path == rule.Path {
+				base[i] = rule
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			base = append(base, rule)
+		}
+	}
+	return base
+}
@@ -0,0 +1,119 @@
+// Package httpcache parses RFC 7234 caching directives (Cache-Control, Vary, conditional
+// validators) from requests and origin responses so the storage layer can make freshness
+// and variant decisions instead of relying solely on the static per-rule config.
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestDirectives holds the Cache-Control directives a client sent on the request.
+type RequestDirectives struct {
+	NoCache      bool
+	NoStore      bool
+	OnlyIfCached bool
+	MaxAge       time.Duration
+	HasMaxAge    bool
+	MinFresh     time.Duration
+	HasMinFresh  bool
+}
+
+// ResponseDirectives holds the Cache-Control directives the origin sent on the response.
+type ResponseDirectives struct {
+	NoStore                 bool
+	Private                 bool
+	MustRevalidate          bool
+	MaxAge                  time.Duration
+	HasMaxAge               bool
+	SMaxAge                 time.Duration
+	HasSMaxAge              bool
+	StaleWhileRevalidate    time.Duration
+	HasStaleWhileRevalidate bool
+	StaleIfError            time.Duration
+	HasStaleIfError         bool
+}
+
+// ParseRequest extracts caching directives from a request's Cache-Control header.
+func ParseRequest(h http.Header) RequestDirectives {
+	var d RequestDirectives
+	for _, tok := range splitDirectives(h.Get("Cache-Control")) {
+		name, val, _ := strings.Cut(tok, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		val = strings.Trim(strings.TrimSpace(val), `"`)
+		switch name {
+		case "no-cache":
+			d.NoCache = true
+		case "no-store":
+			d.NoStore = true
+		case "only-if-cached":
+			d.OnlyIfCached = true
+		case "max-age":
+			if secs, err := strconv.Atoi(val); err == nil {
+				d.MaxAge = time.Duration(secs) * time.Second
+				d.HasMaxAge = true
+			}
+		case "min-fresh":
+			if secs, err := strconv.Atoi(val); err == nil {
+				d.MinFresh = time.Duration(secs) * time.Second
+				d.HasMinFresh = true
+			}
+		}
+	}
+	return d
+}
+
+// ParseResponse extracts caching directives from an origin response's Cache-Control header.
+func ParseResponse(h http.Header) ResponseDirectives {
+	var d ResponseDirectives
+	for _, tok := range splitDirectives(h.Get("Cache-Control")) {
+		name, val, _ := strings.Cut(tok, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		val = strings.Trim(strings.TrimSpace(val), `"`)
+		switch name {
+		case "no-store":
+			d.NoStore = true
+		case "private":
+			d.Private = true
+		case "must-revalidate":
+			d.MustRevalidate = true
+		case "max-age":
+			if secs, err := strconv.Atoi(val); err == nil {
+				d.MaxAge = time.Duration(secs) * time.Second
+				d.HasMaxAge = true
+			}
+		case "s-maxage":
+			if secs, err := strconv.Atoi(val); err == nil {
+				d.SMaxAge = time.Duration(secs) * time.Second
+				d.HasSMaxAge = true
+			}
+		case "stale-while-revalidate":
+			if secs, err := strconv.Atoi(val); err == nil {
+				d.StaleWhileRevalidate = time.Duration(secs) * time.Second
+				d.HasStaleWhileRevalidate = true
+			}
+		case "stale-if-error":
+			if secs, err := strconv.Atoi(val); err == nil {
+				d.StaleIfError = time.Duration(secs) * time.Second
+				d.HasStaleIfError = true
+			}
+		}
+	}
+	return d
+}
+
+func splitDirectives(header string) []string {
+	if header == "" {
+		return nil
+	}
+	parts := strings.Split(header, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package httpcache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseResponse(t *testing.T) {
+	h := http.Header{}
+	h.Set("Cache-Control", "private, max-age=60, stale-while-revalidate=30")
+
+	d := ParseResponse(h)
+
+	if !d.Private {
+		t.Fatal("expected Private to be true")
+	}
+	if !d.HasMaxAge || d.MaxAge != 60*time.Second {
+		t.Fatalf("expected max-age=60s, got %v (has=%v)", d.MaxAge, d.HasMaxAge)
+	}
+	if !d.HasStaleWhileRevalidate || d.StaleWhileRevalidate != 30*time.Second {
+		t.Fatalf("expected stale-while-revalidate=30s, got %v (has=%v)", d.StaleWhileRevalidate, d.HasStaleWhileRevalidate)
+	}
+}
+
+func TestIsStorable(t *testing.T) {
+	cases := []struct {
+		name   string
+		resp   ResponseDirectives
+		strict bool
+		wantOK bool
+	}{
+		{"no-store always rejected", ResponseDirectives{NoStore: true}, false, false},
+		{"private allowed when permissive", ResponseDirectives{Private: true}, false, true},
+		{"private rejected when strict", ResponseDirectives{Private: true}, true, false},
+		{"plain response storable", ResponseDirectives{}, true, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsStorable(tc.resp, tc.strict); got != tc.wantOK {
+				t.Fatalf("IsStorable() = %v, want %v", got, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestVaryHeaderNames(t *testing.T) {
+	h := http.Header{}
+	h.Add("Vary", "Accept-Encoding, Accept-Language")
+	h.Add("Vary", "X-Custom")
+
+	names := VaryHeaderNames(h)
+	want := map[string]bool{"accept-encoding": true, "accept-language": true, "x-custom": true}
+
+	if len(names) != len(want) {
+		t.Fatalf("expected %d names, got %d (%v)", len(want), len(names), names)
+	}
+	for _, n := range names {
+		if !want[n] {
+			t.Fatalf("unexpected header name %q", n)
+		}
+	}
+}
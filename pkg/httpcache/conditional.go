@@ -0,0 +1,19 @@
+package httpcache
+
+import "net/http"
+
+// ApplyValidators copies the origin's ETag/Last-Modified onto a conditional GET request so a
+// refresh can be answered with 304 Not Modified instead of re-transferring the body.
+func ApplyValidators(req *http.Request, cached http.Header) {
+	if etag := cached.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := cached.Get("Last-Modified"); lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+}
+
+// IsNotModified reports whether a revalidation response means the cached entry is still fresh.
+func IsNotModified(statusCode int) bool {
+	return statusCode == http.StatusNotModified
+}
@@ -0,0 +1,56 @@
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TTL derives the freshness lifetime for a response, preferring the origin's explicit signals
+// (s-maxage, then max-age, then Expires) over the configured default TTL. ok is false when the
+// response carries no freshness directive and the caller should fall back to its own default.
+func TTL(resp ResponseDirectives, headers http.Header, now time.Time) (ttl time.Duration, ok bool) {
+	switch {
+	case resp.HasSMaxAge:
+		return resp.SMaxAge, true
+	case resp.HasMaxAge:
+		return resp.MaxAge, true
+	}
+
+	if expires := headers.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil {
+			if d := t.Sub(now); d > 0 {
+				return d, true
+			}
+			return 0, true
+		}
+	}
+
+	return 0, false
+}
+
+// Age parses the response's Age header (seconds the origin/shared cache has already held it).
+func Age(headers http.Header) time.Duration {
+	v := headers.Get("Age")
+	if v == "" {
+		return 0
+	}
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// IsStorable reports whether a response is allowed to be cached at all under RFC 7234,
+// independent of freshness. strict mirrors config.Rule's HTTP-caching mode: in strict mode
+// "private" responses are rejected too (this module only ever serves a single shared cache).
+func IsStorable(resp ResponseDirectives, strict bool) bool {
+	if resp.NoStore {
+		return false
+	}
+	if strict && resp.Private {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package httpcache
+
+import (
+	"net/http"
+	"strings"
+)
+
+// VaryHeaderNames returns the request header names listed in the response's Vary header,
+// normalized and deduplicated. A bare "*" means the response varies on everything and is
+// reported back verbatim so callers can refuse to store such entries.
+func VaryHeaderNames(headers http.Header) []string {
+	raw := headers.Values("Vary")
+	if len(raw) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]struct{}, len(raw))
+	names := make([]string, 0, len(raw))
+	for _, line := range raw {
+		for _, name := range strings.Split(line, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// VariesOnEverything reports whether the response declared `Vary: *`, meaning it can never be
+// safely served from cache to a different request.
+func VariesOnEverything(names []string) bool {
+	for _, n := range names {
+		if n == "*" {
+			return true
+		}
+	}
+	return false
+}
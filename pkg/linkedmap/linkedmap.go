@@ -0,0 +1,184 @@
+// Package linkedmap provides a generic, thread-safe ordered map: O(1) key lookup via an index plus
+// O(1) reordering/iteration via the doubly linked list from pkg/list. It exists so callers that used
+// to hand-maintain a map alongside a parallel list (keeping both in sync on every insert/remove/touch
+// themselves) can collapse that bookkeeping into a single structure.
+package linkedmap
+
+import (
+	"sync"
+
+	"github.com/caddyserver/caddy/v2/pkg/list"
+	"github.com/caddyserver/caddy/v2/pkg/types"
+)
+
+// Map is an insertion/access-ordered map from K to V. Put always moves a key to the front, so
+// walking front-to-back visits the most recently touched keys first and Oldest() (the back of the
+// order) is the natural eviction candidate for an LRU policy.
+type Map[K comparable, V types.Sized] struct {
+	mu    sync.RWMutex
+	index map[K]*list.Element[V]
+	keys  map[*list.Element[V]]K // reverse lookup, so Walk can report each element's key
+	order *list.List[V]
+	mem   int64
+}
+
+// New creates an empty Map with defaultLen preallocated for the index.
+func New[K comparable, V types.Sized](defaultLen int) *Map[K, V] {
+	return &Map[K, V]{
+		index: make(map[K]*list.Element[V], defaultLen),
+		keys:  make(map[*list.Element[V]]K, defaultLen),
+		order: list.New[V](),
+	}
+}
+
+// Len returns the number of keys currently stored.
+func (m *Map[K, V]) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.index)
+}
+
+// Weight returns the summed Weight of every value currently stored, so a Map satisfies
+// types.Sized and can itself be held in another Weight-ordered structure (e.g. lru.Balance.memList,
+// which orders shards by memory usage).
+func (m *Map[K, V]) Weight() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.mem
+}
+
+// Get returns the value at key without changing its position in the order.
+func (m *Map[K, V]) Get(key K) (value V, found bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	el, ok := m.index[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return el.Value(), true
+}
+
+// Put inserts value at key and moves it to the front of the order. If key already held a value,
+// that value is replaced and its Weight is subtracted before value's is added.
+func (m *Map[K, V]) Put(key K, value V) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.index[key]; ok {
+		m.mem -= el.Value().Weight()
+		delete(m.keys, el)
+		m.order.Remove(el)
+	}
+
+	el := m.order.PushFront(value)
+	m.index[key] = el
+	m.keys[el] = key
+	m.mem += value.Weight()
+}
+
+// Delete removes key, returning its value (or the zero value) and whether it was present.
+func (m *Map[K, V]) Delete(key K) (value V, found bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.index[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	value = m.order.Remove(el)
+	delete(m.index, key)
+	delete(m.keys, el)
+	m.mem -= value.Weight()
+	return value, true
+}
+
+// MoveToFront marks key as the most recently touched entry. Reports false if key isn't held.
+func (m *Map[K, V]) MoveToFront(key K) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.index[key]
+	if !ok {
+		return false
+	}
+	m.order.MoveToFront(el)
+	return true
+}
+
+// MoveToBack marks key as the least recently touched entry -- the first candidate an LRU-style
+// victim search should consider. Reports false if key isn't held. pkg/list has no native
+// move-to-back primitive, so this re-homes the value via Remove+PushBack, which reassigns its
+// *list.Element[V] -- index/keys are updated in lockstep so callers never observe a stale pointer.
+func (m *Map[K, V]) MoveToBack(key K) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.index[key]
+	if !ok {
+		return false
+	}
+
+	value := m.order.Remove(el)
+	delete(m.keys, el)
+
+	newEl := m.order.PushBack(value)
+	m.index[key] = newEl
+	m.keys[newEl] = key
+	return true
+}
+
+// Newest returns the most recently touched value (the front of the order).
+func (m *Map[K, V]) Newest() (value V, found bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	el, ok := m.order.Next(0)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return el.Value(), true
+}
+
+// Oldest returns the least recently touched value (the back of the order).
+func (m *Map[K, V]) Oldest() (value V, found bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	el := m.order.Back()
+	if el == nil {
+		var zero V
+		return zero, false
+	}
+	return el.Value(), true
+}
+
+// Walk visits every (key, value) pair front-to-back (newest-touched first) until fn returns false
+// or every entry has been visited.
+func (m *Map[K, V]) Walk(fn func(key K, value V) bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	m.order.Walk(list.FromFront, func(_ *list.List[V], el *list.Element[V]) bool {
+		return fn(m.keys[el], el.Value())
+	})
+}
+
+// Next returns the value at the given offset from the front of the order (0-based). Used by
+// background eviction/evacuation sampling to step through a shard's order by offset without
+// snapshotting or locking it for the whole walk.
+func (m *Map[K, V]) Next(offset int) (value V, found bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	el, ok := m.order.Next(offset)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return el.Value(), true
+}
@@ -69,13 +69,17 @@ func GenerateRandomResponses(cfg *config.Cache, path []byte, num int) []*model.R
 
 	list := make([]*model.Response, 0, num)
 	for _, req := range GenerateRandomRequests(cfg, path, num) {
-		data := model.NewData(cfg, path, http.StatusOK, headers, []byte(GenerateRandomString()))
+		data := model.NewData(req.Rule(), http.StatusOK, headers, []byte(GenerateRandomString()))
 		resp, err := model.NewResponse(
 			data, req, cfg,
 			func(ctx context.Context) (*model.Data, error) {
 				// Dummy revalidator; always returns the same data.
 				return data, nil
 			},
+			func(ctx context.Context, etag, lastModified string) (bool, *model.Data, error) {
+				// Dummy conditional revalidator; always reports unchanged.
+				return true, nil, nil
+			},
 		)
 		if err != nil {
 			panic(err)
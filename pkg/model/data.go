@@ -2,10 +2,19 @@ package model
 
 import (
 	"bytes"
-	"compress/gzip"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/caddyserver/caddy/v2/pkg/codec"
 	"github.com/caddyserver/caddy/v2/pkg/config"
+	"github.com/caddyserver/caddy/v2/pkg/httpcache"
+	"github.com/caddyserver/caddy/v2/pkg/prometheus/metrics/keyword"
 	"net/http"
-	"unsafe"
 )
 
 // Data is the actual payload (status, h, body) stored in the cache.
@@ -13,53 +22,197 @@ type Data struct {
 	statusCode int
 	headers    http.Header
 	body       []byte
+	// codec names whichever pkg/codec.Codec encoded body, so Decode always matches Encode even if
+	// the rule's configured algorithm changes later. codec.None means body is stored as-is.
+	codec string
+	// etag and lastModified are captured from the origin response (before header filtering, since
+	// rules commonly don't whitelist them for the cache key) so a later refresh can issue a
+	// conditional GET instead of always re-fetching the full body.
+	etag         string
+	lastModified string
+	// httpCacheTTL/hasHTTPCacheTTL, vary, staleWhileRevalidate/hasStaleWhileRevalidate and
+	// staleIfError/hasStaleIfError are populated from the origin's Cache-Control/Expires/Vary only
+	// when the matching Rule has HTTPCache.Enabled (see NewData); otherwise they're left zero and
+	// callers fall back to the rule's static config, matching HTTPCache's documented default of
+	// "ignore whatever the origin's Cache-Control says".
+	httpCacheTTL            time.Duration
+	hasHTTPCacheTTL         bool
+	vary                    []string
+	staleWhileRevalidate    time.Duration
+	hasStaleWhileRevalidate bool
+	staleIfError            time.Duration
+	hasStaleIfError         bool
+	// variants caches bodies re-encoded for codecs other than codec, keyed by codec.Codec.Name(),
+	// computed either eagerly in setUpBody (rule.Compression.EagerEncodings) or lazily the first
+	// time NegotiateVariant is asked for an encoding not yet in the map. Guarded by atomic.Pointer
+	// (copy-on-write) rather than a mutex since reads vastly outnumber the one-time writes.
+	variants atomic.Pointer[map[string][]byte]
+	// variantsWeight is the running total of bytes retained across variants, added into Weight so
+	// eviction/admission accounting reflects every encoding kept for this Data, not just body.
+	variantsWeight int64
+	// tags are the surrogate-key/cache-tag values rule.Tags extracted (see setUpTags), feeding the
+	// tag -> cache-key reverse index a tag-based purge is served from. nil when the rule declares no
+	// Tags or none of them matched.
+	tags []string
 }
 
-// NewData creates a new Data object, compressing body with compress if large enough.
-// Uses memory pools for buffer and writer to minimize allocations.
+// NewData creates a new Data object, compressing body via rule.Compression if it's large enough
+// and not opted out.
 func NewData(rule *config.Rule, statusCode int, headers http.Header, body []byte) *Data {
-	return (&Data{headers: headers, statusCode: statusCode}).
+	d := &Data{
+		headers:      headers,
+		statusCode:   statusCode,
+		etag:         headers.Get("ETag"),
+		lastModified: headers.Get("Last-Modified"),
+	}
+	if rule.HTTPCache.Enabled {
+		d.setUpHTTPCache(rule, headers)
+	}
+	// setUpTags must run before filterHeadersInPlace strips whatever header it reads tags from, the
+	// same reason etag/lastModified above are captured ahead of it rather than via Headers() later.
+	d.setUpTags(rule, headers, body)
+	return d.
 		filterHeadersInPlace(rule.CacheValue.HeadersBytes).
-		setUpBody(body)
+		setUpBody(rule, body, headers.Get("Content-Type")).
+		setUpEagerVariants(rule)
 }
 
-func (d *Data) setUpBody(body []byte) *Data {
-	// Compress body if it shard large enough for compress to help
-	if d.isNeedCompression() {
-		d.compress()
-	} else {
-		d.body = body
+// setUpTags extracts the surrogate-key/cache-tag values rule.Tags declares (see config.Tags) from
+// headers and, for a JSON body, the configured BodyJSONPaths. A rule with no Tags configured, or a
+// body that isn't JSON, simply leaves d.tags nil.
+func (d *Data) setUpTags(rule *config.Rule, headers http.Header, body []byte) *Data {
+	var tags []string
+	for _, name := range rule.Tags.HeaderNames {
+		for _, raw := range headers.Values(name) {
+			tags = append(tags, splitTagValues(raw)...)
+		}
 	}
+	if len(rule.Tags.BodyJSONPaths) > 0 && looksLikeJSON(body) {
+		var parsed any
+		if err := json.Unmarshal(body, &parsed); err == nil {
+			for _, path := range rule.Tags.BodyJSONPaths {
+				if tag, ok := jsonPathString(parsed, path); ok {
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+	d.tags = tags
 	return d
 }
 
-func (d *Data) isNeedCompression() bool {
-	return len(d.body) > gzipThreshold
+// splitTagValues splits one header's raw value into individual tags, matching the Fastly
+// Surrogate-Key convention of packing several space/comma-separated tags into a single header.
+func splitTagValues(raw string) []string {
+	return strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
 }
 
-// compress is checks whether the item weight is more than threshold
-// if so, then body compresses by compress and will add an appropriate Content-Encoding HTTP header.
-func (d *Data) compress() {
-	gzipper := GzipWriterPool.Get().(*gzip.Writer)
-	defer GzipWriterPool.Put(gzipper)
+func looksLikeJSON(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
 
-	buf := GzipBufferPool.Get().(*bytes.Buffer)
-	defer GzipBufferPool.Put(buf)
+// jsonPathString resolves a dot-separated path (e.g. "data.project.id", or "data.tags.0" for an
+// array element) against an encoding/json-decoded value. It covers the common subset a tag payload
+// actually needs rather than full JSONPath syntax; an unresolved path returns ok=false.
+func jsonPathString(v any, path string) (tag string, ok bool) {
+	cur := v
+	for _, segment := range strings.Split(path, ".") {
+		switch node := cur.(type) {
+		case map[string]any:
+			next, found := node[segment]
+			if !found {
+				return "", false
+			}
+			cur = next
+		case []any:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return "", false
+			}
+			cur = node[idx]
+		default:
+			return "", false
+		}
+	}
+	switch final := cur.(type) {
+	case string:
+		return final, true
+	case float64:
+		return strconv.FormatFloat(final, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
 
-	gzipper.Reset(buf)
-	buf.Reset()
+// setUpHTTPCache parses the origin's Cache-Control/Expires/Vary (via pkg/httpcache) before
+// filterHeadersInPlace can strip them, and records the derived freshness override, stale windows
+// and Vary header names onto d. It also feeds the discovered Vary header names back onto rule (see
+// config.Rule.SetVaryHeaders) so the next request matching this rule starts splitting its cache key
+// on them too -- an eventually-consistent convergence rather than RFC 7234's full two-phase
+// secondary-key lookup, which this module's single hash-keyed storage has no room for.
+func (d *Data) setUpHTTPCache(rule *config.Rule, headers http.Header) {
+	directives := httpcache.ParseResponse(headers)
+	d.httpCacheTTL, d.hasHTTPCacheTTL = httpcache.TTL(directives, headers, time.Now())
+	d.staleWhileRevalidate, d.hasStaleWhileRevalidate = directives.StaleWhileRevalidate, directives.HasStaleWhileRevalidate
+	d.staleIfError, d.hasStaleIfError = directives.StaleIfError, directives.HasStaleIfError
+	d.vary = httpcache.VaryHeaderNames(headers)
+	rule.SetVaryHeaders(d.vary)
+}
 
-	_, err := gzipper.Write(d.body)
-	if err == nil && gzipper.Close() == nil {
-		d.headers["Content-Encoding"] = append(d.headers["Content-Encoding"], "compress")
-		d.body = append([]byte{}, buf.Bytes()...)
-	} else {
-		d.body = append([]byte{}, d.body...)
+// setUpEagerVariants precomputes a variant for every codec listed in rule.Compression.EagerEncodings,
+// trading extra work here (Set is off the request's hot path already) for a guaranteed cache hit on
+// the first request that negotiates one of these encodings. Lazy negotiation via NegotiateVariant
+// still covers any encoding listed in Negotiate but left out of EagerEncodings.
+func (d *Data) setUpEagerVariants(rule *config.Rule) *Data {
+	for _, name := range rule.Compression.EagerEncodings {
+		d.negotiateVariant(name)
 	}
+	return d
+}
+
+func (d *Data) setUpBody(rule *config.Rule, body []byte, contentType string) *Data {
+	if !d.isNeedCompression(rule, body, contentType) {
+		d.body = body
+		d.codec = codec.None
+		return d
+	}
+
+	c := codec.New(rule.Compression.Algo)
+	start := time.Now()
+	encoded, err := c.Encode(body)
+	if err != nil {
+		d.body = body
+		d.codec = codec.None
+		return d
+	}
+	recordCompression(c.Name(), len(body), len(encoded), time.Since(start))
+
+	d.headers["Content-Encoding"] = append(d.headers["Content-Encoding"], c.Name())
+	d.body = encoded
+	d.codec = c.Name()
+	return d
+}
+
+func (d *Data) isNeedCompression(rule *config.Rule, body []byte, contentType string) bool {
+	if rule.Compression.Disabled || rule.Compression.Algo == "" {
+		return false
+	}
+	if int64(len(body)) <= rule.Compression.ThresholdBytes {
+		return false
+	}
+	for _, excluded := range rule.Compression.ExcludeContentTypes {
+		if excluded != "" && strings.HasPrefix(contentType, excluded) {
+			return false
+		}
+	}
+	return true
 }
 
 func (d *Data) Weight() int64 {
-	return int64(unsafe.Sizeof(*d)) + int64(len(d.body))
+	return int64(unsafe.Sizeof(*d)) + int64(len(d.body)) + atomic.LoadInt64(&d.variantsWeight)
 }
 
 // Headers returns the response h.
@@ -68,9 +221,178 @@ func (d *Data) Headers() http.Header { return d.headers }
 // StatusCode returns the HTTP status code.
 func (d *Data) StatusCode() int { return d.statusCode }
 
-// Body returns the response body (possibly compress-compressed).
+// Body returns the response body exactly as stored, i.e. still encoded with Codec() if that isn't
+// codec.None. Use DecodedBody to get the original bytes back.
 func (d *Data) Body() []byte { return d.body }
 
+// Codec returns the name of the pkg/codec.Codec that encoded Body, or codec.None if it wasn't
+// compressed.
+func (d *Data) Codec() string { return d.codec }
+
+// ETag returns the origin's ETag h value captured when this Data was fetched, or "" if the origin
+// didn't send one.
+func (d *Data) ETag() string { return d.etag }
+
+// LastModified returns the origin's Last-Modified h value captured when this Data was fetched, or
+// "" if the origin didn't send one.
+func (d *Data) LastModified() string { return d.lastModified }
+
+// EffectiveTTL returns the freshness lifetime derived from the origin's Cache-Control/Expires (see
+// httpcache.TTL), and whether one was found at all. ok is always false unless the matching Rule had
+// HTTPCache.Enabled and the origin actually sent a usable freshness signal; callers fall back to
+// the rule's configured TTL otherwise.
+func (d *Data) EffectiveTTL() (ttl time.Duration, ok bool) { return d.httpCacheTTL, d.hasHTTPCacheTTL }
+
+// StaleWhileRevalidate returns the origin's stale-while-revalidate window (RFC 5861) and whether it
+// sent one.
+func (d *Data) StaleWhileRevalidate() (time.Duration, bool) {
+	return d.staleWhileRevalidate, d.hasStaleWhileRevalidate
+}
+
+// StaleIfError returns the origin's stale-if-error tolerance window (RFC 5861) and whether it sent
+// one.
+func (d *Data) StaleIfError() (time.Duration, bool) { return d.staleIfError, d.hasStaleIfError }
+
+// Vary returns the request header names this response declared via Vary (lowercased,
+// deduplicated), or nil if the origin didn't send one.
+func (d *Data) Vary() []string { return d.vary }
+
+// Tags returns the surrogate-key/cache-tag values rule.Tags extracted for this response (see
+// setUpTags), or nil if the matching rule declares no Tags or none of them matched.
+func (d *Data) Tags() []string { return d.tags }
+
+// DecodedBody returns the original, uncompressed body, decoding lazily when Codec() isn't
+// codec.None. The decoded bytes belong solely to the caller (never stored back onto Data), so the
+// cached Data.body stays compressed and memory/weight accounting keeps reflecting its true,
+// stored footprint.
+func (d *Data) DecodedBody() ([]byte, error) {
+	if d.codec == codec.None {
+		return d.body, nil
+	}
+	return codec.New(d.codec).Decode(d.body)
+}
+
+// NegotiateVariant returns the body encoded for name (a pkg/codec.Codec name from an Accept-Encoding
+// negotiation), the codec that actually produced it, and how many bytes this call newly retained on
+// Data (0 if name matched the stored codec, fell back to the decoded body, or some earlier call
+// already cached it). Callers that track a owning Response's Weight use added to keep it in sync;
+// see Response.NegotiateVariant.
+func (d *Data) NegotiateVariant(rule *config.Rule, name string) (body []byte, usedCodec string, added int64, err error) {
+	if name == codec.None {
+		body, err = d.DecodedBody()
+		return body, codec.None, 0, err
+	}
+	if name == d.codec {
+		return d.body, d.codec, 0, nil
+	}
+	if !negotiable(rule, name) {
+		body, err = d.DecodedBody()
+		return body, codec.None, 0, err
+	}
+	if variants := d.variants.Load(); variants != nil {
+		if cached, ok := (*variants)[name]; ok {
+			return cached, name, 0, nil
+		}
+	}
+	if decoded, decErr := d.DecodedBody(); decErr != nil {
+		return nil, codec.None, 0, decErr
+	} else if int64(len(decoded)) < codec.New(name).MinSize() {
+		return decoded, codec.None, 0, nil
+	}
+
+	added, err = d.negotiateVariant(name)
+	if err != nil {
+		return nil, codec.None, 0, err
+	}
+	return (*d.variants.Load())[name], name, added, nil
+}
+
+// negotiateVariant computes and caches the variant for name if it isn't already cached, returning
+// how many bytes were newly retained (0 on a cache hit).
+func (d *Data) negotiateVariant(name string) (int64, error) {
+	if variants := d.variants.Load(); variants != nil {
+		if _, ok := (*variants)[name]; ok {
+			return 0, nil
+		}
+	}
+
+	decoded, err := d.DecodedBody()
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	encoded, err := codec.New(name).Encode(decoded)
+	if err != nil {
+		return 0, err
+	}
+	recordCompression(name, len(decoded), len(encoded), time.Since(start))
+	return d.storeVariant(name, encoded), nil
+}
+
+// recordCompression publishes the ratio (compressed/original bytes, lower is better) and wall-clock
+// cost of a single Codec.Encode call, labeled by codec name so an operator can tell whether a given
+// algorithm is actually earning its CPU time on this workload. Called for both the eager/canonical
+// compression done in setUpBody and the on-demand variants negotiateVariant computes.
+func recordCompression(codecName string, originalBytes, compressedBytes int, took time.Duration) {
+	if originalBytes == 0 {
+		return
+	}
+	metrics.GetOrCreateHistogram(compressionRatioMetricName(codecName)).Update(float64(compressedBytes) / float64(originalBytes))
+	metrics.GetOrCreateHistogram(compressionDurationMetricName(codecName)).Update(took.Seconds() * 1000)
+}
+
+func compressionRatioMetricName(codecName string) string {
+	return keyword.CacheCompressionRatioMetricName + `{codec="` + codecName + `"}`
+}
+
+func compressionDurationMetricName(codecName string) string {
+	return keyword.CacheCompressionDurationMsMetricName + `{codec="` + codecName + `"}`
+}
+
+// storeVariant copy-on-writes encoded into the variants map under name, returning the number of
+// bytes newly retained (0 if another goroutine won the race to cache this same name first).
+func (d *Data) storeVariant(name string, encoded []byte) int64 {
+	for {
+		old := d.variants.Load()
+		oldMap := variantsMap(old)
+		if _, exists := oldMap[name]; exists {
+			return 0
+		}
+
+		next := make(map[string][]byte, len(oldMap)+1)
+		for k, v := range oldMap {
+			next[k] = v
+		}
+		next[name] = encoded
+
+		if d.variants.CompareAndSwap(old, &next) {
+			added := int64(len(encoded))
+			atomic.AddInt64(&d.variantsWeight, added)
+			return added
+		}
+	}
+}
+
+func variantsMap(m *map[string][]byte) map[string][]byte {
+	if m == nil {
+		return nil
+	}
+	return *m
+}
+
+// negotiable reports whether name is one rule's Compression.Negotiate allows computing on demand.
+func negotiable(rule *config.Rule, name string) bool {
+	if rule == nil {
+		return false
+	}
+	for _, allowed := range rule.Compression.Negotiate {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (d *Data) filterHeadersInPlace(allowed [][]byte) *Data {
 headersLoop:
 	for headerName, _ := range d.headers {
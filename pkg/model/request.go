@@ -3,10 +3,14 @@ package model
 import (
 	"bytes"
 	"errors"
+	"strconv"
+
 	"github.com/caddyserver/caddy/v2/pkg/config"
 	sharded "github.com/caddyserver/caddy/v2/pkg/storage/map"
+	"github.com/caddyserver/caddy/v2/pkg/telemetry"
 	"github.com/valyala/fasthttp"
 	"github.com/zeebo/xxh3"
+	"go.opentelemetry.io/otel/attribute"
 	"net/http"
 	"sort"
 	"strings"
@@ -29,24 +33,40 @@ type Request struct {
 }
 
 func NewRequestFromNetHttp(cfg *config.Cache, r *http.Request) (*Request, error) {
+	tracer := telemetry.New(cfg.Cache.Telemetry.TracingEnabled, "model.Request")
+	_, span := tracer.Start(r.Context(), "model.NewRequestFromNetHttp")
+	defer span.End()
+
 	// path must be a readonly slice, don't change it anywhere
 	req := &Request{path: unsafe.Slice(unsafe.StringData(r.URL.Path), len(r.URL.Path))} // static value (strings are immutable, so easily refer to it)
 
 	rule := matchRule(cfg, req.path)
 	if rule == nil {
+		span.SetAttributes(attribute.String("outcome", "rejected"))
 		return nil, RuleNotFoundError
 	}
 	req.rule = rule
 
 	queries := getFilteredAndSortedKeyQueriesNetHttp(r, rule.CacheKey.QueryBytes)
-	headers := getFilteredAndSortedKeyHeadersNetHttp(r, rule.CacheKey.HeadersBytes)
+	headers := getFilteredAndSortedKeyHeadersNetHttp(r, effectiveKeyHeaders(rule))
 
 	req.setUpManually(queries, headers)
 
+	span.SetAttributes(
+		attribute.String("outcome", "admitted"),
+		attribute.String("rule.path", rule.Path),
+		attribute.String("mapKey", strconv.FormatUint(req.key, 16)),
+		attribute.String("shardKey", strconv.FormatUint(req.shard, 16)),
+	)
+
 	return req, nil
 }
 
 func NewRequestFromFasthttp(cfg *config.Cache, r *fasthttp.RequestCtx) (*Request, error) {
+	tracer := telemetry.New(cfg.Cache.Telemetry.TracingEnabled, "model.Request")
+	_, span := tracer.Start(r, "model.NewRequestFromFasthttp")
+	defer span.End()
+
 	// full separated slice bytes of path a safe for changes due to it copy
 	path := append([]byte(nil), r.Path()...) // path in the fasthttp are reusable resource, so just copy it
 
@@ -54,14 +74,22 @@ func NewRequestFromFasthttp(cfg *config.Cache, r *fasthttp.RequestCtx) (*Request
 
 	req.rule = matchRule(cfg, path)
 	if req.rule == nil {
+		span.SetAttributes(attribute.String("outcome", "rejected"))
 		return nil, RuleNotFoundError
 	}
 
 	queries := getFilteredAndSortedKeyQueriesFastHttp(r, req.rule.CacheKey.QueryBytes)
-	headers := getFilteredAndSortedKeyHeadersFastHttp(&r.Request.Header, req.rule.CacheKey.HeadersBytes)
+	headers := getFilteredAndSortedKeyHeadersFastHttp(&r.Request.Header, effectiveKeyHeaders(req.rule))
 
 	req.setUpManually(queries, headers)
 
+	span.SetAttributes(
+		attribute.String("outcome", "admitted"),
+		attribute.String("rule.path", req.rule.Path),
+		attribute.String("mapKey", strconv.FormatUint(req.key, 16)),
+		attribute.String("shardKey", strconv.FormatUint(req.shard, 16)),
+	)
+
 	return req, nil
 }
 
@@ -73,7 +101,7 @@ func NewRequest(cfg *config.Cache, path []byte, argsKvPairs [][2][]byte, headers
 	req := &Request{path: path, rule: matchRule(cfg, path)}
 	req.setUpManually(
 		getFilteredAndSortedKeyQueriesManual(argsKvPairs, req.rule.CacheKey.QueryBytes),
-		getFilteredAndSortedKeyHeadersManual(headersKvPairs, req.rule.CacheKey.HeadersBytes),
+		getFilteredAndSortedKeyHeadersManual(headersKvPairs, effectiveKeyHeaders(req.rule)),
 	)
 	return req
 }
@@ -102,6 +130,17 @@ func (r *Request) ShardKey() uint64 {
 	return r.shard
 }
 
+// WithMapKey returns a shallow copy of r with its MapKey/ShardKey overridden to key/shard, sharing
+// every other field (path, query, headers, rule) with r. Used by pkg/storage/namespace to remap a
+// request into a namespaced keyspace before delegating to an underlying Storage, without paying the
+// cost of re-deriving path/query/header state.
+func (r *Request) WithMapKey(key, shard uint64) *Request {
+	clone := *r
+	clone.key = key
+	clone.shard = shard
+	return &clone
+}
+
 func (r *Request) Weight() int64 {
 	weight := int64(unsafe.Sizeof(*r)) + int64(len(r.query)) + int64(len(r.path))
 	for _, kv := range r.Headers() {
@@ -175,6 +214,25 @@ func hash(buf []byte) uint64 {
 	return hasher.Sum64()
 }
 
+// effectiveKeyHeaders unions rule.CacheKey.HeadersBytes (the operator-configured allow-list) with
+// whatever request header names rule.VaryHeaders has discovered from the origin's Vary header, so
+// HTTPCache-enabled rules split their cache key on Vary-listed headers without requiring an
+// operator to also list them under cache_key.headers. nil rule is handled for NewRawRequest-style
+// callers that never reach here with one.
+func effectiveKeyHeaders(rule *config.Rule) [][]byte {
+	if rule == nil {
+		return nil
+	}
+	vary := rule.VaryHeaders()
+	if len(vary) == 0 {
+		return rule.CacheKey.HeadersBytes
+	}
+	combined := make([][]byte, 0, len(rule.CacheKey.HeadersBytes)+len(vary))
+	combined = append(combined, rule.CacheKey.HeadersBytes...)
+	combined = append(combined, vary...)
+	return combined
+}
+
 func matchRule(cfg *config.Cache, path []byte) *config.Rule {
 	for _, rule := range cfg.Cache.Rules {
 		if bytes.HasPrefix(path, rule.PathBytes) {
@@ -1,54 +1,39 @@
 package model
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
 	"fmt"
 	"github.com/caddyserver/caddy/v2/pkg/config"
-	"github.com/caddyserver/caddy/v2/pkg/list"
 	"math"
 	"math/rand/v2"
 	"net/http"
 	"strings"
-	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
 )
 
-const gzipThreshold = 1024 // Minimum body size to apply compress compression
-
-// -- Internal pools for efficient memory management --
-
-var (
-	GzipBufferPool = &sync.Pool{New: func() any { return new(bytes.Buffer) }}
-	GzipWriterPool = &sync.Pool{New: func() any {
-		w, err := gzip.NewWriterLevel(nil, gzip.BestSpeed)
-		if err != nil {
-			panic("failed to Init. compress writer: " + err.Error())
-		}
-		return w
-	}}
-)
-
 // Response is the main cache object, holding the request, payload, metadata, and list pointers.
 type Response struct {
-	cfg           *config.Cache                                     // Immutable field
-	request       *atomic.Pointer[Request]                          // Associated Key
-	data          *atomic.Pointer[Data]                             // Cached data
-	lruListElem   *atomic.Pointer[list.Element[*Response]]          // Pointer for LRU list (per-shard)
-	revalidator   func(ctx context.Context) (data *Data, err error) // Closure for refresh/revalidation
-	weight        int64                                             // Response weight in bytes
-	revalidatedAt int64                                             // Last revalidated time (nanoseconds since epoch)
+	cfg                    *config.Cache                                                             // Immutable field
+	request                *atomic.Pointer[Request]                                                  // Associated Key
+	data                   *atomic.Pointer[Data]                                                     // Cached data
+	revalidator            func(ctx context.Context) (data *Data, err error)                         // Closure for refresh/revalidation
+	conditionalRevalidator func(ctx context.Context, etag, lastModified string) (bool, *Data, error) // Closure for conditional GET refresh; nil if the backend doesn't support it
+	traceCtx               *atomic.Pointer[context.Context]                                          // Context of the request that produced this entry, for tracing async refreshes
+	weight                 int64                                                                     // Response weight in bytes
+	revalidatedAt          int64                                                                     // Last revalidated time (nanoseconds since epoch)
+	latencyEWMA            int64                                                                     // EWMA of revalidator() wall time (nanoseconds), used to cost-weight ShouldBeRefreshed
+	errorSince             int64                                                                     // nanoseconds since epoch of the first consecutive revalidation failure; 0 when healthy
 }
 
 // NewResponse constructs a new Response using memory pools and sets up all fields.
 func NewResponse(
 	data *Data, req *Request, cfg *config.Cache,
 	revalidator func(ctx context.Context) (data *Data, err error),
+	conditionalRevalidator func(ctx context.Context, etag, lastModified string) (bool, *Data, error),
 ) (*Response, error) {
-	return new(Response).Init().SetUp(cfg, data, req, revalidator), nil
+	return new(Response).Init().SetUp(cfg, data, req, revalidator, conditionalRevalidator), nil
 }
 
 // Init ensures all pointers are non-nil after pool Get.
@@ -59,8 +44,8 @@ func (r *Response) Init() *Response {
 	if r.data == nil {
 		r.data = &atomic.Pointer[Data]{}
 	}
-	if r.lruListElem == nil {
-		r.lruListElem = &atomic.Pointer[list.Element[*Response]]{}
+	if r.traceCtx == nil {
+		r.traceCtx = &atomic.Pointer[context.Context]{}
 	}
 	return r
 }
@@ -71,11 +56,13 @@ func (r *Response) SetUp(
 	data *Data,
 	req *Request,
 	revalidator func(ctx context.Context) (data *Data, err error),
+	conditionalRevalidator func(ctx context.Context, etag, lastModified string) (bool, *Data, error),
 ) *Response {
 	r.cfg = cfg
 	r.data.Store(data)
 	r.request.Store(req)
 	r.revalidator = revalidator
+	r.conditionalRevalidator = conditionalRevalidator
 	r.revalidatedAt = time.Now().UnixNano()
 	r.weight = r.setUpWeight()
 	return r
@@ -103,9 +90,13 @@ func (r *Response) ShardKey() uint64 {
 	return r.request.Load().ShardKey()
 }
 
-// ShouldBeRefreshed implements probabilistic refresh logic ("beta" algorithm).
-// Returns true if the entry is stale and, with a probability proportional to its staleness, should be refreshed now.
-func (r *Response) ShouldBeRefreshed() bool {
+// ShouldBeRefreshed implements the cost-aware XFetch recurrence: rand() >= exp(-beta*delta*age/ttl),
+// where delta weighs in this response's measured revalidation cost (see refreshCostDelta) so slow
+// origins refresh more conservatively and cheap ones refresh more eagerly than the textbook,
+// cost-unaware formula. queueLoad is the refresher's current queue-depth/capacity ratio (0 if the
+// caller doesn't track one); exceeding Cache.Refresh.QueueHighWaterMark downgrades beta so the cache
+// self-throttles instead of piling more refreshes onto a backed-up queue.
+func (r *Response) ShouldBeRefreshed(queueLoad float64) bool {
 	if r == nil {
 		return false
 	}
@@ -136,25 +127,100 @@ func (r *Response) ShouldBeRefreshed() bool {
 		minStale = r.cfg.Cache.Refresh.MinStale
 	}
 
-	if r.data.Load().statusCode != http.StatusOK {
+	data := r.data.Load()
+
+	// The origin's own Cache-Control/Expires (parsed in model.NewData, only when the rule's
+	// HTTPCache.Enabled) takes priority over the rule's static TTL: this is what makes the module
+	// usable as a drop-in shared cache rather than one that only ever trusts its own config.
+	if ttl, ok := data.EffectiveTTL(); ok {
+		interval = ttl
+		minStale = time.Duration(float64(ttl) * beta)
+	}
+
+	if data.statusCode != http.StatusOK {
 		interval = interval / 10 // On stale will be used 10% of origin interval.
 		minStale = minStale / 10 // On stale will be used 10% of origin stale duration.
 	}
 
+	if hwm := r.cfg.Cache.Refresh.QueueHighWaterMark; hwm > 0 && queueLoad > hwm {
+		beta *= hwm / queueLoad
+	}
+
+	if jitter := r.cfg.Cache.Refresh.Jitter; jitter > 0 {
+		minStale += time.Duration(rand.Int64N(int64(jitter)))
+	}
+
+	age := time.Since(time.Unix(0, revalidatedAt))
+
+	// Past the freshness lifetime and the origin declared stale-while-revalidate: RFC 5861 treats
+	// this window as "refresh eagerly, serve stale meanwhile" rather than another probabilistic
+	// staleness band, so offer it for refresh deterministically instead of rolling XFetch's dice.
+	if swr, ok := data.StaleWhileRevalidate(); ok && age > interval && age <= interval+swr {
+		return true
+	}
+
 	// hard check that min
-	if age := time.Since(time.Unix(0, revalidatedAt)).Nanoseconds(); age > minStale.Nanoseconds() {
-		return rand.Float64() >= math.Exp((-beta)*float64(age)/float64(interval))
+	if age.Nanoseconds() > minStale.Nanoseconds() {
+		delta := refreshCostDelta(atomic.LoadInt64(&r.latencyEWMA))
+		return rand.Float64() >= math.Exp((-beta)*delta*float64(age.Nanoseconds())/float64(interval))
 	}
 
 	return false
 }
 
+// refreshCostBaseline is the recomputation latency a delta of 1 (the textbook, cost-unaware
+// formula) corresponds to; origins faster than this refresh more eagerly, slower ones more
+// conservatively.
+const refreshCostBaseline = int64(50 * time.Millisecond)
+
+// refreshCostDelta turns a measured EWMA revalidation latency into the delta term of the cost-aware
+// XFetch recurrence used by ShouldBeRefreshed: delta > 1 for origins faster than
+// refreshCostBaseline, delta < 1 for slower ones, clamped so one pathologically fast or slow sample
+// can't swing the recurrence to "always" or "never".
+func refreshCostDelta(latencyEWMA int64) float64 {
+	if latencyEWMA <= 0 {
+		return 1 // no revalidation history yet: behave like the original, cost-unaware formula
+	}
+
+	const minDelta, maxDelta = 0.1, 10.0
+	delta := float64(refreshCostBaseline) / float64(latencyEWMA)
+	if delta < minDelta {
+		return minDelta
+	}
+	if delta > maxDelta {
+		return maxDelta
+	}
+	return delta
+}
+
+// updateLatencyEWMA folds observed (the wall time of one revalidator/conditionalRevalidator call)
+// into the running EWMA used by refreshCostDelta, via a lock-free CAS loop since concurrent
+// refreshes of the same entry, while rare, aren't impossible under a racing refresh+client-triggered
+// revalidation.
+func (r *Response) updateLatencyEWMA(observed time.Duration) {
+	const alpha = 0.2 // weight given to each new sample; low enough to smooth out one-off hiccups
+	for {
+		old := atomic.LoadInt64(&r.latencyEWMA)
+		next := int64(observed)
+		if old > 0 {
+			next = int64(float64(old)*(1-alpha) + float64(observed)*alpha)
+		}
+		if atomic.CompareAndSwapInt64(&r.latencyEWMA, old, next) {
+			return
+		}
+	}
+}
+
 // Revalidate calls the revalidator closure to fetch fresh data and updates the timestamp.
 func (r *Response) Revalidate(ctx context.Context) error {
+	start := time.Now()
 	data, err := r.revalidator(ctx)
+	r.updateLatencyEWMA(time.Since(start))
 	if err != nil {
+		r.markRevalidationError()
 		return err
 	}
+	r.clearRevalidationError()
 
 	r.data.Store(data)
 	atomic.AddInt64(&r.weight, data.Weight()-r.data.Load().Weight())
@@ -163,19 +229,100 @@ func (r *Response) Revalidate(ctx context.Context) error {
 	return nil
 }
 
+// markRevalidationError records the start of a run of consecutive revalidation failures, if one
+// isn't already in progress, so WithinStaleIfError can bound how long this entry keeps being
+// tolerated as "temporarily stale" rather than actually broken.
+func (r *Response) markRevalidationError() {
+	atomic.CompareAndSwapInt64(&r.errorSince, 0, time.Now().UnixNano())
+}
+
+// clearRevalidationError resets the consecutive-failure streak after a successful revalidation.
+func (r *Response) clearRevalidationError() {
+	atomic.StoreInt64(&r.errorSince, 0)
+}
+
+// WithinStaleIfError reports whether this entry is still within the origin's declared
+// stale-if-error tolerance (RFC 5861), given its current run of consecutive revalidation failures.
+// It's always true when there's no failure in progress or the origin never declared stale-if-error
+// at all -- this module already keeps serving whatever's in storage regardless of the outcome here,
+// so the window only gates whether callers (the refresher's logging today; a future eviction
+// policy could act on it too) should keep treating the entry as "acceptable to keep serving" versus
+// "stale past the point the origin said was safe".
+func (r *Response) WithinStaleIfError() bool {
+	since := atomic.LoadInt64(&r.errorSince)
+	if since == 0 {
+		return true
+	}
+	window, ok := r.data.Load().StaleIfError()
+	if !ok {
+		return true
+	}
+	return time.Since(time.Unix(0, since)) <= window
+}
+
+// RevalidateConditional refreshes the entry using a conditional GET (If-None-Match/If-Modified-Since
+// built from the currently-cached Data's ETag/Last-Modified), returning whether the origin answered
+// 304 Not Modified. On a 304, only the freshness timestamp is bumped: the stored body, headers and
+// weight are left untouched, so the balancer never reallocates weight for a refresh that didn't
+// actually change anything. On a full 200, the behavior matches Revalidate. Falls back to a plain
+// Revalidate if this Response wasn't built with a conditional revalidator (e.g. in tests, or a
+// Backender that doesn't support conditional requests).
+func (r *Response) RevalidateConditional(ctx context.Context) (notModified bool, err error) {
+	if r.conditionalRevalidator == nil {
+		return false, r.Revalidate(ctx)
+	}
+
+	current := r.data.Load()
+	start := time.Now()
+	notModified, data, err := r.conditionalRevalidator(ctx, current.ETag(), current.LastModified())
+	r.updateLatencyEWMA(time.Since(start))
+	if err != nil {
+		r.markRevalidationError()
+		return false, err
+	}
+	r.clearRevalidationError()
+
+	if notModified {
+		atomic.StoreInt64(&r.revalidatedAt, time.Now().UnixNano())
+		return true, nil
+	}
+
+	r.data.Store(data)
+	atomic.AddInt64(&r.weight, data.Weight()-current.Weight())
+	atomic.StoreInt64(&r.revalidatedAt, time.Now().UnixNano())
+
+	return false, nil
+}
+
 // Request returns the request pointer.
 func (r *Response) Request() *Request {
 	return r.request.Load()
 }
 
-// LruListElement returns the LRU list element pointer (for LRU cache management).
-func (r *Response) LruListElement() *list.Element[*Response] {
-	return r.lruListElem.Load()
+// WithRequest returns a shallow copy of r whose associated Request is req instead of r.Request(),
+// sharing Data/revalidators/trace context with r (weight and timestamps are copied as of this call). Used by
+// pkg/storage/namespace to present a namespace-remapped (or restored original) view of a Response
+// around a call into/out of an underlying Storage, without rebuilding the whole Response.
+func (r *Response) WithRequest(req *Request) *Response {
+	clone := *r
+	clone.request = &atomic.Pointer[Request]{}
+	clone.request.Store(req)
+	return &clone
 }
 
-// SetLruListElement sets the LRU list element pointer.
-func (r *Response) SetLruListElement(el *list.Element[*Response]) {
-	r.lruListElem.Store(el)
+// SetTraceContext records the context of the request that produced (or last revalidated) this
+// entry, so a background refresh's span can be linked back to the client-initiated trace that
+// caused the entry to be cached in the first place.
+func (r *Response) SetTraceContext(ctx context.Context) {
+	r.traceCtx.Store(&ctx)
+}
+
+// TraceContext returns the last-recorded trace context, or context.Background() if none was set.
+func (r *Response) TraceContext() context.Context {
+	if ctx := r.traceCtx.Load(); ctx != nil {
+		return *ctx
+	}
+	return context.Background()
 }
 
 // Data returns the underlying Data payload.
@@ -210,11 +357,26 @@ func (r *Response) setUpWeight() int64 {
 			}
 		}
 		size += len(data.body)
+		size += int(atomic.LoadInt64(&data.variantsWeight))
 	}
 
 	return int64(size) + r.Request().Weight()
 }
 
+// NegotiateVariant returns the body for this Response's Data encoded as accept (a pkg/codec.Codec
+// name from a negotiated Accept-Encoding), computing and caching that variant on Data if no request
+// has asked for it yet. Weight is bumped in lockstep with whatever NegotiateVariant newly retains, so
+// eviction/admission accounting stays accurate even though the variant is added well after this
+// Response was first weighed and inserted.
+func (r *Response) NegotiateVariant(accept string) (body []byte, usedCodec string, err error) {
+	data := r.data.Load()
+	body, usedCodec, added, err := data.NegotiateVariant(r.Request().Rule(), accept)
+	if added > 0 {
+		atomic.AddInt64(&r.weight, added)
+	}
+	return body, usedCodec, err
+}
+
 // Weight estimates the in-memory size of this response (including dynamic fields).
 func (r *Response) Weight() int64 {
 	return r.weight
@@ -7,4 +7,44 @@ const (
 	HttpResponseTimeMsMetricName   = "http_response_duration_ms"
 	MapMemoryUsageMetricName       = "map_memory_usage"
 	MapLength                      = "map_length"
+	CacheHitsMetricName            = "cache_hits_total"
+	CacheMissesMetricName          = "cache_misses_total"
+	CacheAdmissionsRejectedMetric  = "cache_admissions_rejected_total"
+	CacheEvictionsMetricName       = "cache_evictions_total"
+	RefreshLatencyMsMetricName     = "cache_refresh_duration_ms"
+	MemoryPressureMetricName       = "cache_memory_pressure_ratio"
+
+	CacheEvacuationEntriesTotalMetricName = "cache_evacuation_entries_total"
+	CacheEvacuationEntriesDoneMetricName  = "cache_evacuation_entries_done_total"
+	CacheEvacuationErrorsMetricName       = "cache_evacuation_errors_total"
+	CacheEvacuationFreedBytesMetricName   = "cache_evacuation_freed_bytes_total"
+
+	CacheTierBytesMetricName = "cache_tier_bytes"
+	CacheTierLenMetricName   = "cache_tier_len"
+
+	CacheOpsTotalMetricName          = "cache_ops_total"
+	CacheOpDurationSecondsMetricName = "cache_op_duration_seconds"
+	CacheBytesMetricName             = "cache_bytes"
+	CacheItemsMetricName             = "cache_items"
+
+	UpstreamFetchDurationSecondsMetricName = "upstream_fetch_duration_seconds"
+	UpstreamFetchErrorsTotalMetricName     = "upstream_fetch_errors_total"
+
+	UpstreamThrottledTotalMetricName = "upstream_throttled_total"
+	UpstreamQueueDepthMetricName     = "upstream_queue_depth"
+
+	InvalidationEventsPublishedTotalMetricName = "invalidation_events_published_total"
+	InvalidationEventsConsumedTotalMetricName  = "invalidation_events_consumed_total"
+	InvalidationEventsReclaimedTotalMetricName = "invalidation_events_reclaimed_total"
+
+	TinyLFUAdmitTotalMetricName  = "tinylfu_admit_total"
+	TinyLFURejectTotalMetricName = "tinylfu_reject_total"
+
+	CacheRequestsByRuleTotalMetricName = "cache_requests_by_rule_total"
+	CacheEvictionsByReasonMetricName   = "cache_evictions_by_reason_total"
+	RefreshQueueDepthMetricName        = "cache_refresh_queue_depth_permille"
+	CacheShardEntriesMetricName        = "cache_shard_entries"
+
+	CacheCompressionRatioMetricName      = "cache_compression_ratio"
+	CacheCompressionDurationMsMetricName = "cache_compression_duration_ms"
 )
@@ -7,22 +7,49 @@ import (
 	"time"
 )
 
+// RouteClass groups requests for the purpose of picking a response-time histogram's bucket
+// boundaries. Without it every route shares VictoriaMetrics' default auto-bucketing, which can't be
+// tuned for e.g. a cache hit (sub-millisecond) versus an upstream fetch (seconds-scale) without one
+// drowning out the other's resolution.
+type RouteClass string
+
+const (
+	// RouteClassDefault is used whenever a caller doesn't classify the request; it keeps the
+	// historic behavior of VictoriaMetrics' own auto-bucketed Histogram.
+	RouteClassDefault RouteClass = ""
+	// RouteClassHit marks a request served directly from cache.
+	RouteClassHit RouteClass = "hit"
+	// RouteClassUpstream marks a request that had to reach the upstream backend.
+	RouteClassUpstream RouteClass = "upstream"
+)
+
+// Buckets is an ascending list of histogram bucket upper bounds, in seconds (the unit
+// FlushResponseTimeTimer already records in). An empty/nil Buckets leaves a class on
+// VictoriaMetrics' own auto-bucketed Histogram.
+type Buckets []float64
+
 // Meter defines methods for recording application metrics.
 type Meter interface {
 	IncTotal(path, method, status string)
 	IncStatus(path, method, status string)
 	NewResponseTimeTimer(path, method string) *Timer
-	FlushResponseTimeTimer(t *Timer)
+	FlushResponseTimeTimer(t *Timer, class RouteClass)
 	SetCacheLength(count int64)
 	SetCacheMemory(bytes int64)
 }
 
 // Metrics implements Meter using VictoriaMetrics metrics.
-type Metrics struct{}
+type Metrics struct {
+	// buckets maps a RouteClass to the explicit bucket boundaries operators configured for it.
+	// Classes absent from the map (including the default, nil-map case) fall back to
+	// VictoriaMetrics' own auto-bucketed Histogram.
+	buckets map[RouteClass]Buckets
+}
 
-// New creates a new Metrics instance.
-func New() *Metrics {
-	return &Metrics{}
+// New creates a new Metrics instance. buckets may be nil, in which case every RouteClass uses
+// VictoriaMetrics' default auto-bucketed Histogram, matching the historic behavior.
+func New(buckets map[RouteClass]Buckets) *Metrics {
+	return &Metrics{buckets: buckets}
 }
 
 // Precompute status code strings for performance.
@@ -87,25 +114,56 @@ func (m *Metrics) SetCacheLength(count int64) {
 
 // Timer tracks start of an operation for timing metrics.
 type Timer struct {
-	name  string
-	start time.Time
+	labels string // e.g. `{path="...",method="..."}`
+	start  time.Time
 }
 
 // NewResponseTimeTimer creates a Timer for measuring response time of given path and method.
 func (m *Metrics) NewResponseTimeTimer(path, method string) *Timer {
 	buf := make([]byte, 0, 48)
 
-	buf = append(buf, keyword.HttpResponseTimeMsMetricName...)
 	buf = append(buf, `{path="`...)
 	buf = append(buf, path...)
 	buf = append(buf, `",method="`...)
 	buf = append(buf, method...)
 	buf = append(buf, `"}`...)
 
-	return &Timer{name: string(buf), start: time.Now()}
+	return &Timer{labels: string(buf), start: time.Now()}
 }
 
-// FlushResponseTimeTimer records the elapsed time since Timer creation into a histogram.
-func (m *Metrics) FlushResponseTimeTimer(t *Timer) {
-	metrics.GetOrCreateHistogram(t.name).Update(time.Since(t.start).Seconds())
+// FlushResponseTimeTimer records the elapsed time since Timer creation. class is only knowable once
+// the request has actually finished (e.g. whether it turned out to be a cache hit or had to reach
+// upstream), which is why it's a FlushResponseTimeTimer argument rather than something
+// NewResponseTimeTimer decided up front. If class has explicit Buckets configured (via New), the
+// duration is recorded as a manual cumulative histogram (observeBuckets); otherwise it goes into
+// VictoriaMetrics' own auto-bucketed Histogram, same as before Buckets existed.
+func (m *Metrics) FlushResponseTimeTimer(t *Timer, class RouteClass) {
+	elapsed := time.Since(t.start).Seconds()
+	buckets := m.buckets[class]
+	if len(buckets) == 0 {
+		metrics.GetOrCreateHistogram(keyword.HttpResponseTimeMsMetricName + t.labels).Update(elapsed)
+		return
+	}
+	observeBuckets(t.labels, buckets, elapsed)
+}
+
+// observeBuckets records elapsed against an explicit set of bucket boundaries as a manual
+// cumulative histogram: one _bucket{...,le="x"} counter per boundary (incremented for every
+// boundary >= elapsed, the standard Prometheus cumulative-bucket convention), a "+Inf" catch-all,
+// and _sum/_count companions -- the same four series Prometheus's own histogram type exposes.
+// This exists because VictoriaMetrics/metrics' built-in Histogram always picks its own
+// (non-configurable) bucket boundaries, which is exactly what per-route-class tuning needs to get
+// around.
+func observeBuckets(labels string, buckets Buckets, elapsed float64) {
+	withoutClosingBrace := labels[:len(labels)-1]
+
+	for _, le := range buckets {
+		if elapsed <= le {
+			name := keyword.HttpResponseTimeMsMetricName + "_bucket" + withoutClosingBrace + `,le="` + strconv.FormatFloat(le, 'g', -1, 64) + `"}`
+			metrics.GetOrCreateCounter(name).Inc()
+		}
+	}
+	metrics.GetOrCreateCounter(keyword.HttpResponseTimeMsMetricName + "_bucket" + withoutClosingBrace + `,le="+Inf"}`).Inc()
+	metrics.GetOrCreateCounter(keyword.HttpResponseTimeMsMetricName + "_count" + labels).Inc()
+	metrics.GetOrCreateFloatCounter(keyword.HttpResponseTimeMsMetricName + "_sum" + labels).Add(elapsed)
 }
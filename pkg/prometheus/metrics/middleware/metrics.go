@@ -11,21 +11,37 @@ import (
 
 var emptyStr = ""
 
+// cacheStatusHeader is inspected to classify a response for RouteClass-based bucket selection; it
+// follows the conventional "X-Cache-Status: HIT|MISS" signal (as nginx-style caches emit it) rather
+// than inventing a new one.
+const cacheStatusHeader = "X-Cache-Status"
+const cacheStatusHit = "HIT"
+
 type PrometheusMetrics struct {
-	ctx   context.Context
-	meter metrics.Meter
-	codes [599]string
+	ctx        context.Context
+	meter      metrics.Meter
+	normalizer *internedNormalizer
+	codes      [599]string
 }
 
-func NewPrometheusMetrics(ctx context.Context, meter metrics.Meter) *PrometheusMetrics {
+// NewPrometheusMetrics wires normalizer (see PathNormalizer, RuleNormalizer, TemplateNormalizer)
+// into the label path Middleware records under, so high-cardinality paths (IDs embedded in the URL)
+// don't each mint their own Prometheus series. normalizer may be nil, in which case the raw path is
+// used unmodified, matching the historic behavior.
+func NewPrometheusMetrics(ctx context.Context, meter metrics.Meter, normalizer PathNormalizer) *PrometheusMetrics {
 	codes := [599]string{}
 	for code := 0; code < 599; code++ {
 		codes[code] = strconv.Itoa(code)
 	}
+	var interned *internedNormalizer
+	if normalizer != nil {
+		interned = newInternedNormalizer(normalizer)
+	}
 	return &PrometheusMetrics{
-		ctx:   ctx,
-		meter: meter,
-		codes: codes,
+		ctx:        ctx,
+		meter:      meter,
+		normalizer: interned,
+		codes:      codes,
 	}
 }
 
@@ -34,19 +50,36 @@ func (m *PrometheusMetrics) Middleware(next fasthttp.RequestHandler) fasthttp.Re
 		pth := ctx.Path()
 		method := ctx.Method()
 
+		// pathStr/methodStr alias fasthttp's own buffers via unsafe -- no copy, no allocation. Only
+		// the (interned, cached) normalized label below is ever turned into an owned string.
 		pathStr := *(*string)(unsafe.Pointer(&pth))
 		methodStr := *(*string)(unsafe.Pointer(&method))
 
-		timer := m.meter.NewResponseTimeTimer(pathStr, methodStr)
-		m.meter.IncTotal(pathStr, methodStr, emptyStr) // total requests (no status)
+		label := pathStr
+		if m.normalizer != nil {
+			label = m.normalizer.normalize(pth)
+		}
+
+		timer := m.meter.NewResponseTimeTimer(label, methodStr)
+		m.meter.IncTotal(label, methodStr, emptyStr) // total requests (no status)
 
 		next(ctx)
 
 		status := ctx.Response.StatusCode()
-		m.meter.IncStatus(pathStr, methodStr, m.codes[status])
-		m.meter.IncTotal(pathStr, methodStr, m.codes[status])
-		m.meter.FlushResponseTimeTimer(timer)
+		m.meter.IncStatus(label, methodStr, m.codes[status])
+		m.meter.IncTotal(label, methodStr, m.codes[status])
+		m.meter.FlushResponseTimeTimer(timer, routeClass(ctx))
 
 		runtime.Gosched()
 	}
 }
+
+// routeClass classifies a finished response for response-time bucket selection (see
+// metrics.RouteClass). It can only run after next(ctx), since whether this request was served from
+// cache isn't known beforehand.
+func routeClass(ctx *fasthttp.RequestCtx) metrics.RouteClass {
+	if string(ctx.Response.Header.Peek(cacheStatusHeader)) == cacheStatusHit {
+		return metrics.RouteClassHit
+	}
+	return metrics.RouteClassUpstream
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"bytes"
+	"regexp"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2/pkg/config"
+)
+
+// otherLabel is the label a PathNormalizer falls back to for a path it doesn't recognize, so an
+// operator can't accidentally reintroduce unbounded cardinality by forgetting a route.
+const otherLabel = "/other"
+
+// PathNormalizer maps a raw, potentially high-cardinality request path (e.g. /users/123/orders/456)
+// to a low-cardinality label value safe to put on a Prometheus series.
+type PathNormalizer interface {
+	Normalize(path []byte) string
+}
+
+// internedNormalizer wraps a PathNormalizer with a cache keyed by the raw path's hash, so repeat
+// requests to the same route reuse the previously computed label instead of re-running the
+// (possibly regex-based) normalizer and allocating a new string on every single request.
+type internedNormalizer struct {
+	normalizer PathNormalizer
+	cache      sync.Map // uint64 (fnv1a of path) -> string
+}
+
+func newInternedNormalizer(n PathNormalizer) *internedNormalizer {
+	return &internedNormalizer{normalizer: n}
+}
+
+func (n *internedNormalizer) normalize(path []byte) string {
+	key := fnv1a(path)
+	if v, ok := n.cache.Load(key); ok {
+		return v.(string)
+	}
+	label := n.normalizer.Normalize(path)
+	n.cache.Store(key, label)
+	return label
+}
+
+// fnv1a hashes path with the 64-bit FNV-1a algorithm. It's used only as an interning cache key, not
+// for security, so the small risk of a 64-bit collision merely means two distinct paths briefly
+// share a cached label -- an acceptable tradeoff for never having to copy path into a string just to
+// use it as a map key.
+func fnv1a(path []byte) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	hash := uint64(offset64)
+	for _, b := range path {
+		hash ^= uint64(b)
+		hash *= prime64
+	}
+	return hash
+}
+
+// RuleNormalizer buckets a path under the config.Rule.Path pattern it matches, reusing the exact
+// prefix-match semantics the cache itself uses to pick a rule (see model.matchRule), so metrics
+// group requests the same way the cache already does without any separate configuration. A path
+// matching no rule is labeled otherLabel.
+type RuleNormalizer struct {
+	rules []*config.Rule
+}
+
+// NewRuleNormalizer builds a RuleNormalizer over rules, normally cfg.Cache.Rules.
+func NewRuleNormalizer(rules []*config.Rule) *RuleNormalizer {
+	return &RuleNormalizer{rules: rules}
+}
+
+func (n *RuleNormalizer) Normalize(path []byte) string {
+	for _, rule := range n.rules {
+		if bytes.HasPrefix(path, rule.PathBytes) {
+			return rule.Path
+		}
+	}
+	return otherLabel
+}
+
+// TemplateNormalizer matches a path against a set of Caddyfile-configured templates like
+// "/users/{id}/orders/{id}" and labels it with whichever template matched (or otherLabel if none
+// did), turning "{name}" segments into opaque wildcards so the name itself never leaks into the
+// label.
+type TemplateNormalizer struct {
+	templates []compiledTemplate
+}
+
+type compiledTemplate struct {
+	raw string
+	re  *regexp.Regexp
+}
+
+var templateParamPattern = regexp.MustCompile(`\{[^/{}]+\}`)
+
+// NewTemplateNormalizer compiles templates (Caddyfile "path_template" directives) into matchers.
+// Each "{name}" segment becomes a `[^/]+` wildcard; everything else is matched literally.
+func NewTemplateNormalizer(templates []string) (*TemplateNormalizer, error) {
+	compiled := make([]compiledTemplate, 0, len(templates))
+	for _, tmpl := range templates {
+		re, err := regexp.Compile(requoteTemplateParams(tmpl))
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, compiledTemplate{raw: tmpl, re: re})
+	}
+	return &TemplateNormalizer{templates: compiled}, nil
+}
+
+// requoteTemplateParams quotes every literal segment of tmpl individually and stitches a `[^/]+`
+// wildcard in between each "{name}" placeholder, since regexp.QuoteMeta(tmpl) would otherwise also
+// escape the braces we need to treat as wildcards.
+func requoteTemplateParams(tmpl string) string {
+	var out bytes.Buffer
+	out.WriteByte('^')
+	last := 0
+	for _, loc := range templateParamPattern.FindAllStringIndex(tmpl, -1) {
+		out.WriteString(regexp.QuoteMeta(tmpl[last:loc[0]]))
+		out.WriteString(`[^/]+`)
+		last = loc[1]
+	}
+	out.WriteString(regexp.QuoteMeta(tmpl[last:]))
+	out.WriteByte('$')
+	return out.String()
+}
+
+func (n *TemplateNormalizer) Normalize(path []byte) string {
+	pathStr := string(path)
+	for _, tmpl := range n.templates {
+		if tmpl.re.MatchString(pathStr) {
+			return tmpl.raw
+		}
+	}
+	return otherLabel
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// leakyBucket holds at most capacity outstanding requests and drains one at a fixed rate/sec,
+// smoothing bursts instead of allowing them the way tokenBucket does: a caller that queues behind a
+// full bucket waits for the drain loop, not for accumulated credit.
+type leakyBucket struct {
+	queue      chan struct{}
+	shedOnFull bool
+}
+
+func newLeakyBucket(ctx context.Context, capacity int, rate float64, shedOnFull bool) *leakyBucket {
+	b := &leakyBucket{
+		queue:      make(chan struct{}, capacity),
+		shedOnFull: shedOnFull,
+	}
+	go b.drain(ctx, time.Duration(float64(time.Second)/rate))
+	return b
+}
+
+func (b *leakyBucket) drain(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			select {
+			case <-b.queue:
+			default:
+			}
+		}
+	}
+}
+
+func (b *leakyBucket) take(ctx context.Context) error {
+	select {
+	case b.queue <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if b.shedOnFull {
+		return ErrUpstreamThrottled
+	}
+
+	select {
+	case b.queue <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *leakyBucket) depth() int {
+	return len(b.queue)
+}
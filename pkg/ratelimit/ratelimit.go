@@ -0,0 +1,103 @@
+// Package ratelimit throttles outbound requests to an upstream host, with one bucket per host.
+// Every Rule whose requests go to the same host draws on that host's single bucket, so one Rule's
+// traffic can use up capacity the others share. It backs
+// repository.Backend.requestExternalBackend; see Limiter.Allow.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrUpstreamThrottled is returned by Allow when the limiter is saturated and the effective Config
+// has ShedOnFull set, instead of blocking the caller until capacity frees up.
+var ErrUpstreamThrottled = errors.New("upstream rate limit exceeded")
+
+const (
+	AlgorithmTokenBucket = "token_bucket"
+	AlgorithmLeakyBucket = "leaky_bucket"
+)
+
+// Config is the fully-resolved (global defaults merged with any Rule override) limiter setting for
+// one Allow call.
+type Config struct {
+	// Rate is the steady-state throughput allowed for this host, in requests/sec. Rate <= 0 means
+	// "unlimited": Allow always returns nil without touching any per-host state.
+	Rate float64
+	// Burst is the token-bucket capacity, or the leaky-bucket queue capacity. 1 if unset.
+	Burst int
+	// Algorithm is AlgorithmTokenBucket (default) or AlgorithmLeakyBucket.
+	Algorithm  string
+	ShedOnFull bool
+}
+
+// bucket is the shared shape of both algorithms: take blocks (respecting ctx) until the request is
+// admitted, or returns ErrUpstreamThrottled immediately when shedOnFull is set and the bucket is
+// currently full; depth reports the current queue/outstanding-token depth for the queue-depth gauge.
+type bucket interface {
+	take(ctx context.Context) error
+	depth() int
+}
+
+// Limiter holds one bucket per upstream host, created lazily from the Config passed to the first
+// Allow call for that host. It's safe for concurrent use and meant to live for the lifetime of a
+// repository.Backend.
+type Limiter struct {
+	ctx context.Context
+
+	mu    sync.Mutex
+	hosts map[string]bucket
+}
+
+// NewLimiter constructs a Limiter. ctx governs the lifetime of any background goroutines a bucket
+// needs (today, only the leaky-bucket drain loop); canceling it stops them.
+func NewLimiter(ctx context.Context) *Limiter {
+	return &Limiter{ctx: ctx, hosts: make(map[string]bucket)}
+}
+
+// Allow admits one request to host under cfg, blocking until capacity is available (bounded by
+// ctx's deadline) unless cfg.ShedOnFull is set, in which case a saturated bucket returns
+// ErrUpstreamThrottled immediately. cfg.Rate <= 0 always admits without allocating any state.
+func (l *Limiter) Allow(ctx context.Context, host string, cfg Config) error {
+	if cfg.Rate <= 0 {
+		return nil
+	}
+	return l.bucketFor(host, cfg).take(ctx)
+}
+
+// QueueDepth reports host's current bucket depth (0 if it has never been throttled), for the
+// upstream_queue_depth gauge.
+func (l *Limiter) QueueDepth(host string) int {
+	l.mu.Lock()
+	b, ok := l.hosts[host]
+	l.mu.Unlock()
+	if !ok {
+		return 0
+	}
+	return b.depth()
+}
+
+func (l *Limiter) bucketFor(host string, cfg Config) bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.hosts[host]; ok {
+		return b
+	}
+
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+
+	var b bucket
+	if cfg.Algorithm == AlgorithmLeakyBucket {
+		b = newLeakyBucket(l.ctx, burst, cfg.Rate, cfg.ShedOnFull)
+	} else {
+		b = newTokenBucket(burst, cfg.Rate, cfg.ShedOnFull)
+	}
+	l.hosts[host] = b
+	return b
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllowUnlimitedWhenRateIsZero(t *testing.T) {
+	l := NewLimiter(context.Background())
+	cfg := Config{Rate: 0}
+
+	for i := 0; i < 100; i++ {
+		if err := l.Allow(context.Background(), "host", cfg); err != nil {
+			t.Fatalf("expected no error with Rate<=0, got %v", err)
+		}
+	}
+	if got := l.QueueDepth("host"); got != 0 {
+		t.Fatalf("expected QueueDepth 0 for a host never throttled, got %d", got)
+	}
+}
+
+func TestLimiterTokenBucketShedsOnFullBurst(t *testing.T) {
+	l := NewLimiter(context.Background())
+	cfg := Config{Rate: 1, Burst: 2, Algorithm: AlgorithmTokenBucket, ShedOnFull: true}
+
+	// The first Burst calls should be admitted immediately from the initial full bucket.
+	for i := 0; i < cfg.Burst; i++ {
+		if err := l.Allow(context.Background(), "host", cfg); err != nil {
+			t.Fatalf("call %d: expected burst capacity to admit, got %v", i, err)
+		}
+	}
+
+	// The bucket should now be empty; with ShedOnFull, the very next call must be rejected
+	// immediately rather than blocking for a refill.
+	if err := l.Allow(context.Background(), "host", cfg); err != ErrUpstreamThrottled {
+		t.Fatalf("expected ErrUpstreamThrottled once burst is exhausted, got %v", err)
+	}
+}
+
+func TestLimiterTokenBucketBlocksWithoutShedOnFull(t *testing.T) {
+	l := NewLimiter(context.Background())
+	cfg := Config{Rate: 1000, Burst: 1, Algorithm: AlgorithmTokenBucket, ShedOnFull: false}
+
+	if err := l.Allow(context.Background(), "host", cfg); err != nil {
+		t.Fatalf("expected first call to admit immediately, got %v", err)
+	}
+
+	// At 1000 req/s a refill is available well within this deadline, so the call should succeed
+	// instead of being shed.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := l.Allow(ctx, "host", cfg); err != nil {
+		t.Fatalf("expected the call to block until refill and then succeed, got %v", err)
+	}
+}
+
+func TestLimiterLeakyBucketShedsOnFullQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l := NewLimiter(ctx)
+	cfg := Config{Rate: 1, Burst: 1, Algorithm: AlgorithmLeakyBucket, ShedOnFull: true}
+
+	if err := l.Allow(ctx, "host", cfg); err != nil {
+		t.Fatalf("expected first call to fill the queue, got %v", err)
+	}
+	if err := l.Allow(ctx, "host", cfg); err != ErrUpstreamThrottled {
+		t.Fatalf("expected ErrUpstreamThrottled once the leaky bucket queue is full, got %v", err)
+	}
+}
+
+func TestLimiterHostsAreIndependent(t *testing.T) {
+	l := NewLimiter(context.Background())
+	cfg := Config{Rate: 1, Burst: 1, Algorithm: AlgorithmTokenBucket, ShedOnFull: true}
+
+	if err := l.Allow(context.Background(), "a", cfg); err != nil {
+		t.Fatalf("host a: expected first call to admit, got %v", err)
+	}
+	if err := l.Allow(context.Background(), "a", cfg); err != ErrUpstreamThrottled {
+		t.Fatalf("host a: expected second call to be throttled, got %v", err)
+	}
+	// A different host must have its own, unstarved bucket.
+	if err := l.Allow(context.Background(), "b", cfg); err != nil {
+		t.Fatalf("host b: expected first call on a distinct host to admit, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket refills continuously at rate tokens/sec up to capacity, allowing short bursts up to
+// capacity before it starts making callers wait.
+type tokenBucket struct {
+	capacity   float64
+	rate       float64
+	shedOnFull bool
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(capacity int, rate float64, shedOnFull bool) *tokenBucket {
+	return &tokenBucket{
+		capacity:   float64(capacity),
+		rate:       rate,
+		shedOnFull: shedOnFull,
+		tokens:     float64(capacity),
+		last:       time.Now(),
+	}
+}
+
+func (b *tokenBucket) take(ctx context.Context) error {
+	for {
+		wait, ok := b.tryTake()
+		if ok {
+			return nil
+		}
+		if b.shedOnFull {
+			return ErrUpstreamThrottled
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// tryTake refills b, then either takes a token (ok == true) or reports how long the caller should
+// wait before the next token is available.
+func (b *tokenBucket) tryTake() (wait time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second)), false
+}
+
+func (b *tokenBucket) depth() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int(b.capacity - b.tokens)
+}
@@ -4,39 +4,55 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"github.com/VictoriaMetrics/metrics"
 	"github.com/caddyserver/caddy/v2/pkg/config"
+	"github.com/caddyserver/caddy/v2/pkg/httpcache"
 	"github.com/caddyserver/caddy/v2/pkg/model"
+	"github.com/caddyserver/caddy/v2/pkg/prometheus/metrics/keyword"
+	"github.com/caddyserver/caddy/v2/pkg/ratelimit"
 	"net/http"
+	"time"
 )
 
+// ErrNotStorable is returned by requestExternalBackend when the rule has HTTP-caching compliance
+// turned on and the origin's Cache-Control forbids storing the response (e.g. "no-store", or
+// "private" under a rule's strict mode).
+var ErrNotStorable = errors.New("response is not storable per origin Cache-Control")
+
 // Backender defines the interface for a repository that provides SEO page data.
 type Backender interface {
 	Fetch(ctx context.Context, req *model.Request) (*model.Response, error)
 	RevalidatorMaker(req *model.Request) func(ctx context.Context) (*model.Data, error)
+	// ConditionalRevalidatorMaker builds a closure that refreshes req via a conditional GET,
+	// passing along the previously-seen ETag/Last-Modified so the origin can answer 304 Not
+	// Modified instead of resending the full body.
+	ConditionalRevalidatorMaker(req *model.Request) func(ctx context.Context, etag, lastModified string) (notModified bool, data *model.Data, err error)
 }
 
 // Backend implements the Backender interface.
 // It fetches and constructs SEO page data responses from an external backend.
 type Backend struct {
-	cfg *config.Cache // Global configuration (backend URL, etc)
+	cfg     *config.Cache // Global configuration (backend URL, etc)
+	limiter *ratelimit.Limiter
 }
 
-// NewBackend creates a new instance of Backend.
-func NewBackend(cfg *config.Cache) *Backend {
-	return &Backend{cfg: cfg}
+// NewBackend creates a new instance of Backend. ctx bounds the lifetime of the rate limiter's
+// background goroutines (see ratelimit.NewLimiter).
+func NewBackend(ctx context.Context, cfg *config.Cache) *Backend {
+	return &Backend{cfg: cfg, limiter: ratelimit.NewLimiter(ctx)}
 }
 
 // Fetch method fetches page data for the given request and constructs a cacheable response.
 // It also attaches a revalidator closure for future background refreshes.
 func (s *Backend) Fetch(ctx context.Context, req *model.Request) (*model.Response, error) {
 	// Fetch data from backend.
-	data, err := s.requestExternalBackend(ctx, req)
+	_, data, err := s.requestExternalBackend(ctx, req, "", "")
 	if err != nil {
 		return nil, errors.New("failed to request external backend: " + err.Error())
 	}
 
-	// Build a new response object, which contains the cache payload, request, config and revalidator.
-	resp, err := model.NewResponse(data, req, s.cfg, s.RevalidatorMaker(req))
+	// Build a new response object, which contains the cache payload, request, config and revalidators.
+	resp, err := model.NewResponse(data, req, s.cfg, s.RevalidatorMaker(req), s.ConditionalRevalidatorMaker(req))
 	if err != nil {
 		return nil, errors.New("failed to create response: " + err.Error())
 	}
@@ -47,13 +63,33 @@ func (s *Backend) Fetch(ctx context.Context, req *model.Request) (*model.Respons
 // RevalidatorMaker builds a new revalidator for model.Response by catching a request into closure for be able to call backend later.
 func (s *Backend) RevalidatorMaker(req *model.Request) func(ctx context.Context) (*model.Data, error) {
 	return func(ctx context.Context) (*model.Data, error) {
-		return s.requestExternalBackend(ctx, req)
+		_, data, err := s.requestExternalBackend(ctx, req, "", "")
+		return data, err
+	}
+}
+
+// ConditionalRevalidatorMaker builds a closure that issues a conditional GET (If-None-Match and/or
+// If-Modified-Since built from etag/lastModified) so a 304 Not Modified can skip re-fetching and
+// re-caching a body that hasn't actually changed at the origin.
+func (s *Backend) ConditionalRevalidatorMaker(req *model.Request) func(ctx context.Context, etag, lastModified string) (bool, *model.Data, error) {
+	return func(ctx context.Context, etag, lastModified string) (bool, *model.Data, error) {
+		return s.requestExternalBackend(ctx, req, etag, lastModified)
 	}
 }
 
 // requestExternalBackend actually performs the HTTP request to backend and parses the response.
-// Returns a Data object suitable for caching.
-func (s *Backend) requestExternalBackend(ctx context.Context, req *model.Request) (*model.Data, error) {
+// When etag or lastModified is non-empty, the request carries If-None-Match/If-Modified-Since and
+// a 304 response is reported back as notModified with a nil Data (the caller already has the data).
+func (s *Backend) requestExternalBackend(ctx context.Context, req *model.Request, etag, lastModified string) (notModified bool, data *model.Data, err error) {
+	start := time.Now()
+	reason := ""
+	defer func() {
+		metrics.GetOrCreateHistogram(keyword.UpstreamFetchDurationSecondsMetricName).Update(time.Since(start).Seconds())
+		if err != nil {
+			metrics.GetOrCreateCounter(upstreamFetchErrorMetricName(reason)).Inc()
+		}
+	}()
+
 	// Apply a hard timeout for the HTTP request.
 	ctx, cancel := context.WithTimeout(ctx, s.cfg.Cache.Refresh.Timeout)
 	defer cancel()
@@ -69,21 +105,112 @@ func (s *Backend) requestExternalBackend(ctx context.Context, req *model.Request
 
 	request, err := http.NewRequestWithContext(ctx, http.MethodGet, string(queryBuf), nil)
 	if err != nil {
-		return nil, err
+		reason = "build_request"
+		return false, nil, err
+	}
+	if etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		request.Header.Set("If-Modified-Since", lastModified)
 	}
 
+	host := request.URL.Host
+	if limitErr := s.limiter.Allow(ctx, host, effectiveRateLimit(s.cfg, req.Rule())); limitErr != nil {
+		reason = "throttled"
+		metrics.GetOrCreateCounter(upstreamThrottledMetricName(host)).Inc()
+		return false, nil, limitErr
+	}
+	metrics.GetOrCreateCounter(upstreamQueueDepthMetricName(host)).Set(uint64(s.limiter.QueueDepth(host)))
+
 	response, err := http.DefaultClient.Do(request)
 	if err != nil {
-		return nil, err
+		reason = "timeout"
+		if !errors.Is(err, context.DeadlineExceeded) {
+			reason = "do_request"
+		}
+		return false, nil, err
 	}
 	defer func() { _ = response.Body.Close() }()
 
+	if response.StatusCode == http.StatusNotModified {
+		return true, nil, nil
+	}
+
 	// Read response body using a pooled reader to reduce allocations.
 	body := new(bytes.Buffer)
 	_, err = body.ReadFrom(response.Body)
 	if err != nil {
-		return nil, err
+		reason = "read_body"
+		return false, nil, err
 	}
 
-	return model.NewData(s.cfg, req.Path(), response.StatusCode, response.Header, body.Bytes()), nil
+	if rule := req.Rule(); rule != nil && rule.HTTPCache.Enabled {
+		directives := httpcache.ParseResponse(response.Header)
+		if !httpcache.IsStorable(directives, rule.HTTPCache.Strict) {
+			reason = "not_storable"
+			return false, nil, ErrNotStorable
+		}
+	}
+
+	return false, model.NewData(req.Rule(), response.StatusCode, response.Header, body.Bytes()), nil
+}
+
+// upstreamFetchErrorMetricName labels UpstreamFetchErrorsTotalMetricName with why the fetch failed,
+// so operators can tell a slow/unreachable origin (timeout, do_request) apart from one that's simply
+// not cacheable per its own Cache-Control (not_storable).
+func upstreamFetchErrorMetricName(reason string) string {
+	buf := make([]byte, 0, len(keyword.UpstreamFetchErrorsTotalMetricName)+len(reason)+12)
+	buf = append(buf, keyword.UpstreamFetchErrorsTotalMetricName...)
+	buf = append(buf, `{reason="`...)
+	buf = append(buf, reason...)
+	buf = append(buf, `"}`...)
+	return string(buf)
+}
+
+func upstreamThrottledMetricName(host string) string {
+	buf := make([]byte, 0, len(keyword.UpstreamThrottledTotalMetricName)+len(host)+10)
+	buf = append(buf, keyword.UpstreamThrottledTotalMetricName...)
+	buf = append(buf, `{host="`...)
+	buf = append(buf, host...)
+	buf = append(buf, `"}`...)
+	return string(buf)
+}
+
+func upstreamQueueDepthMetricName(host string) string {
+	buf := make([]byte, 0, len(keyword.UpstreamQueueDepthMetricName)+len(host)+10)
+	buf = append(buf, keyword.UpstreamQueueDepthMetricName...)
+	buf = append(buf, `{host="`...)
+	buf = append(buf, host...)
+	buf = append(buf, `"}`...)
+	return string(buf)
+}
+
+// effectiveRateLimit resolves the ratelimit.Config to apply for req's upstream host: Cache.Upstream
+// (Rate, plus RateLimit's Algorithm/Burst/ShedOnFull) with any non-zero field from rule's RateLimit
+// overriding it, matching RuleCompression's per-field fallback style.
+func effectiveRateLimit(cfg *config.Cache, rule *config.Rule) ratelimit.Config {
+	up := cfg.Cache.Upstream
+	out := ratelimit.Config{
+		Rate:       float64(up.Rate),
+		Burst:      up.RateLimit.Burst,
+		Algorithm:  up.RateLimit.Algorithm,
+		ShedOnFull: up.RateLimit.ShedOnFull,
+	}
+	if rule == nil {
+		return out
+	}
+	if rule.RateLimit.Rate != 0 {
+		out.Rate = float64(rule.RateLimit.Rate)
+	}
+	if rule.RateLimit.Burst != 0 {
+		out.Burst = rule.RateLimit.Burst
+	}
+	if rule.RateLimit.Algorithm != "" {
+		out.Algorithm = rule.RateLimit.Algorithm
+	}
+	if rule.RateLimit.ShedOnFull {
+		out.ShedOnFull = true
+	}
+	return out
 }
@@ -0,0 +1,67 @@
+// Package singleflight coalesces concurrent lookups for the same cache key into a single
+// upstream call, so a thundering herd of misses on a hot, not-yet-cached key only ever produces
+// one outbound request.
+package singleflight
+
+import (
+	"sync"
+
+	sharded "github.com/caddyserver/caddy/v2/pkg/storage/map"
+)
+
+// call is the in-flight (or just-finished) state shared by every follower waiting on a key.
+type call[T any] struct {
+	wg  sync.WaitGroup
+	val T
+	err error
+}
+
+// shard is one partition of the group's in-flight map, guarded by its own mutex so unrelated
+// keys never contend with each other.
+type shard[T any] struct {
+	mu    sync.Mutex
+	calls map[uint64]*call[T]
+}
+
+// Group deduplicates concurrent calls for the same key. It is sharded with the same shard count
+// as sharded.Map so its contention profile matches the rest of the storage layer.
+type Group[T any] struct {
+	shards [sharded.NumOfShards]*shard[T]
+}
+
+// New creates a ready-to-use Group.
+func New[T any]() *Group[T] {
+	g := &Group[T]{}
+	for i := range g.shards {
+		g.shards[i] = &shard[T]{calls: make(map[uint64]*call[T])}
+	}
+	return g
+}
+
+// Do executes fn for key, unless another goroutine is already doing so for the same key — in
+// that case the caller blocks until the in-flight call finishes and receives its result. shared
+// reports whether the result was produced by this call (false) or reused from a concurrent one (true).
+func (g *Group[T]) Do(key uint64, fn func() (T, error)) (val T, err error, shared bool) {
+	s := g.shards[sharded.MapShardKey(key)]
+
+	s.mu.Lock()
+	if c, ok := s.calls[key]; ok {
+		s.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+
+	c := new(call[T])
+	c.wg.Add(1)
+	s.calls[key] = c
+	s.mu.Unlock()
+
+	c.val, c.err = fn()
+	c.wg.Done()
+
+	s.mu.Lock()
+	delete(s.calls, key)
+	s.mu.Unlock()
+
+	return c.val, c.err, false
+}
@@ -0,0 +1,125 @@
+package singleflight
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupDoCoalescesConcurrentCalls(t *testing.T) {
+	g := New[int]()
+
+	var calls int64
+	var ready, release sync.WaitGroup
+	const followers = 8
+	ready.Add(followers)
+	release.Add(1)
+
+	results := make([]int, followers)
+	shared := make([]bool, followers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < followers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ready.Done()
+			val, err, sh := g.Do(42, func() (int, error) {
+				atomic.AddInt64(&calls, 1)
+				release.Wait()
+				return 7, nil
+			})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			results[i] = val
+			shared[i] = sh
+		}(i)
+	}
+
+	ready.Wait()
+	// Every goroutine is about to call Do; give them time to join the leader's in-flight call
+	// before it is released.
+	time.Sleep(50 * time.Millisecond)
+	release.Done()
+	wg.Wait()
+
+	if got := atomic.LoadInt64(&calls); got != 1 {
+		t.Fatalf("expected fn to run exactly once, ran %d times", got)
+	}
+
+	sharedCount := 0
+	for i := 0; i < followers; i++ {
+		if results[i] != 7 {
+			t.Fatalf("follower %d got val=%d, want 7", i, results[i])
+		}
+		if shared[i] {
+			sharedCount++
+		}
+	}
+	if sharedCount != followers-1 {
+		t.Fatalf("expected exactly %d followers to report shared=true, got %d", followers-1, sharedCount)
+	}
+}
+
+func TestGroupDoRunsAgainAfterPriorCallCompletes(t *testing.T) {
+	g := New[int]()
+
+	var calls int64
+	fn := func() (int, error) {
+		atomic.AddInt64(&calls, 1)
+		return 1, nil
+	}
+
+	if _, _, shared := g.Do(1, fn); shared {
+		t.Fatal("first call should not be reported as shared")
+	}
+	if _, _, shared := g.Do(1, fn); shared {
+		t.Fatal("a call after the prior one finished should run its own fn, not share")
+	}
+	if got := atomic.LoadInt64(&calls); got != 2 {
+		t.Fatalf("expected fn to run twice sequentially, ran %d times", got)
+	}
+}
+
+func TestGroupDoPropagatesError(t *testing.T) {
+	g := New[int]()
+	wantErr := errors.New("boom")
+
+	val, err, shared := g.Do(99, func() (int, error) {
+		return 0, wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("expected error %v, got %v", wantErr, err)
+	}
+	if val != 0 {
+		t.Fatalf("expected zero value on error, got %d", val)
+	}
+	if shared {
+		t.Fatal("the originating call should not be reported as shared")
+	}
+}
+
+func TestGroupDoDistinctKeysDoNotCoalesce(t *testing.T) {
+	g := New[int]()
+
+	var calls int64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(key uint64) {
+			defer wg.Done()
+			g.Do(key, func() (int, error) {
+				atomic.AddInt64(&calls, 1)
+				return int(key), nil
+			})
+		}(uint64(i))
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt64(&calls); got != 4 {
+		t.Fatalf("expected one fn call per distinct key, got %d", got)
+	}
+}
@@ -0,0 +1,196 @@
+// Package skiplist provides an indexed skip list: an online, weight-ordered structure that supports
+// O(log N) Insert/Delete and O(log N) Sample(offset) (the k-th heaviest entry by rank), via
+// per-level span counters -- the same order-statistics extension classic Redis-style skip lists use
+// for ZRANK/ZRANGE. It exists so a weight-ordered view of a changing population (e.g. cache shards
+// ranked by memory usage) can be kept continuously correct as weights change, instead of being
+// periodically rebuilt with a full sort.
+package skiplist
+
+import (
+	"math/rand/v2"
+	"sync"
+)
+
+const maxLevel = 32
+const p = 0.25
+
+// Node is an opaque handle into a List, returned by Insert and required by Delete.
+type Node[V any] struct {
+	value   V
+	weight  int64
+	id      uint64
+	forward []*Node[V]
+	span    []int
+}
+
+// Value returns the value stored at this node.
+func (n *Node[V]) Value() V {
+	return n.value
+}
+
+// List is a skip list ordered by descending weight (heaviest first), with id breaking ties so
+// equal-weight entries still have a well-defined total order. Safe for concurrent use.
+type List[V any] struct {
+	mu     sync.RWMutex
+	head   *Node[V]
+	level  int
+	length int
+}
+
+// New creates an empty List.
+func New[V any]() *List[V] {
+	return &List[V]{
+		head:  &Node[V]{forward: make([]*Node[V], maxLevel), span: make([]int, maxLevel)},
+		level: 1,
+	}
+}
+
+func randomLevel() int {
+	lvl := 1
+	for lvl < maxLevel && rand.Float64() < p {
+		lvl++
+	}
+	return lvl
+}
+
+// before reports whether (weight, id) sorts strictly before (otherWeight, otherID): higher weight
+// first, lower id breaking ties.
+func before(weight int64, id uint64, otherWeight int64, otherID uint64) bool {
+	if weight != otherWeight {
+		return weight > otherWeight
+	}
+	return id < otherID
+}
+
+// Insert adds value keyed by (weight, id) and returns the Node handle needed to Delete it later. id
+// must be unique across the list's lifetime (e.g. a shard index) so Delete can unambiguously locate
+// the right node even when weights collide.
+func (l *List[V]) Insert(weight int64, id uint64, value V) *Node[V] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	update := make([]*Node[V], maxLevel)
+	rank := make([]int, maxLevel)
+
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		if i == l.level-1 {
+			rank[i] = 0
+		} else {
+			rank[i] = rank[i+1]
+		}
+		for x.forward[i] != nil && before(x.forward[i].weight, x.forward[i].id, weight, id) {
+			rank[i] += x.span[i]
+			x = x.forward[i]
+		}
+		update[i] = x
+	}
+
+	lvl := randomLevel()
+	if lvl > l.level {
+		for i := l.level; i < lvl; i++ {
+			rank[i] = 0
+			update[i] = l.head
+			update[i].span[i] = l.length
+		}
+		l.level = lvl
+	}
+
+	node := &Node[V]{value: value, weight: weight, id: id, forward: make([]*Node[V], lvl), span: make([]int, lvl)}
+	for i := 0; i < lvl; i++ {
+		node.forward[i] = update[i].forward[i]
+		update[i].forward[i] = node
+		node.span[i] = update[i].span[i] - (rank[0] - rank[i])
+		update[i].span[i] = (rank[0] - rank[i]) + 1
+	}
+	for i := lvl; i < l.level; i++ {
+		update[i].span[i]++
+	}
+
+	l.length++
+	return node
+}
+
+// Delete removes node from the list. node must be a handle previously returned by Insert on this
+// same List and not already deleted; deleting it twice, or a node from a different List, is a no-op.
+func (l *List[V]) Delete(node *Node[V]) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	update := make([]*Node[V], maxLevel)
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && before(x.forward[i].weight, x.forward[i].id, node.weight, node.id) {
+			x = x.forward[i]
+		}
+		update[i] = x
+	}
+
+	target := x.forward[0]
+	if target != node {
+		return
+	}
+
+	for i := 0; i < l.level; i++ {
+		if update[i].forward[i] == target {
+			update[i].span[i] += target.span[i] - 1
+			update[i].forward[i] = target.forward[i]
+		} else {
+			update[i].span[i]--
+		}
+	}
+
+	for l.level > 1 && l.head.forward[l.level-1] == nil {
+		l.level--
+	}
+
+	l.length--
+}
+
+// Sample returns the offset-th heaviest value (0-based), or the zero value and false if offset is
+// out of range.
+func (l *List[V]) Sample(offset int) (value V, found bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if offset < 0 || offset >= l.length {
+		var zero V
+		return zero, false
+	}
+
+	rank := offset + 1 // the classic skip-list rank algorithm is 1-indexed
+	traversed := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && traversed+x.span[i] <= rank {
+			traversed += x.span[i]
+			x = x.forward[i]
+		}
+		if traversed == rank {
+			return x.value, true
+		}
+	}
+
+	var zero V
+	return zero, false
+}
+
+// Len returns the number of entries currently stored.
+func (l *List[V]) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.length
+}
+
+// Walk visits every value in descending-weight order until fn returns false or every entry has been
+// visited.
+func (l *List[V]) Walk(fn func(value V) bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for x := l.head.forward[0]; x != nil; x = x.forward[0] {
+		if !fn(x.value) {
+			return
+		}
+	}
+}
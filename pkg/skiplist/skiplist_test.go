@@ -0,0 +1,116 @@
+package skiplist
+
+import "testing"
+
+func TestListInsertOrdersByDescendingWeight(t *testing.T) {
+	l := New[string]()
+	l.Insert(10, 1, "ten")
+	l.Insert(30, 2, "thirty")
+	l.Insert(20, 3, "twenty")
+
+	want := []string{"thirty", "twenty", "ten"}
+	var got []string
+	l.Walk(func(v string) bool {
+		got = append(got, v)
+		return true
+	})
+
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestListInsertBreaksTiesByID(t *testing.T) {
+	l := New[string]()
+	l.Insert(10, 5, "b")
+	l.Insert(10, 1, "a")
+
+	first, ok := l.Sample(0)
+	if !ok || first != "a" {
+		t.Fatalf("expected lower id to rank first on equal weight, got %q (ok=%v)", first, ok)
+	}
+}
+
+func TestListSampleReturnsRankedEntries(t *testing.T) {
+	l := New[int]()
+	for i := 0; i < 10; i++ {
+		l.Insert(int64(i), uint64(i), i)
+	}
+
+	// Heaviest (id 9, weight 9) should be rank 0; lightest (id 0, weight 0) last.
+	if v, ok := l.Sample(0); !ok || v != 9 {
+		t.Fatalf("Sample(0) = %d, %v; want 9, true", v, ok)
+	}
+	if v, ok := l.Sample(9); !ok || v != 0 {
+		t.Fatalf("Sample(9) = %d, %v; want 0, true", v, ok)
+	}
+	if _, ok := l.Sample(10); ok {
+		t.Fatal("Sample(10) should be out of range for a 10-element list")
+	}
+	if _, ok := l.Sample(-1); ok {
+		t.Fatal("Sample(-1) should be out of range")
+	}
+}
+
+func TestListDeleteRemovesNodeAndUpdatesRanks(t *testing.T) {
+	l := New[string]()
+	nodeA := l.Insert(30, 1, "a")
+	l.Insert(20, 2, "b")
+	nodeC := l.Insert(10, 3, "c")
+
+	if got := l.Len(); got != 3 {
+		t.Fatalf("expected length 3 before delete, got %d", got)
+	}
+
+	l.Delete(nodeA)
+	if got := l.Len(); got != 2 {
+		t.Fatalf("expected length 2 after delete, got %d", got)
+	}
+	if v, ok := l.Sample(0); !ok || v != "b" {
+		t.Fatalf("expected \"b\" to become rank 0 after deleting the heaviest entry, got %q (ok=%v)", v, ok)
+	}
+
+	l.Delete(nodeC)
+	if got := l.Len(); got != 1 {
+		t.Fatalf("expected length 1 after second delete, got %d", got)
+	}
+
+	// Deleting an already-removed node must be a no-op, not a panic or a double-decrement.
+	l.Delete(nodeA)
+	if got := l.Len(); got != 1 {
+		t.Fatalf("expected length to stay 1 after re-deleting an already-removed node, got %d", got)
+	}
+}
+
+func TestListInsertDeleteManyPreservesOrder(t *testing.T) {
+	l := New[int]()
+	nodes := make([]*Node[int], 0, 100)
+	for i := 0; i < 100; i++ {
+		nodes = append(nodes, l.Insert(int64(i%17), uint64(i), i))
+	}
+
+	// Remove every third node and check the remainder is still correctly ranked.
+	for i := 0; i < len(nodes); i += 3 {
+		l.Delete(nodes[i])
+	}
+
+	var prevWeight int64 = 1 << 62
+	var prevID uint64
+	first := true
+	l.Walk(func(v int) bool {
+		weight := int64(v % 17)
+		id := uint64(v)
+		if !first {
+			if weight > prevWeight || (weight == prevWeight && id < prevID) {
+				t.Fatalf("list out of order at value %d (weight=%d) after prevWeight=%d prevID=%d", v, weight, prevWeight, prevID)
+			}
+		}
+		prevWeight, prevID, first = weight, id, false
+		return true
+	})
+}
@@ -0,0 +1,27 @@
+package coordinator
+
+import (
+	"context"
+
+	"github.com/caddyserver/caddy/v2/pkg/cluster"
+)
+
+// PeerCoordinator needs no network round-trip: it reuses the same consistent-hash ring that routes
+// cache misses (pkg/cluster), so the node that owns a key also owns refreshing it. Every
+// instance reaches the same Owner answer independently, so no coordination traffic is needed.
+type PeerCoordinator struct {
+	ring *cluster.Ring
+	self string
+}
+
+// NewPeerCoordinator builds a PeerCoordinator over the same peer list used for request routing.
+func NewPeerCoordinator(self string, ring *cluster.Ring) *PeerCoordinator {
+	return &PeerCoordinator{ring: ring, self: self}
+}
+
+// Acquire reports whether this instance owns key per the ring, i.e. whether it should be the one
+// to refresh it.
+func (c *PeerCoordinator) Acquire(_ context.Context, key uint64) bool {
+	owner := c.ring.Owner(key)
+	return owner == "" || owner == c.self
+}
@@ -0,0 +1,38 @@
+// Package coordinator provides storage.RefreshCoordinator implementations so several Caddy
+// instances sharing an origin elect at most one refresher per key instead of each independently
+// revalidating the same hot keys.
+package coordinator
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCoordinator takes a short-lived lease on a key (SET NX PX) before letting a node refresh
+// it. The first node to win the SETNX owns the refresh; everyone else's Acquire returns false
+// until the lease expires.
+type RedisCoordinator struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisCoordinator dials addr and builds a RedisCoordinator whose leases last ttl.
+func NewRedisCoordinator(addr string, ttl time.Duration) *RedisCoordinator {
+	return &RedisCoordinator{
+		client: redis.NewClient(&redis.Options{Addr: addr}),
+		ttl:    ttl,
+	}
+}
+
+// Acquire attempts to take the lease for key. Redis errors are treated as a failed acquisition
+// (the caller just skips the item this round) rather than surfaced as refresh errors.
+func (c *RedisCoordinator) Acquire(ctx context.Context, key uint64) bool {
+	ok, err := c.client.SetNX(ctx, "advanced_cache:refresh_lease:"+strconv.FormatUint(key, 36), 1, c.ttl).Result()
+	if err != nil {
+		return false
+	}
+	return ok
+}
@@ -0,0 +1,19 @@
+package storage
+
+import "net/http"
+
+// dumpEntry is the on-disk shape of one cached response inside a dump file. Its MarshalMsg/
+// UnmarshalMsg/Msgsize methods live in dump_entry_msgp.go. msgp can't generate http.Header/
+// [][2][]byte handling on its own, so that file is maintained by hand instead of via
+// `go generate` — keep it in sync when adding a field here.
+type dumpEntry struct {
+	Unique       string      `json:"unique"`
+	StatusCode   int         `json:"statusCode"`
+	Headers      http.Header `json:"headers"`
+	Body         []byte      `json:"body"`
+	Query        []byte      `json:"query"`
+	QueryHeaders [][2][]byte `json:"queryHeaders"`
+	Path         []byte      `json:"path"`
+	MapKey       uint64      `json:"mapKey"`
+	ShardKey     uint64      `json:"shardKey"`
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"net/http"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// MarshalMsg appends the msgpack encoding of z to b and returns the extended slice. Fields are
+// written as a fixed-size array (not a string-keyed map) since the schema is stable and array
+// encoding skips re-writing every field name on every record.
+func (z *dumpEntry) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	o = msgp.AppendArrayHeader(o, 9)
+	o = msgp.AppendString(o, z.Unique)
+	o = msgp.AppendInt(o, z.StatusCode)
+	o = msgp.AppendMapHeader(o, uint32(len(z.Headers)))
+	for hk, hv := range z.Headers {
+		o = msgp.AppendString(o, hk)
+		o = msgp.AppendArrayHeader(o, uint32(len(hv)))
+		for _, v := range hv {
+			o = msgp.AppendString(o, v)
+		}
+	}
+	o = msgp.AppendBytes(o, z.Body)
+	o = msgp.AppendBytes(o, z.Query)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.QueryHeaders)))
+	for _, kv := range z.QueryHeaders {
+		o = msgp.AppendBytes(o, kv[0])
+		o = msgp.AppendBytes(o, kv[1])
+	}
+	o = msgp.AppendBytes(o, z.Path)
+	o = msgp.AppendUint64(o, z.MapKey)
+	o = msgp.AppendUint64(o, z.ShardKey)
+	return o, nil
+}
+
+// UnmarshalMsg decodes a dumpEntry from the front of bts and returns the remaining bytes. z's
+// existing Body/Query/Path slices are reused as scratch space where their capacity allows;
+// Headers and QueryHeaders are allocated afresh on every call.
+func (z *dumpEntry) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var arrSz uint32
+	arrSz, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		return nil, err
+	}
+	if arrSz != 9 {
+		return nil, msgp.ArrayError{Wanted: 9, Got: arrSz}
+	}
+
+	z.Unique, bts, err = msgp.ReadStringBytes(bts)
+	if err != nil {
+		return nil, err
+	}
+	z.StatusCode, bts, err = msgp.ReadIntBytes(bts)
+	if err != nil {
+		return nil, err
+	}
+
+	var hdrSz uint32
+	hdrSz, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		return nil, err
+	}
+	z.Headers = make(http.Header, hdrSz)
+	for i := uint32(0); i < hdrSz; i++ {
+		var key string
+		key, bts, err = msgp.ReadStringBytes(bts)
+		if err != nil {
+			return nil, err
+		}
+		var valsSz uint32
+		valsSz, bts, err = msgp.ReadArrayHeaderBytes(bts)
+		if err != nil {
+			return nil, err
+		}
+		vals := make([]string, valsSz)
+		for j := range vals {
+			vals[j], bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				return nil, err
+			}
+		}
+		z.Headers[key] = vals
+	}
+
+	z.Body, bts, err = msgp.ReadBytesBytes(bts, z.Body[:0])
+	if err != nil {
+		return nil, err
+	}
+	z.Query, bts, err = msgp.ReadBytesBytes(bts, z.Query[:0])
+	if err != nil {
+		return nil, err
+	}
+
+	var qhSz uint32
+	qhSz, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	if err != nil {
+		return nil, err
+	}
+	z.QueryHeaders = make([][2][]byte, qhSz)
+	for i := range z.QueryHeaders {
+		z.QueryHeaders[i][0], bts, err = msgp.ReadBytesBytes(bts, nil)
+		if err != nil {
+			return nil, err
+		}
+		z.QueryHeaders[i][1], bts, err = msgp.ReadBytesBytes(bts, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	z.Path, bts, err = msgp.ReadBytesBytes(bts, z.Path[:0])
+	if err != nil {
+		return nil, err
+	}
+	z.MapKey, bts, err = msgp.ReadUint64Bytes(bts)
+	if err != nil {
+		return nil, err
+	}
+	z.ShardKey, bts, err = msgp.ReadUint64Bytes(bts)
+	if err != nil {
+		return nil, err
+	}
+
+	return bts, nil
+}
+
+// Msgsize returns an upper bound on the encoded size of z, used to size the buffer passed into
+// MarshalMsg so it grows at most once per record.
+func (z *dumpEntry) Msgsize() (s int) {
+	s = msgp.ArrayHeaderSize
+	s += msgp.StringPrefixSize + len(z.Unique)
+	s += msgp.IntSize
+	s += msgp.MapHeaderSize
+	for hk, hv := range z.Headers {
+		s += msgp.StringPrefixSize + len(hk)
+		s += msgp.ArrayHeaderSize
+		for _, v := range hv {
+			s += msgp.StringPrefixSize + len(v)
+		}
+	}
+	s += msgp.BytesPrefixSize + len(z.Body)
+	s += msgp.BytesPrefixSize + len(z.Query)
+	s += msgp.ArrayHeaderSize
+	for _, kv := range z.QueryHeaders {
+		s += msgp.BytesPrefixSize + len(kv[0])
+		s += msgp.BytesPrefixSize + len(kv[1])
+	}
+	s += msgp.BytesPrefixSize + len(z.Path)
+	s += msgp.Uint64Size * 2
+	return s
+}
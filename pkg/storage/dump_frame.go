@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// dumpFileMagic identifies a framed dump file; dumpFileVersion lets Load reject a file written by
+// an incompatible future/past layout instead of misinterpreting its bytes.
+const (
+	dumpFileMagic   uint32 = 0x43444d50 // "CDMP"
+	dumpFileVersion uint8  = 1
+	dumpHeaderSize         = 4 + 1 + 3 + 8 + 4 + 4 // magic + version + reserved + shardKey + entryCount + bodyCRC32C
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// dumpFileHeader is the fixed-size header written before a shard's length-prefixed msgpack
+// records. The 3 reserved bytes (currently zeroed) leave room for future per-file flags without
+// bumping dumpFileVersion.
+type dumpFileHeader struct {
+	Version    uint8
+	ShardKey   uint64
+	EntryCount uint32
+	BodyCRC32C uint32
+}
+
+func writeDumpFileHeader(w io.Writer, h dumpFileHeader) error {
+	buf := make([]byte, dumpHeaderSize)
+	binary.LittleEndian.PutUint32(buf[0:4], dumpFileMagic)
+	buf[4] = h.Version
+	// buf[5:8] reserved, left zeroed
+	binary.LittleEndian.PutUint64(buf[8:16], h.ShardKey)
+	binary.LittleEndian.PutUint32(buf[16:20], h.EntryCount)
+	binary.LittleEndian.PutUint32(buf[20:24], h.BodyCRC32C)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readDumpFileHeader(r io.Reader) (dumpFileHeader, error) {
+	buf := make([]byte, dumpHeaderSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return dumpFileHeader{}, fmt.Errorf("read dump file header: %w", err)
+	}
+	if magic := binary.LittleEndian.Uint32(buf[0:4]); magic != dumpFileMagic {
+		return dumpFileHeader{}, fmt.Errorf("bad dump file magic: %#x", magic)
+	}
+	h := dumpFileHeader{
+		Version:    buf[4],
+		ShardKey:   binary.LittleEndian.Uint64(buf[8:16]),
+		EntryCount: binary.LittleEndian.Uint32(buf[16:20]),
+		BodyCRC32C: binary.LittleEndian.Uint32(buf[20:24]),
+	}
+	if h.Version != dumpFileVersion {
+		return dumpFileHeader{}, fmt.Errorf("unsupported dump file version: %d", h.Version)
+	}
+	return h, nil
+}
+
+// writeDumpRecord appends a length-prefixed msgpack record to body, updating crc with the
+// record's payload bytes.
+func writeDumpRecord(body []byte, crc *uint32, payload []byte) []byte {
+	*crc = crc32.Update(*crc, crc32cTable, payload)
+	var lenBuf [4]byte
+	binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(payload)))
+	body = append(body, lenBuf[:]...)
+	body = append(body, payload...)
+	return body
+}
+
+// readDumpRecord reads one length-prefixed record from the front of body. On a truncated or
+// implausible length prefix, ok is false and the caller should stop (the rest of the stream can no
+// longer be trusted to be framed correctly); a record whose payload fails to decode still lets the
+// caller skip forward using rest, recovering the remaining records in the file.
+func readDumpRecord(body []byte) (payload, rest []byte, ok bool) {
+	if len(body) < 4 {
+		return nil, nil, false
+	}
+	n := binary.LittleEndian.Uint32(body[:4])
+	body = body[4:]
+	if uint64(n) > uint64(len(body)) {
+		return nil, nil, false
+	}
+	return body[:n], body[n:], true
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// dumpManifest is the small JSON sidecar written once per Dump cycle, next to that cycle's shard
+// files. Load uses the chain of manifests to find the newest full snapshot and replay its newer
+// deltas in order; an incremental Dump uses the previous manifest's Timestamp as the "since" cutoff
+// for which entries are new enough to belong in this cycle's delta.
+type dumpManifest struct {
+	Timestamp string `json:"timestamp"` // this cycle's file-name timestamp, same "20060102T150405" stamp as the shard files
+	Kind      string `json:"kind"`      // "full" or "delta"
+	// MinRevalidatedAt is the oldest RevalidatedAt (unix nanos) among entries this cycle actually
+	// wrote. It isn't used to pick the next cutoff (Timestamp is), but tells an operator how stale
+	// the oldest entry in this cycle was, which is useful when deciding whether a rebase (full
+	// dump) is overdue.
+	MinRevalidatedAt int64 `json:"minRevalidatedAt"`
+}
+
+func manifestPath(dir, name, timestamp string) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-manifest-%s.json", name, timestamp))
+}
+
+func writeManifestFile(dir, name, timestamp string, m dumpManifest) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("marshal dump manifest: %w", err)
+	}
+	return os.WriteFile(manifestPath(dir, name, timestamp), b, 0644)
+}
+
+func readManifestFile(path string) (dumpManifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return dumpManifest{}, fmt.Errorf("read dump manifest %s: %w", path, err)
+	}
+	var m dumpManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return dumpManifest{}, fmt.Errorf("decode dump manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// listManifests returns every manifest for name under dir, oldest to newest. The "20060102T150405"
+// timestamp embedded in each filename sorts lexicographically in the same order it sorts
+// chronologically, so a plain string sort is enough.
+func listManifests(dir, name string) ([]dumpManifest, error) {
+	files, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf("%s-manifest-*.json", name)))
+	if err != nil {
+		return nil, fmt.Errorf("glob dump manifests: %w", err)
+	}
+	sort.Strings(files)
+
+	manifests := make([]dumpManifest, 0, len(files))
+	for _, f := range files {
+		m, err := readManifestFile(f)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests, nil
+}
+
+// replayChain returns the suffix of manifests (oldest to newest) starting at the newest "full"
+// entry, which is exactly the sequence Load needs to apply in order: one full snapshot followed by
+// whichever deltas came after it.
+func replayChain(manifests []dumpManifest) []dumpManifest {
+	lastFull := -1
+	for i, m := range manifests {
+		if m.Kind == "full" {
+			lastFull = i
+		}
+	}
+	if lastFull == -1 {
+		return nil
+	}
+	return manifests[lastFull:]
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// dumpTombstone identifies one entry removed between two dump cycles. The evictor (and the
+// evacuator) push one of these for every successful Remove so an incremental Dump can record the
+// removal without having to re-scan every shard to notice an entry went missing.
+type dumpTombstone struct {
+	ShardKey uint64
+	MapKey   uint64
+}
+
+const tombstoneRingCapacity = 16384
+
+// tombstoneRing is a fixed-capacity ring buffer of dumpTombstone: Push never blocks the caller (the
+// eviction/evacuation hot path), and once full it simply overwrites the oldest entry, since the
+// only consequence of dropping a very old tombstone is that a delta written long after the removal
+// happened redundantly re-derives it from a later full snapshot instead.
+type tombstoneRing struct {
+	mu     sync.Mutex
+	buf    []dumpTombstone
+	head   int
+	length int
+}
+
+func newTombstoneRing(capacity int) *tombstoneRing {
+	return &tombstoneRing{buf: make([]dumpTombstone, capacity)}
+}
+
+func (r *tombstoneRing) Push(t dumpTombstone) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf[r.head] = t
+	r.head = (r.head + 1) % len(r.buf)
+	if r.length < len(r.buf) {
+		r.length++
+	}
+}
+
+// Drain returns every tombstone currently buffered, oldest first, and empties the ring.
+func (r *tombstoneRing) Drain() []dumpTombstone {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.length == 0 {
+		return nil
+	}
+	out := make([]dumpTombstone, r.length)
+	start := (r.head - r.length + len(r.buf)) % len(r.buf)
+	for i := 0; i < r.length; i++ {
+		out[i] = r.buf[(start+i)%len(r.buf)]
+	}
+	r.head, r.length = 0, 0
+	return out
+}
+
+// dumpTombstones collects removals for every Dump instance in the process. There is normally only
+// one per running CacheMiddleware, so a package-level ring (rather than threading a reference
+// through Evict/Evacuator/Dump) keeps pushDumpTombstone a one-line call at every removal site.
+var dumpTombstones = newTombstoneRing(tombstoneRingCapacity)
+
+func pushDumpTombstone(shardKey, mapKey uint64) {
+	dumpTombstones.Push(dumpTombstone{ShardKey: shardKey, MapKey: mapKey})
+}
+
+const (
+	tombstoneFileMagic   uint32 = 0x43445453 // "CDTS"
+	tombstoneFileVersion uint8  = 1
+	tombstoneRecordSize         = 16 // ShardKey + MapKey, both uint64
+)
+
+// writeTombstoneFile persists one dump cycle's drained tombstones as a tiny fixed-record file
+// (magic + version + count, then count*16 bytes), separate from the msgpack-framed shard files
+// since a tombstone carries none of a dumpEntry's variable-length fields.
+func writeTombstoneFile(w io.Writer, tombstones []dumpTombstone) error {
+	header := make([]byte, 4+1+4)
+	binary.LittleEndian.PutUint32(header[0:4], tombstoneFileMagic)
+	header[4] = tombstoneFileVersion
+	binary.LittleEndian.PutUint32(header[5:9], uint32(len(tombstones)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	buf := make([]byte, tombstoneRecordSize)
+	for _, t := range tombstones {
+		binary.LittleEndian.PutUint64(buf[0:8], t.ShardKey)
+		binary.LittleEndian.PutUint64(buf[8:16], t.MapKey)
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readTombstoneFile(r io.Reader) ([]dumpTombstone, error) {
+	header := make([]byte, 4+1+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("read tombstone file header: %w", err)
+	}
+	if magic := binary.LittleEndian.Uint32(header[0:4]); magic != tombstoneFileMagic {
+		return nil, fmt.Errorf("bad tombstone file magic: %#x", magic)
+	}
+	if version := header[4]; version != tombstoneFileVersion {
+		return nil, fmt.Errorf("unsupported tombstone file version: %d", version)
+	}
+	count := binary.LittleEndian.Uint32(header[5:9])
+
+	out := make([]dumpTombstone, count)
+	buf := make([]byte, tombstoneRecordSize)
+	for i := uint32(0); i < count; i++ {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("read tombstone record %d: %w", i, err)
+		}
+		out[i] = dumpTombstone{
+			ShardKey: binary.LittleEndian.Uint64(buf[0:8]),
+			MapKey:   binary.LittleEndian.Uint64(buf[8:16]),
+		}
+	}
+	return out, nil
+}
+
+// writeTombstoneFileAtomic writes tombstones to path via a temp file + rename, matching how Dump
+// writes shard files so a crash mid-write never leaves a half-written tombstone file behind.
+func writeTombstoneFileAtomic(path string, tombstones []dumpTombstone) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	if err := writeTombstoneFile(bw, tombstones); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -3,13 +3,12 @@ package storage
 import (
 	"bufio"
 	"context"
-	"encoding/gob"
 	"errors"
 	"fmt"
 	"github.com/caddyserver/caddy/v2/pkg/config"
 	"github.com/caddyserver/caddy/v2/pkg/repository"
+	"hash/crc32"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
@@ -23,24 +22,22 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// dumpTimestampLayout is the file-name timestamp shared by shard, tombstone, and manifest files
+// for one dump cycle. It sorts lexicographically in the same order it sorts chronologically.
+const dumpTimestampLayout = "20060102T150405"
+
 var dumpEntryPool = sync.Pool{
 	New: func() any { return new(dumpEntry) },
 }
 
-var dumpIsNotEnabledErr = errors.New("persistence mode is not enabled")
-
-type dumpEntry struct {
-	Unique       string      `json:"unique"`
-	StatusCode   int         `json:"statusCode"`
-	Headers      http.Header `json:"headers"`
-	Body         []byte      `json:"body"`
-	Query        []byte      `json:"query"`
-	QueryHeaders [][2][]byte `json:"queryHeaders"`
-	Path         []byte      `json:"path"`
-	MapKey       uint64      `json:"mapKey"`
-	ShardKey     uint64      `json:"shardKey"`
+// dumpMarshalBufPool reuses the scratch slice passed into dumpEntry.MarshalMsg across records, so
+// a shard with many entries only grows the buffer a handful of times instead of once per record.
+var dumpMarshalBufPool = sync.Pool{
+	New: func() any { b := make([]byte, 0, 1024); return &b },
 }
 
+var dumpIsNotEnabledErr = errors.New("persistence mode is not enabled")
+
 type Dumper interface {
 	Dump(ctx context.Context) error
 	Load(ctx context.Context) error
@@ -68,6 +65,14 @@ func NewDumper(
 }
 
 // Dump writes cache entries to disk based on the configured format and rotation policy.
+//
+// When cfg.Incremental is off, every cycle is a "full" snapshot, exactly as before. When it's on,
+// Dump looks up the previous cycle's manifest and, if one exists, writes a "delta" instead: only
+// entries whose RevalidatedAt is newer than that manifest's Timestamp are encoded, shards with
+// nothing new are skipped entirely, and entries removed since then (pushed onto dumpTombstones by
+// Evict/Evacuator) are recorded in a small tombstone file. The first cycle (or the first after
+// MaxFiles/MaxDeltas rotation removed every full) always falls back to a full snapshot so Load
+// never has to chain off of nothing.
 func (d *Dump) Dump(ctx context.Context) error {
 	cfg := d.cfg.Cache.Persistence.Dump
 	if !cfg.IsEnabled {
@@ -81,33 +86,60 @@ func (d *Dump) Dump(ctx context.Context) error {
 	}
 
 	// Use one common timestamp for all shard files
-	timestamp := time.Now().Format("20060102T150405")
+	timestamp := time.Now().Format(dumpTimestampLayout)
+
+	kind := "full"
+	var sinceRevalidatedAt time.Time
+	if cfg.Incremental {
+		if manifests, err := listManifests(cfg.Dir, cfg.Name); err == nil && len(manifests) > 0 {
+			prev := manifests[len(manifests)-1]
+			// A delta is only written while the newest full snapshot still has shard files on
+			// disk; once rotation has removed them, this cycle is a full one again.
+			var fullFiles []string
+			if chain := replayChain(manifests); len(chain) > 0 {
+				fullFiles, _ = filepath.Glob(fmt.Sprintf("%s/%s-shard-*-%s.dump", cfg.Dir, cfg.Name, chain[0].Timestamp))
+			}
+			if ts, parseErr := time.Parse(dumpTimestampLayout, prev.Timestamp); parseErr == nil && len(fullFiles) > 0 {
+				kind = "delta"
+				sinceRevalidatedAt = ts
+			}
+		}
+	}
+	ext := ".dump"
+	if kind == "delta" {
+		ext = ".delta"
+	}
 
 	// Parallel dump: each shard → separate file
 	var wg sync.WaitGroup
 	errCh := make(chan error, sharded.NumOfShards)
 
-	var successNum, errorNum int32
+	var (
+		successNum, errorNum, skippedNum int32
+		minRevalidatedAt                 int64 // unix nanos across everything written this cycle; 0 means nothing was written
+		minMu                            sync.Mutex
+	)
 
 	d.shardedMap.WalkShards(func(shardKey uint64, shard *sharded.Shard[*model.Response]) {
 		wg.Add(1)
 		go func(shardKey uint64, shard *sharded.Shard[*model.Response]) {
 			defer wg.Done()
 
-			filename := fmt.Sprintf("%s/%s-shard-%d-%s.dump", cfg.Dir, cfg.Name, shardKey, timestamp)
-			tmpName := filename + ".tmp"
+			bufPtr := dumpMarshalBufPool.Get().(*[]byte)
+			defer dumpMarshalBufPool.Put(bufPtr)
 
-			f, err := os.Create(tmpName)
-			if err != nil {
-				errCh <- fmt.Errorf("create dump temp file: %w", err)
-				return
-			}
-			defer f.Close()
-
-			bw := bufio.NewWriter(f)
-			enc := gob.NewEncoder(bw)
+			var (
+				body       []byte
+				entryCount uint32
+				bodyCRC32C uint32
+			)
 
 			shard.Walk(ctx, func(key uint64, resp *model.Response) bool {
+				if kind == "delta" && !resp.RevalidatedAt().After(sinceRevalidatedAt) {
+					atomic.AddInt32(&skippedNum, 1)
+					return true
+				}
+
 				e := dumpEntryPool.Get().(*dumpEntry)
 				*e = dumpEntry{
 					Unique:       fmt.Sprintf("%d-%d", shardKey, key),
@@ -121,19 +153,62 @@ func (d *Dump) Dump(ctx context.Context) error {
 					ShardKey:     resp.Request().ShardKey(),
 				}
 
-				if err := enc.Encode(e); err != nil {
+				payload, err := e.MarshalMsg((*bufPtr)[:0])
+				if err != nil {
 					log.Error().Err(err).Msg("[dump] entry encode error")
 					atomic.AddInt32(&errorNum, 1)
 					errCh <- err
 				} else {
+					body = writeDumpRecord(body, &bodyCRC32C, payload)
+					entryCount++
 					atomic.AddInt32(&successNum, 1)
+
+					revalidatedAtNano := resp.RevalidatedAt().UnixNano()
+					minMu.Lock()
+					if minRevalidatedAt == 0 || revalidatedAtNano < minRevalidatedAt {
+						minRevalidatedAt = revalidatedAtNano
+					}
+					minMu.Unlock()
 				}
+				*bufPtr = payload[:0]
 
 				*e = dumpEntry{}
 				dumpEntryPool.Put(e)
 				return true
 			}, true)
 
+			// A delta with nothing new in this shard writes no file at all — that's the whole
+			// point of incremental dumps. A full dump still writes every shard so Load always
+			// finds a complete baseline regardless of which shards happened to be empty/unchanged.
+			if entryCount == 0 && kind == "delta" {
+				return
+			}
+
+			filename := fmt.Sprintf("%s/%s-shard-%d-%s%s", cfg.Dir, cfg.Name, shardKey, timestamp, ext)
+			tmpName := filename + ".tmp"
+
+			f, err := os.Create(tmpName)
+			if err != nil {
+				errCh <- fmt.Errorf("create dump temp file: %w", err)
+				return
+			}
+			defer f.Close()
+
+			bw := bufio.NewWriter(f)
+			if err := writeDumpFileHeader(bw, dumpFileHeader{
+				Version:    dumpFileVersion,
+				ShardKey:   shardKey,
+				EntryCount: entryCount,
+				BodyCRC32C: bodyCRC32C,
+			}); err != nil {
+				errCh <- fmt.Errorf("write dump file header: %w", err)
+				return
+			}
+			if _, err := bw.Write(body); err != nil {
+				errCh <- fmt.Errorf("write dump body: %w", err)
+				return
+			}
+
 			bw.Flush()
 			if err := os.Rename(tmpName, filename); err != nil {
 				errCh <- fmt.Errorf("rename dump file: %w", err)
@@ -150,14 +225,45 @@ func (d *Dump) Dump(ctx context.Context) error {
 		}
 	}
 
-	// Rotate old groups AFTER a successful dump
+	// Flush whatever Evict/Evacuator pushed since the last cycle. A full dump already captures
+	// current state directly so older tombstones are moot, but draining regardless of kind keeps
+	// the ring from silently growing in a deployment that never turns Incremental on.
+	tombstones := dumpTombstones.Drain()
+	if kind == "delta" && len(tombstones) > 0 {
+		tombstoneFilename := fmt.Sprintf("%s/%s-tombstones-%s.delta", cfg.Dir, cfg.Name, timestamp)
+		if err := writeTombstoneFileAtomic(tombstoneFilename, tombstones); err != nil {
+			return fmt.Errorf("write tombstone file: %w", err)
+		}
+	}
+
+	if err := writeManifestFile(cfg.Dir, cfg.Name, timestamp, dumpManifest{
+		Timestamp:        timestamp,
+		Kind:             kind,
+		MinRevalidatedAt: minRevalidatedAt,
+	}); err != nil {
+		return fmt.Errorf("write dump manifest: %w", err)
+	}
+
+	// Rotate old groups AFTER a successful dump. Fulls and deltas rotate under separate budgets
+	// (MaxFiles, MaxDeltas) so a long run of cheap deltas doesn't crowd out the full snapshots
+	// Load needs as a baseline.
 	if cfg.RotatePolicy == "ring" {
 		if err := rotateOldFiles(cfg.Dir, cfg.Name, ".dump", cfg.MaxFiles); err != nil {
 			log.Error().Err(err).Msg("[dump] rotation error")
 		}
+		if cfg.Incremental {
+			maxDeltas := cfg.MaxDeltas
+			if maxDeltas <= 0 {
+				maxDeltas = cfg.MaxFiles
+			}
+			if err := rotateOldFiles(cfg.Dir, cfg.Name, ".delta", maxDeltas); err != nil {
+				log.Error().Err(err).Msg("[dump] delta rotation error")
+			}
+		}
 	}
 
-	log.Info().Msgf("[dump] finished writing %d entries, errors: %d (elapsed: %s)", successNum, errorNum, time.Since(start))
+	log.Info().Msgf("[dump][%s] finished writing %d entries, skipped %d unchanged, errors: %d (elapsed: %s)",
+		kind, successNum, skippedNum, errorNum, time.Since(start))
 	if errorNum > 0 {
 		return fmt.Errorf("dump completed with %d errors", errorNum)
 	}
@@ -165,6 +271,13 @@ func (d *Dump) Dump(ctx context.Context) error {
 }
 
 // Load restores cache entries from disk based on configuration.
+//
+// If manifests exist, Load replays the newest full snapshot followed by its newer deltas in order,
+// applying each delta's tombstones right after its entries so a key set by the full snapshot (or an
+// earlier delta) and later removed ends up absent, matching what actually happened on the instance
+// that wrote the dumps. Dumps written before incremental support existed have no manifest at all;
+// Load falls back to its original behavior of loading only the single latest-timestamp full
+// snapshot in that case.
 func (d *Dump) Load(ctx context.Context) error {
 	cfg := d.cfg.Cache.Persistence.Dump
 	if !cfg.IsEnabled {
@@ -172,27 +285,74 @@ func (d *Dump) Load(ctx context.Context) error {
 	}
 	start := time.Now()
 
-	// Find all dump shards
-	files, err := filepath.Glob(fmt.Sprintf("%s/%s-shard-*.dump", cfg.Dir, cfg.Name))
+	manifests, err := listManifests(cfg.Dir, cfg.Name)
 	if err != nil {
-		return fmt.Errorf("glob dump files: %w", err)
+		return err
+	}
+
+	var cycles []dumpManifest
+	if len(manifests) > 0 {
+		cycles = replayChain(manifests)
+		if len(cycles) == 0 {
+			return fmt.Errorf("no full dump manifest found in %s", cfg.Dir)
+		}
+	} else {
+		files, globErr := filepath.Glob(fmt.Sprintf("%s/%s-shard-*.dump", cfg.Dir, cfg.Name))
+		if globErr != nil {
+			return fmt.Errorf("glob dump files: %w", globErr)
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no dump files found in %s", cfg.Dir)
+		}
+		latestTs := extractLatestTimestamp(files)
+		if latestTs == "" {
+			return fmt.Errorf("no dump files found for latest timestamp in %s", cfg.Dir)
+		}
+		cycles = []dumpManifest{{Timestamp: latestTs, Kind: "full"}}
 	}
-	if len(files) == 0 {
-		return fmt.Errorf("no dump files found in %s", cfg.Dir)
+
+	var successNum, errorNum, removedNum int32
+	loaded := make(map[[2]uint64]*model.Response)
+
+	for _, cycle := range cycles {
+		ext := ".dump"
+		if cycle.Kind == "delta" {
+			ext = ".delta"
+		}
+		if err := d.loadCycle(ctx, cfg, cycle.Timestamp, ext, loaded, &successNum, &errorNum); err != nil {
+			return err
+		}
+		if cycle.Kind == "delta" {
+			if err := d.applyTombstones(cfg, cycle.Timestamp, loaded, &removedNum); err != nil {
+				return err
+			}
+		}
 	}
 
-	// Extract the latest timestamp and filter files
-	latestTs := extractLatestTimestamp(files)
-	filesToLoad := filterFilesByTimestamp(files, latestTs)
-	if len(filesToLoad) == 0 {
-		return fmt.Errorf("no dump files found for latest timestamp %s", latestTs)
+	log.Info().Msgf("[dump] restored %d entries, removed %d via tombstones, errors: %d (elapsed: %s)",
+		successNum, removedNum, errorNum, time.Since(start))
+	if errorNum > 0 {
+		return fmt.Errorf("load completed with %d errors", errorNum)
 	}
+	return nil
+}
 
-	var wg sync.WaitGroup
-	errCh := make(chan error, len(filesToLoad))
-	var successNum, errorNum int32
+// loadCycle loads every shard file belonging to one dump cycle (a full snapshot or a delta) and
+// Sets each decoded entry, recording it in loaded so a later cycle's tombstones in the same Load
+// call can find and remove it again.
+func (d *Dump) loadCycle(ctx context.Context, cfg config.Dump, timestamp, ext string, loaded map[[2]uint64]*model.Response, successNum, errorNum *int32) error {
+	files, err := filepath.Glob(fmt.Sprintf("%s/%s-shard-*-%s%s", cfg.Dir, cfg.Name, timestamp, ext))
+	if err != nil {
+		return fmt.Errorf("glob dump files: %w", err)
+	}
 
-	for _, file := range filesToLoad {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		errCh = make(chan error, len(files))
+	)
+
+	for _, file := range files {
 		wg.Add(1)
 		go func(file string) {
 			defer wg.Done()
@@ -204,35 +364,64 @@ func (d *Dump) Load(ctx context.Context) error {
 			}
 			defer f.Close()
 
-			dec := gob.NewDecoder(bufio.NewReader(f)) // 400KB buffer
+			r := bufio.NewReader(f)
+			header, err := readDumpFileHeader(r)
+			if err != nil {
+				errCh <- fmt.Errorf("%s: %w", file, err)
+				return
+			}
+
+			body, err := io.ReadAll(r)
+			if err != nil {
+				errCh <- fmt.Errorf("read dump body %s: %w", file, err)
+				return
+			}
+			if crc32.Checksum(body, crc32cTable) != header.BodyCRC32C {
+				// Don't abort: a single flipped bit shouldn't cost the whole shard when per-record
+				// recovery below can salvage everything except the records it actually corrupted.
+				log.Warn().Str("file", file).Msg("[dump] body CRC32C mismatch, attempting per-record recovery")
+			}
+
 		loop:
-			for {
+			for i := uint32(0); i < header.EntryCount; i++ {
 				select {
 				case <-ctx.Done():
 					return
 				default:
-					entry := dumpEntryPool.Get().(*dumpEntry)
-					if err = dec.Decode(entry); err == io.EOF {
-						dumpEntryPool.Put(entry)
+					payload, rest, ok := readDumpRecord(body)
+					if !ok {
+						log.Error().Str("file", file).Msg("[dump] truncated record framing, stopping shard")
+						atomic.AddInt32(errorNum, 1)
 						break loop
-					} else if err != nil {
+					}
+					body = rest
+
+					entry := dumpEntryPool.Get().(*dumpEntry)
+					if _, err := entry.UnmarshalMsg(payload); err != nil {
 						log.Error().Err(err).Msg("[dump] entry decode error")
 						dumpEntryPool.Put(entry)
-						atomic.AddInt32(&errorNum, 1)
-						break loop
+						atomic.AddInt32(errorNum, 1)
+						continue loop
 					}
 
 					resp, err := d.buildResponseFromEntry(entry)
 					if err != nil {
 						log.Error().Err(err).Msg("[dump] response build failed")
 						dumpEntryPool.Put(entry)
-						atomic.AddInt32(&errorNum, 1)
+						atomic.AddInt32(errorNum, 1)
 						continue loop
 					}
 
 					d.storage.Set(resp)
+					mu.Lock()
+					loaded[[2]uint64{entry.ShardKey, entry.MapKey}] = resp
+					mu.Unlock()
+
+					// resp's Request/Data hold entry's Body/Query/Path slices, so they must not be
+					// handed to the next UnmarshalMsg as scratch space.
+					*entry = dumpEntry{}
 					dumpEntryPool.Put(entry)
-					atomic.AddInt32(&successNum, 1)
+					atomic.AddInt32(successNum, 1)
 				}
 			}
 		}(file)
@@ -240,10 +429,40 @@ func (d *Dump) Load(ctx context.Context) error {
 
 	wg.Wait()
 	close(errCh)
+	for err := range errCh {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	log.Info().Msgf("[dump] restored %d entries, errors: %d (elapsed: %s)", successNum, errorNum, time.Since(start))
-	if errorNum > 0 {
-		return fmt.Errorf("load completed with %d errors", errorNum)
+// applyTombstones removes every entry this cycle's tombstone file names, but only those present in
+// loaded (i.e. set by this same Load call's full snapshot or an earlier delta); a tombstone for a
+// key that never appeared anywhere in the replayed chain needs no action.
+func (d *Dump) applyTombstones(cfg config.Dump, timestamp string, loaded map[[2]uint64]*model.Response, removedNum *int32) error {
+	path := fmt.Sprintf("%s/%s-tombstones-%s.delta", cfg.Dir, cfg.Name, timestamp)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open tombstone file: %w", err)
+	}
+	defer f.Close()
+
+	tombstones, err := readTombstoneFile(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, t := range tombstones {
+		key := [2]uint64{t.ShardKey, t.MapKey}
+		if resp, ok := loaded[key]; ok {
+			d.storage.Remove(resp)
+			delete(loaded, key)
+			*removedNum++
+		}
 	}
 	return nil
 }
@@ -251,7 +470,7 @@ func (d *Dump) Load(ctx context.Context) error {
 func (d *Dump) buildResponseFromEntry(entry *dumpEntry) (*model.Response, error) {
 	req := model.NewRawRequest(d.cfg, entry.MapKey, entry.ShardKey, entry.Query, entry.Path, entry.QueryHeaders)
 	data := model.NewData(req.Rule(), entry.StatusCode, entry.Headers, entry.Body)
-	resp, err := model.NewResponse(data, req, d.cfg, d.backend.RevalidatorMaker(req))
+	resp, err := model.NewResponse(data, req, d.cfg, d.backend.RevalidatorMaker(req), d.backend.ConditionalRevalidatorMaker(req))
 	if err != nil {
 		return nil, err
 	}
@@ -281,18 +500,8 @@ func extractLatestTimestamp(files []string) string {
 	return timestamps[len(timestamps)-1]
 }
 
-func filterFilesByTimestamp(files []string, ts string) []string {
-	var result []string
-	for _, f := range files {
-		if strings.Contains(f, ts) {
-			result = append(result, f)
-		}
-	}
-	return result
-}
-
 func getDumpFiles(dir, baseName, ext string) ([]string, error) {
-	pattern := filepath.Join(dir, baseName+".*"+ext)
+	pattern := filepath.Join(dir, baseName+"-*"+ext)
 	files, err := filepath.Glob(pattern)
 	if err != nil {
 		return nil, err
@@ -323,6 +532,10 @@ func sortByModTime(files []string) ([]string, error) {
 	return sorted, nil
 }
 
+// rotateOldFiles keeps the maxFiles most recently modified files matching baseName+"-*"+ext under
+// dir, removing the rest. Dump calls this once for full snapshots (ext ".dump", budget MaxFiles)
+// and, when Incremental is on, once more for deltas (ext ".delta", budget MaxDeltas) so the two
+// tiers rotate independently.
 func rotateOldFiles(dir, baseName, ext string, maxFiles int) error {
 	files, err := getDumpFiles(dir, baseName, ext)
 	if err != nil {
@@ -332,7 +545,7 @@ func rotateOldFiles(dir, baseName, ext string, maxFiles int) error {
 	if err != nil {
 		return err
 	}
-	if len(sorted) < maxFiles {
+	if maxFiles <= 0 || len(sorted) < maxFiles {
 		return nil
 	}
 	numToRemove := len(sorted) - (maxFiles - 1)
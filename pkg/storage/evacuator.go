@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/caddyserver/caddy/v2/pkg/config"
+	"github.com/caddyserver/caddy/v2/pkg/model"
+	"github.com/caddyserver/caddy/v2/pkg/prometheus/metrics/keyword"
+	"github.com/caddyserver/caddy/v2/pkg/storage/lru"
+	"github.com/rs/zerolog/log"
+)
+
+// EvacuationScope selects which entries of a targeted Shard are eligible to be drained.
+// Unlike Evict (which only cares about freeing Weight), an evacuation run may need to leave most
+// of a shard untouched, e.g. when only expired or non-200 entries should move off a node.
+type EvacuationScope string
+
+const (
+	EvacuationScopeAll     EvacuationScope = "all"            // every entry in the shard
+	EvacuationScopeExpired EvacuationScope = "expired"        // entries whose rule/default TTL has elapsed since RevalidatedAt
+	EvacuationScopeRule    EvacuationScope = "rule"           // entries whose matched config.Rule.Path equals EvacuationRequest.RulePath
+	EvacuationScopeNotOK   EvacuationScope = "status-not-200" // entries whose cached StatusCode() isn't http.StatusOK
+)
+
+// EvacuationSink receives every entry drained out of a shard. Implementations may forward it to a
+// remote peer, append it to a dump file (see Dump), or discard it outright; DiscardSink covers the
+// last case so callers aren't forced to write a no-op themselves.
+type EvacuationSink interface {
+	Send(ctx context.Context, resp *model.Response) error
+}
+
+// DiscardSink is an EvacuationSink that drops everything it receives, the /dev/null case: the
+// operator only wants the shard emptied and doesn't care where the entries end up.
+type DiscardSink struct{}
+
+func (DiscardSink) Send(_ context.Context, _ *model.Response) error { return nil }
+
+// EvacuationRequest describes one evacuation run.
+type EvacuationRequest struct {
+	ShardIDs             []uint64        // shards to drain
+	Scope                EvacuationScope // which entries within each shard are eligible; zero value behaves like EvacuationScopeAll
+	RulePath             string          // only consulted when Scope == EvacuationScopeRule
+	ContainerWorkerCount int             // shard-level parallelism: how many shards are drained at once
+	ObjectWorkerCount    int             // per-shard parallelism: how many entries of one shard are handed to Sink at once
+	IgnoreErrors         bool            // keep draining past a Sink error instead of stopping the shard; the failed entry is already removed either way
+	Await                bool            // block Start until the run finishes instead of returning immediately
+	Sink                 EvacuationSink  // destination for drained entries; defaults to DiscardSink when nil
+}
+
+// EvacuationProgressSnapshot is a point-in-time copy of an EvacuationProgress, safe to hand to an
+// admin/metrics caller without exposing the live atomics underneath.
+type EvacuationProgressSnapshot struct {
+	EntriesTotal int64
+	EntriesDone  int64
+	Errors       int64
+	FreedBytes   int64
+	Running      bool
+}
+
+// EvacuationProgress tracks one run's counters. Every field is only ever touched via atomics so
+// Snapshot can be called from an admin endpoint while workers are still draining.
+type EvacuationProgress struct {
+	entriesTotal int64
+	entriesDone  int64
+	errors       int64
+	freedBytes   int64
+	running      int32
+}
+
+func (p *EvacuationProgress) Snapshot() EvacuationProgressSnapshot {
+	return EvacuationProgressSnapshot{
+		EntriesTotal: atomic.LoadInt64(&p.entriesTotal),
+		EntriesDone:  atomic.LoadInt64(&p.entriesDone),
+		Errors:       atomic.LoadInt64(&p.errors),
+		FreedBytes:   atomic.LoadInt64(&p.freedBytes),
+		Running:      atomic.LoadInt32(&p.running) == 1,
+	}
+}
+
+var errEvacuationAlreadyRunning = errors.New("evacuation already running")
+
+// Evacuator is Evict's sibling: instead of continuously draining whatever shards are most loaded
+// until Storage drops under a memory threshold, it drains an operator-selected set of shards on
+// demand, modeled on FrostFS's shard evacuation. Typical uses are draining a node before shutdown
+// or rebalancing shard placement after resharding, neither of which should wait for the normal
+// threshold-driven eviction path to kick in.
+type Evacuator struct {
+	ctx      context.Context
+	cfg      *config.Cache
+	db       Storage
+	balancer lru.Balancer
+
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	progress *EvacuationProgress
+}
+
+func NewEvacuator(ctx context.Context, cfg *config.Cache, db Storage, balancer lru.Balancer) *Evacuator {
+	return &Evacuator{
+		ctx:      ctx,
+		cfg:      cfg,
+		db:       db,
+		balancer: balancer,
+		progress: &EvacuationProgress{},
+	}
+}
+
+// Start begins draining req.ShardIDs according to req.Scope. Only one run may be in flight at a
+// time; calling Start again before the previous run finishes (or is Stop-ped) returns
+// errEvacuationAlreadyRunning. If req.Await is false, Start returns immediately and the caller
+// polls Progress for completion.
+func (e *Evacuator) Start(ctx context.Context, req EvacuationRequest) (*EvacuationProgressSnapshot, error) {
+	e.mu.Lock()
+	if e.cancel != nil {
+		e.mu.Unlock()
+		return nil, errEvacuationAlreadyRunning
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	e.cancel = cancel
+	progress := &EvacuationProgress{running: 1}
+	e.progress = progress
+	e.mu.Unlock()
+
+	sink := req.Sink
+	if sink == nil {
+		sink = DiscardSink{}
+	}
+	containerWorkers := req.ContainerWorkerCount
+	if containerWorkers <= 0 {
+		containerWorkers = 1
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer atomic.StoreInt32(&progress.running, 0)
+		defer func() {
+			e.mu.Lock()
+			e.cancel = nil
+			e.mu.Unlock()
+		}()
+
+		var wg sync.WaitGroup
+		shardSema := make(chan struct{}, containerWorkers)
+		for _, shardID := range req.ShardIDs {
+			select {
+			case <-runCtx.Done():
+				wg.Wait()
+				e.report(progress)
+				return
+			case shardSema <- struct{}{}:
+			}
+			wg.Add(1)
+			go func(shardID uint64) {
+				defer wg.Done()
+				defer func() { <-shardSema }()
+				e.drainShard(runCtx, shardID, req, sink, progress)
+			}(shardID)
+		}
+		wg.Wait()
+		e.report(progress)
+	}()
+
+	if req.Await {
+		<-done
+	}
+	snap := progress.Snapshot()
+	return &snap, nil
+}
+
+// drainShard removes every in-scope entry from one shard's Storage list, one at a time (so the
+// shardedMap/balancer accounting is never inconsistent with what's left in the list), and fans the
+// now-detached entries out to req.Sink across up to req.ObjectWorkerCount concurrent deliveries.
+func (e *Evacuator) drainShard(ctx context.Context, shardID uint64, req EvacuationRequest, sink EvacuationSink, progress *EvacuationProgress) {
+	shards := e.balancer.Shards()
+	if shardID >= uint64(len(shards)) || shards[shardID] == nil {
+		return
+	}
+	shard := shards[shardID].Shard
+
+	objectWorkers := req.ObjectWorkerCount
+	if objectWorkers <= 0 {
+		objectWorkers = 1
+	}
+
+	// shardCtx is cancelled the moment a delivery fails and req.IgnoreErrors is false, so the
+	// producer loop below stops pulling new entries off this shard instead of continuing to drain
+	// it into a sink that's already failing.
+	shardCtx, abort := context.WithCancel(ctx)
+	defer abort()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, objectWorkers)
+
+	offset := 0
+	for {
+		select {
+		case <-shardCtx.Done():
+			wg.Wait()
+			return
+		default:
+		}
+
+		resp, ok := shard.Next(offset)
+		if !ok {
+			break
+		}
+		if !matchesEvacuationScope(resp, req, e.cfg) {
+			offset++
+			continue
+		}
+
+		// Removing now (rather than after Sink.Send) keeps the list/shardedMap authoritative
+		// about what's still cached; a Sink failure only affects delivery, not occupancy.
+		atomic.AddInt64(&progress.entriesTotal, 1)
+		freedBytes, isHit := e.db.Remove(resp)
+		if !isHit {
+			continue
+		}
+		atomic.AddInt64(&progress.freedBytes, freedBytes)
+		pushDumpTombstone(resp.ShardKey(), resp.MapKey())
+
+		select {
+		case sem <- struct{}{}:
+		case <-shardCtx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(resp *model.Response) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := sink.Send(ctx, resp); err != nil {
+				atomic.AddInt64(&progress.errors, 1)
+				log.Error().Err(err).Msg("[evacuation] sink delivery error")
+				if !req.IgnoreErrors {
+					abort()
+				}
+				return
+			}
+			atomic.AddInt64(&progress.entriesDone, 1)
+		}(resp)
+	}
+	wg.Wait()
+}
+
+// matchesEvacuationScope reports whether resp should be drained under req.Scope.
+func matchesEvacuationScope(resp *model.Response, req EvacuationRequest, cfg *config.Cache) bool {
+	switch req.Scope {
+	case EvacuationScopeExpired:
+		ttl := cfg.Cache.Refresh.TTL
+		if rule := resp.Request().Rule(); rule != nil && rule.TTL != 0 {
+			ttl = rule.TTL
+		}
+		return time.Since(resp.RevalidatedAt()) > ttl
+	case EvacuationScopeRule:
+		rule := resp.Request().Rule()
+		return rule != nil && rule.Path == req.RulePath
+	case EvacuationScopeNotOK:
+		return resp.Data().StatusCode() != http.StatusOK
+	default: // EvacuationScopeAll and unset Scope
+		return true
+	}
+}
+
+// report publishes a finished (or stopped) run's counters as metrics, the same mechanism an admin
+// scrape endpoint already uses for cache_hits_total/cache_evictions_total/etc.
+func (e *Evacuator) report(progress *EvacuationProgress) {
+	snap := progress.Snapshot()
+	metrics.GetOrCreateCounter(keyword.CacheEvacuationEntriesTotalMetricName).Set(uint64(snap.EntriesTotal))
+	metrics.GetOrCreateCounter(keyword.CacheEvacuationEntriesDoneMetricName).Set(uint64(snap.EntriesDone))
+	metrics.GetOrCreateCounter(keyword.CacheEvacuationErrorsMetricName).Set(uint64(snap.Errors))
+	metrics.GetOrCreateCounter(keyword.CacheEvacuationFreedBytesMetricName).Set(uint64(snap.FreedBytes))
+	log.Info().Msgf("[evacuation] finished: total=%d done=%d errors=%d freedBytes=%d", snap.EntriesTotal, snap.EntriesDone, snap.Errors, snap.FreedBytes)
+}
+
+// Stop cancels the in-flight run, if any. Workers finish whichever Sink.Send/Remove call they're
+// already on and exit; Progress keeps reporting what was drained before Stop was called.
+func (e *Evacuator) Stop() {
+	e.mu.Lock()
+	cancel := e.cancel
+	e.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Reset clears the counters from the last finished run so the next Start begins from zero. It is a
+// no-op while a run is still in flight — Stop it first.
+func (e *Evacuator) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cancel != nil {
+		return
+	}
+	e.progress = &EvacuationProgress{}
+}
+
+// Progress returns a snapshot of the current (or most recently finished) run.
+func (e *Evacuator) Progress() EvacuationProgressSnapshot {
+	e.mu.Lock()
+	p := e.progress
+	e.mu.Unlock()
+	return p.Snapshot()
+}
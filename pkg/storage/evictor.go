@@ -9,10 +9,20 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/caddyserver/caddy/v2/pkg/prometheus/metrics/keyword"
 	sharded "github.com/caddyserver/caddy/v2/pkg/storage/map"
+	"github.com/caddyserver/caddy/v2/pkg/telemetry"
 	"github.com/caddyserver/caddy/v2/pkg/utils"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// reasonThreshold is the only eviction reason this module currently produces (Weight usage at or
+// above Cache.Eviction.Threshold); it's still labeled, rather than left bare, so a future second
+// reason (e.g. a TTL-driven sweep) slots into the same cache_evictions_by_reason_total series
+// without a metric rename.
+const reasonThreshold = "threshold"
+
 var (
 	_maxShards          = float64(sharded.NumOfShards)
 	fatShardsPercentage = int(_maxShards * 0.17)
@@ -35,6 +45,7 @@ type Evict struct {
 	cfg             *config.Cache
 	db              Storage
 	balancer        lru.Balancer
+	tracer          telemetry.Tracer
 	memoryThreshold int64
 }
 
@@ -44,6 +55,7 @@ func NewEvictor(ctx context.Context, cfg *config.Cache, db Storage, balancer lru
 		cfg:             cfg,
 		db:              db,
 		balancer:        balancer,
+		tracer:          telemetry.New(cfg.Cache.Telemetry.TracingEnabled, "storage.Evict"),
 		memoryThreshold: int64(float64(cfg.Cache.Storage.Size) * cfg.Cache.Eviction.Threshold),
 	}
 }
@@ -62,8 +74,13 @@ func (e *Evict) run() {
 		case <-e.ctx.Done():
 			return
 		case <-t:
+			_, span := e.tracer.Start(e.ctx, "cache.evict", attribute.String("reason", reasonThreshold))
 			items, freedMem := e.evictUntilWithinLimit()
+			span.SetAttributes(attribute.Int("items", items), attribute.Int64("freedBytes", freedMem))
+			span.End()
+
 			if items > 0 || freedMem > 0 {
+				metrics.GetOrCreateCounter(evictionsByReasonMetricName(reasonThreshold)).Add(items)
 				select {
 				case <-e.ctx.Done():
 					return
@@ -101,23 +118,24 @@ func (e *Evict) evictUntilWithinLimit() (items int, mem int64) {
 			continue
 		}
 
-		if shard.LruList().Len() == 0 {
+		if shard.Shard.Len() == 0 {
 			continue
 		}
 
 		offset := 0
 		evictions := 0
 		for e.shouldEvictRightNow() {
-			el, ok := shard.LruList().Next(offset)
+			victim, ok := shard.Shard.Next(offset)
 			if !ok {
 				break
 			}
 
-			freedMem, isHit := e.db.Remove(el.Value())
+			freedMem, isHit := e.db.Remove(victim)
 			if isHit {
 				items++
 				evictions++
 				mem += freedMem
+				pushDumpTombstone(victim.ShardKey(), victim.MapKey())
 			}
 
 			offset++
@@ -126,6 +144,13 @@ func (e *Evict) evictUntilWithinLimit() (items int, mem int64) {
 	return
 }
 
+// evictionsByReasonMetricName builds a cache_evictions_by_reason_total{reason="..."} series name,
+// matching the {label="value"} convention pkg/storage/invalidation's published/consumed/reclaimed
+// metric names already use for the same reason.
+func evictionsByReasonMetricName(reason string) string {
+	return keyword.CacheEvictionsByReasonMetricName + `{reason="` + reason + `"}`
+}
+
 // runLogger emits detailed stats about evictions, Weight, and GC activity every 5 seconds if debugging is enabled.
 func (e *Evict) runLogger() {
 	go func() {
@@ -0,0 +1,66 @@
+package invalidation
+
+import "encoding/binary"
+
+// bloomBits sizes the filter Resync publishes: large enough that a node holding a few million
+// keys still keeps a low false-positive rate, small enough that the encoded filter comfortably
+// fits in one Redis Streams field.
+const bloomBits = 1 << 20 // 2^20 bits = 128KiB, two hash probes per key
+
+// bloom is a small, fixed-size two-hash Bloom filter, snapshot-able to/from bytes so Resync can
+// ship it as one Redis Streams field. Unlike pkg/storage/lfu's doorkeeper (which exists purely for
+// in-process admission and is never serialized), this one is built fresh per Resync call and only
+// ever read by peers, never mutated after bytes() is called.
+type bloom struct {
+	bits []uint64
+}
+
+func newBloom() *bloom {
+	return &bloom{bits: make([]uint64, bloomBits/64)}
+}
+
+func (b *bloom) add(key uint64) {
+	h1, h2 := splitHash(key)
+	b.set(h1 % bloomBits)
+	b.set(h2 % bloomBits)
+}
+
+func (b *bloom) test(key uint64) bool {
+	h1, h2 := splitHash(key)
+	return b.get(h1%bloomBits) && b.get(h2%bloomBits)
+}
+
+func (b *bloom) set(pos uint64) {
+	b.bits[pos/64] |= 1 << (pos % 64)
+}
+
+func (b *bloom) get(pos uint64) bool {
+	return b.bits[pos/64]&(1<<(pos%64)) != 0
+}
+
+// splitHash derives two independent-enough probe positions from a single xxh3 key hash (the same
+// hash model.Request.MapKey() already produces), avoiding a second hash pass per key.
+func splitHash(key uint64) (uint64, uint64) {
+	h1 := key ^ (key >> 33)
+	h2 := (key * 0x9E3779B97F4A7C15) ^ (key >> 29)
+	return h1, h2
+}
+
+func (b *bloom) bytes() []byte {
+	buf := make([]byte, len(b.bits)*8)
+	for i, word := range b.bits {
+		binary.LittleEndian.PutUint64(buf[i*8:], word)
+	}
+	return buf
+}
+
+func bloomFromBytes(data []byte) *bloom {
+	b := newBloom()
+	for i := range b.bits {
+		if (i+1)*8 > len(data) {
+			break
+		}
+		b.bits[i] = binary.LittleEndian.Uint64(data[i*8:])
+	}
+	return b
+}
@@ -0,0 +1,82 @@
+package invalidation
+
+import (
+	"context"
+
+	"github.com/caddyserver/caddy/v2/pkg/model"
+	"github.com/caddyserver/caddy/v2/pkg/storage"
+)
+
+// Storage wraps a storage.Storage so every successful Remove also publishes a purge event via its
+// Coordinator, letting every other node in the cluster apply the same removal.
+type Storage struct {
+	next        storage.Storage
+	coordinator *Coordinator
+}
+
+// Wrap decorates next with cross-instance purge broadcast via coordinator.
+func Wrap(next storage.Storage, coordinator *Coordinator) *Storage {
+	return &Storage{next: next, coordinator: coordinator}
+}
+
+var _ storage.Storage = (*Storage)(nil)
+
+func (s *Storage) Run()                           { s.next.Run() }
+func (s *Storage) Ping(ctx context.Context) error { return s.next.Ping(ctx) }
+
+func (s *Storage) Get(req *model.Request) (*model.Response, bool) { return s.next.Get(req) }
+
+func (s *Storage) GetOrLoad(req *model.Request, loader func() (*model.Response, error)) (*model.Response, bool, error) {
+	return s.next.GetOrLoad(req, loader)
+}
+
+func (s *Storage) GetRandom() (*model.Response, bool) { return s.next.GetRandom() }
+
+func (s *Storage) Set(resp *model.Response) { s.next.Set(resp) }
+
+// Remove removes resp locally first, then — only on an actual hit — publishes the purge so peers
+// don't redo work for a key this node never even had.
+func (s *Storage) Remove(resp *model.Response) (freedBytes int64, isHit bool) {
+	freedBytes, isHit = s.next.Remove(resp)
+	if isHit {
+		// Best-effort: a dropped broadcast just means a peer keeps a stale entry until its own
+		// TTL/refresh cycle catches up, not a correctness break for this node.
+		_ = s.coordinator.Publish(context.Background(), uint32(resp.ShardKey()), resp.MapKey(), "remove")
+	}
+	return freedBytes, isHit
+}
+
+// RemoveByKey forwards to next if it implements storage.KeyRemover; used when this decorator sits
+// above a backend a Coordinator's consumer loop also targets directly, so it stays consistent with
+// Remove's publish-on-hit behavior.
+func (s *Storage) RemoveByKey(mapKey uint64) (freedBytes int64, isHit bool) {
+	kr, ok := s.next.(storage.KeyRemover)
+	if !ok {
+		return 0, false
+	}
+	freedBytes, isHit = kr.RemoveByKey(mapKey)
+	if isHit {
+		_ = s.coordinator.Publish(context.Background(), 0, mapKey, "remove")
+	}
+	return freedBytes, isHit
+}
+
+// RemoveByPattern forwards to next if it implements PatternRemover, publishing the same purge
+// broadcast as Remove/RemoveByKey on a hit so peers apply the tag/path purge too.
+func (s *Storage) RemoveByPattern(pattern string) (freedBytes int64, removed int) {
+	pr, ok := s.next.(PatternRemover)
+	if !ok {
+		return 0, 0
+	}
+	freedBytes, removed = pr.RemoveByPattern(pattern)
+	if removed > 0 {
+		_ = s.coordinator.PublishPattern(context.Background(), pattern)
+	}
+	return freedBytes, removed
+}
+
+func (s *Storage) Stat() (bytes int64, length int64) { return s.next.Stat() }
+
+func (s *Storage) Mem() int64 { return s.next.Mem() }
+
+func (s *Storage) RealMem() int64 { return s.next.RealMem() }
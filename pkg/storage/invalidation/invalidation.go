@@ -0,0 +1,433 @@
+// Package invalidation broadcasts cache purges across Caddy nodes sharing the same origin over a
+// Redis Stream, so a Remove on one node doesn't leave stale entries on the others. Each node both
+// publishes its own Remove calls and consumes every other node's, via one shared consumer group so
+// Redis tracks a single cluster-wide delivery cursor instead of replaying history to late joiners.
+package invalidation
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/caddyserver/caddy/v2/pkg/config"
+	"github.com/caddyserver/caddy/v2/pkg/prometheus/metrics/keyword"
+	"github.com/caddyserver/caddy/v2/pkg/storage"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	fieldNodeID  = "node_id"
+	fieldShardID = "shard_id"
+	fieldKeyHash = "key_hash"
+	fieldReason  = "reason"
+	fieldBloom   = "bloom"
+	fieldPattern = "pattern"
+
+	reasonResync    = "resync"
+	reasonRefreshed = "refreshed"
+	reasonPattern   = "remove_pattern"
+
+	// xreadGroupErrBackoff is how long Run pauses after an XREADGROUP call fails for a reason other
+	// than redis.Nil or context cancellation (e.g. Redis unreachable), so a prolonged outage degrades
+	// into a slow retry loop instead of a busy-spin that floods logs and hammers Redis with
+	// reconnect attempts as fast as the network can fail the call.
+	xreadGroupErrBackoff = 500 * time.Millisecond
+)
+
+// PatternRemover is an optional capability a storage.Storage can implement to remove every entry
+// matching a caller-defined pattern in one call, instead of enumerating individual keys. The
+// pattern grammar is owned by the backend; pkg/storage/lru.Storage recognizes a "tag:" prefix
+// (surrogate-key/cache-tag values tracked via pkg/storage/tagindex) and a "path:" prefix (a rule's
+// config.Rule.Path). PublishPattern/applyPattern broadcast any pattern string cluster-wide without
+// needing changes here when a new backend adopts a different grammar.
+type PatternRemover interface {
+	RemoveByPattern(pattern string) (freedBytes int64, removed int)
+}
+
+// Coordinator publishes this node's Remove calls onto a Redis Stream and applies every other
+// node's, identified by config.Invalidation.NodeID, directly against local (bypassing any
+// decorator that would otherwise re-publish what's already a peer's event).
+type Coordinator struct {
+	ctx    context.Context
+	cfg    *config.Cache
+	client *redis.Client
+	local  storage.KeyRemover
+	// refreshed tracks keys a peer recently broadcast as just-revalidated (uint64 -> time.Time), so
+	// RecentlyRefreshed can tell the local refresher to skip redoing the same upstream fetch. Entries
+	// are never actively expired; RecentlyRefreshed treats anything older than
+	// Cache.Invalidation.RefreshSuppressWindow as absent, which bounds its practical size to roughly
+	// one window's worth of distinct refreshed keys.
+	refreshed sync.Map
+}
+
+// NewCoordinator dials cfg.Cache.Invalidation.RedisAddr. local is applied directly by the consumer
+// loop for every purge event this node didn't originate itself.
+func NewCoordinator(ctx context.Context, cfg *config.Cache, local storage.KeyRemover) *Coordinator {
+	return &Coordinator{
+		ctx:    ctx,
+		cfg:    cfg,
+		client: redis.NewClient(&redis.Options{Addr: cfg.Cache.Invalidation.RedisAddr}),
+		local:  local,
+	}
+}
+
+var _ storage.RefreshBroadcaster = (*Coordinator)(nil)
+
+// Publish broadcasts a purge of keyHash (shardID is carried along purely for observability; it
+// plays no role in delivery or application) to every other node's consumer, trimming the stream to
+// approximately MaxLen entries so it can't grow unbounded if a consumer falls behind.
+func (c *Coordinator) Publish(ctx context.Context, shardID uint32, keyHash uint64, reason string) error {
+	inv := c.cfg.Cache.Invalidation
+	err := c.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: inv.Stream,
+		MaxLen: inv.MaxLen,
+		Approx: true,
+		Values: map[string]any{
+			fieldNodeID:  inv.NodeID,
+			fieldShardID: shardID,
+			fieldKeyHash: strconv.FormatUint(keyHash, 36),
+			fieldReason:  reason,
+		},
+	}).Err()
+	if err == nil {
+		metrics.GetOrCreateCounter(publishedMetricName(reason)).Inc()
+	}
+	return err
+}
+
+// PublishRefreshed broadcasts that this node just revalidated keyHash against the origin, so peers
+// within Cache.Invalidation.RefreshSuppressWindow can skip redoing the same upstream fetch (see
+// RecentlyRefreshed and storage.RefreshBroadcaster). It's a best-effort hint, not a guarantee: a
+// dropped or delayed event just costs a peer one redundant refresh, never a correctness problem.
+func (c *Coordinator) PublishRefreshed(ctx context.Context, keyHash uint64) error {
+	inv := c.cfg.Cache.Invalidation
+	err := c.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: inv.Stream,
+		MaxLen: inv.MaxLen,
+		Approx: true,
+		Values: map[string]any{
+			fieldNodeID:  inv.NodeID,
+			fieldKeyHash: strconv.FormatUint(keyHash, 36),
+			fieldReason:  reasonRefreshed,
+		},
+	}).Err()
+	if err == nil {
+		metrics.GetOrCreateCounter(publishedMetricName(reasonRefreshed)).Inc()
+	}
+	return err
+}
+
+// RecentlyRefreshed reports whether some peer broadcast a PublishRefreshed for keyHash within
+// Cache.Invalidation.RefreshSuppressWindow. Always false when the window is zero or unset (the
+// historic behavior: every node refreshes independently).
+func (c *Coordinator) RecentlyRefreshed(keyHash uint64) bool {
+	window := c.cfg.Cache.Invalidation.RefreshSuppressWindow
+	if window <= 0 {
+		return false
+	}
+	at, ok := c.refreshed.Load(keyHash)
+	if !ok {
+		return false
+	}
+	return time.Since(at.(time.Time)) <= window
+}
+
+// PublishPattern broadcasts a manual purge by pattern rather than a single exact key hash; the
+// grammar is the receiving backend's (see PatternRemover: lru.Storage understands "tag:" and
+// "path:"). It only carries the broadcast: each peer applies it via applyPattern, which logs and
+// drops it when that peer's local storage doesn't implement PatternRemover.
+func (c *Coordinator) PublishPattern(ctx context.Context, pattern string) error {
+	inv := c.cfg.Cache.Invalidation
+	err := c.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: inv.Stream,
+		MaxLen: inv.MaxLen,
+		Approx: true,
+		Values: map[string]any{
+			fieldNodeID:  inv.NodeID,
+			fieldPattern: pattern,
+			fieldReason:  reasonPattern,
+		},
+	}).Err()
+	if err == nil {
+		metrics.GetOrCreateCounter(publishedMetricName(reasonPattern)).Inc()
+	}
+	return err
+}
+
+// Resync publishes a Bloom filter of every key this node currently holds (built from localKeys, a
+// snapshot the caller collects up front, e.g. by walking its sharded.Map). Peers that hold a key
+// NOT present in the filter republish it as an invalidation with reason "resync-divergence": this
+// node either purged it while this node was down and the purge itself has since scrolled off the
+// (trimmed) stream, or it was never cached here to begin with — either way, the safe outcome is the
+// same "drop it, let it refetch" as any other purge.
+func (c *Coordinator) Resync(ctx context.Context, localKeys []uint64) error {
+	filter := newBloom()
+	for _, key := range localKeys {
+		filter.add(key)
+	}
+
+	inv := c.cfg.Cache.Invalidation
+	err := c.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: inv.Stream,
+		MaxLen: inv.MaxLen,
+		Approx: true,
+		Values: map[string]any{
+			fieldNodeID: inv.NodeID,
+			fieldReason: reasonResync,
+			fieldBloom:  string(filter.bytes()),
+		},
+	}).Err()
+	if err == nil {
+		metrics.GetOrCreateCounter(publishedMetricName(reasonResync)).Inc()
+	}
+	return err
+}
+
+// ResyncIfSupported calls Resync with the keys reported by local, if local implements
+// localKeyWalker (only the in-process malloc backend does). It's a no-op returning nil for any
+// backend that can't cheaply enumerate its own keys, so callers can invoke it unconditionally on
+// startup when Cache.Invalidation.ResyncOnStart is set.
+func (c *Coordinator) ResyncIfSupported(ctx context.Context) error {
+	walker, ok := c.local.(localKeyWalker)
+	if !ok {
+		return nil
+	}
+	return c.Resync(ctx, walker.LocalKeys())
+}
+
+// Run joins the shared consumer group (creating the stream/group if this is the cluster's first
+// node) and applies every other node's purge events to local until ctx is canceled. It's meant to
+// be launched with `go coordinator.Run()` from CacheMiddleware.setUpCache(), alongside the store's
+// own Run().
+func (c *Coordinator) Run() {
+	inv := c.cfg.Cache.Invalidation
+	if !inv.IsEnabled {
+		return
+	}
+
+	if err := c.client.XGroupCreateMkStream(c.ctx, inv.Stream, inv.Group, "0").Err(); err != nil && !isBusyGroupErr(err) {
+		log.Error().Err(err).Msg("[invalidation] failed to create consumer group")
+		return
+	}
+
+	go c.reclaim()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		default:
+		}
+
+		res, err := c.client.XReadGroup(c.ctx, &redis.XReadGroupArgs{
+			Group:    inv.Group,
+			Consumer: inv.NodeID,
+			Streams:  []string{inv.Stream, ">"},
+			Block:    inv.BlockTimeout,
+			Count:    256,
+		}).Result()
+		if err != nil {
+			if err == redis.Nil || c.ctx.Err() != nil {
+				continue
+			}
+			log.Error().Err(err).Msg("[invalidation] XREADGROUP failed")
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(xreadGroupErrBackoff):
+			}
+			continue
+		}
+
+		for _, stream := range res {
+			for _, msg := range stream.Messages {
+				c.apply(msg)
+				if err := c.client.XAck(c.ctx, inv.Stream, inv.Group, msg.ID).Err(); err != nil {
+					log.Error().Err(err).Str("id", msg.ID).Msg("[invalidation] XACK failed")
+				}
+			}
+		}
+	}
+}
+
+// apply applies one consumed message, skipping events this node produced itself (it already
+// applied its own Remove locally before ever publishing) and dispatching resync events separately
+// from ordinary purges.
+func (c *Coordinator) apply(msg redis.XMessage) {
+	nodeID, _ := msg.Values[fieldNodeID].(string)
+	reason, _ := msg.Values[fieldReason].(string)
+	metrics.GetOrCreateCounter(consumedMetricName(reason)).Inc()
+
+	if nodeID == c.cfg.Cache.Invalidation.NodeID {
+		return
+	}
+
+	switch reason {
+	case reasonResync:
+		c.applyResync(msg)
+		return
+	case reasonRefreshed:
+		c.applyRefreshed(msg)
+		return
+	case reasonPattern:
+		c.applyPattern(msg)
+		return
+	}
+
+	keyHashStr, _ := msg.Values[fieldKeyHash].(string)
+	keyHash, err := strconv.ParseUint(keyHashStr, 36, 64)
+	if err != nil {
+		return
+	}
+	c.local.RemoveByKey(keyHash)
+}
+
+// applyRefreshed records that a peer just revalidated keyHash, so RecentlyRefreshed can suppress a
+// redundant local refresh of the same key for the remainder of the configured window.
+func (c *Coordinator) applyRefreshed(msg redis.XMessage) {
+	keyHashStr, _ := msg.Values[fieldKeyHash].(string)
+	keyHash, err := strconv.ParseUint(keyHashStr, 36, 64)
+	if err != nil {
+		return
+	}
+	c.refreshed.Store(keyHash, time.Now())
+}
+
+// applyPattern dispatches a manual purge-by-pattern broadcast to local, if local implements
+// PatternRemover. Backends that don't implement it simply log and drop it.
+func (c *Coordinator) applyPattern(msg redis.XMessage) {
+	pattern, _ := msg.Values[fieldPattern].(string)
+	if pattern == "" {
+		return
+	}
+	remover, ok := c.local.(PatternRemover)
+	if !ok {
+		log.Warn().Str("pattern", pattern).Msg("[invalidation] received a pattern purge but local storage doesn't support RemoveByPattern")
+		return
+	}
+	remover.RemoveByPattern(pattern)
+}
+
+// applyResync purges any key this node holds that's absent from the restarting peer's Bloom
+// filter, rebroadcasting it so every other node (including the peer that just resynced) converges.
+func (c *Coordinator) applyResync(msg redis.XMessage) {
+	bloomStr, _ := msg.Values[fieldBloom].(string)
+	if bloomStr == "" {
+		return
+	}
+	filter := bloomFromBytes([]byte(bloomStr))
+
+	walker, ok := c.local.(localKeyWalker)
+	if !ok {
+		return
+	}
+	for _, key := range walker.LocalKeys() {
+		if !filter.test(key) {
+			c.local.RemoveByKey(key)
+			_ = c.Publish(c.ctx, 0, key, "resync-divergence")
+		}
+	}
+}
+
+// reclaim periodically scans the consumer group's pending-entries list for messages that have sat
+// unacked longer than ReclaimIdle — almost always because the node that XReadGroup'd them crashed
+// before it could XAck — claims them under this node's own consumer name via XCLAIM, and applies
+// them exactly like a freshly consumed message. A no-op for the lifetime of the run when
+// ReclaimIdle is zero (the default: reclaim disabled).
+func (c *Coordinator) reclaim() {
+	inv := c.cfg.Cache.Invalidation
+	if inv.ReclaimIdle <= 0 {
+		return
+	}
+
+	interval := inv.ReclaimInterval
+	if interval <= 0 {
+		interval = inv.ReclaimIdle
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.reclaimOnce()
+		}
+	}
+}
+
+func (c *Coordinator) reclaimOnce() {
+	inv := c.cfg.Cache.Invalidation
+
+	pending, err := c.client.XPendingExt(c.ctx, &redis.XPendingExtArgs{
+		Stream: inv.Stream,
+		Group:  inv.Group,
+		Start:  "-",
+		End:    "+",
+		Count:  256,
+		Idle:   inv.ReclaimIdle,
+	}).Result()
+	if err != nil {
+		if err != redis.Nil {
+			log.Error().Err(err).Msg("[invalidation] XPENDING failed")
+		}
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(pending))
+	for _, p := range pending {
+		ids = append(ids, p.ID)
+	}
+
+	msgs, err := c.client.XClaim(c.ctx, &redis.XClaimArgs{
+		Stream:   inv.Stream,
+		Group:    inv.Group,
+		Consumer: inv.NodeID,
+		MinIdle:  inv.ReclaimIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		log.Error().Err(err).Msg("[invalidation] XCLAIM failed")
+		return
+	}
+
+	for _, msg := range msgs {
+		reason, _ := msg.Values[fieldReason].(string)
+		metrics.GetOrCreateCounter(reclaimedMetricName(reason)).Inc()
+		c.apply(msg)
+		if err := c.client.XAck(c.ctx, inv.Stream, inv.Group, msg.ID).Err(); err != nil {
+			log.Error().Err(err).Str("id", msg.ID).Msg("[invalidation] XACK (reclaim) failed")
+		}
+	}
+}
+
+func publishedMetricName(reason string) string {
+	return keyword.InvalidationEventsPublishedTotalMetricName + `{reason="` + reason + `"}`
+}
+
+func consumedMetricName(reason string) string {
+	return keyword.InvalidationEventsConsumedTotalMetricName + `{reason="` + reason + `"}`
+}
+
+func reclaimedMetricName(reason string) string {
+	return keyword.InvalidationEventsReclaimedTotalMetricName + `{reason="` + reason + `"}`
+}
+
+// localKeyWalker is an optional capability a storage.KeyRemover can implement to let Resync
+// reconciliation enumerate its currently-held keys; only the in-process malloc backend can do this
+// cheaply (remote backends have no local enumeration to offer without a full SCAN).
+type localKeyWalker interface {
+	LocalKeys() []uint64
+}
+
+func isBusyGroupErr(err error) bool {
+	return err != nil && len(err.Error()) >= len("BUSYGROUP") && err.Error()[:len("BUSYGROUP")] == "BUSYGROUP"
+}
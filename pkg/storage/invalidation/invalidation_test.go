@@ -0,0 +1,163 @@
+package invalidation
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/pkg/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeLocal is a storage.KeyRemover + PatternRemover + localKeyWalker double recording every call
+// apply dispatches to it, so these tests can exercise Coordinator.apply without a live Redis.
+type fakeLocal struct {
+	removedKeys     []uint64
+	removedPatterns []string
+	localKeys       []uint64
+}
+
+func (f *fakeLocal) RemoveByKey(mapKey uint64) (int64, bool) {
+	f.removedKeys = append(f.removedKeys, mapKey)
+	return 0, true
+}
+
+func (f *fakeLocal) RemoveByPattern(pattern string) (int64, int) {
+	f.removedPatterns = append(f.removedPatterns, pattern)
+	return 0, 1
+}
+
+func (f *fakeLocal) LocalKeys() []uint64 {
+	return f.localKeys
+}
+
+func newTestCoordinator(local *fakeLocal) *Coordinator {
+	return &Coordinator{
+		cfg: &config.Cache{Cache: config.CacheBox{
+			Invalidation: config.Invalidation{NodeID: "this-node", RefreshSuppressWindow: time.Minute},
+		}},
+		local: local,
+	}
+}
+
+func xMessage(values map[string]any) redis.XMessage {
+	return redis.XMessage{ID: "1-1", Values: values}
+}
+
+func TestApplySkipsEventsFromSelf(t *testing.T) {
+	local := &fakeLocal{}
+	c := newTestCoordinator(local)
+
+	c.apply(xMessage(map[string]any{
+		fieldNodeID:  "this-node",
+		fieldKeyHash: strconv.FormatUint(7, 36),
+	}))
+
+	if len(local.removedKeys) != 0 {
+		t.Fatalf("expected an event from this node's own NodeID to be skipped, got removedKeys=%v", local.removedKeys)
+	}
+}
+
+func TestApplyDispatchesOrdinaryRemoveByKey(t *testing.T) {
+	local := &fakeLocal{}
+	c := newTestCoordinator(local)
+
+	c.apply(xMessage(map[string]any{
+		fieldNodeID:  "peer-node",
+		fieldKeyHash: strconv.FormatUint(123, 36),
+	}))
+
+	if len(local.removedKeys) != 1 || local.removedKeys[0] != 123 {
+		t.Fatalf("expected RemoveByKey(123), got %v", local.removedKeys)
+	}
+}
+
+func TestApplyDispatchesPattern(t *testing.T) {
+	local := &fakeLocal{}
+	c := newTestCoordinator(local)
+
+	c.apply(xMessage(map[string]any{
+		fieldNodeID:  "peer-node",
+		fieldReason:  reasonPattern,
+		fieldPattern: "tag:project:285",
+	}))
+
+	if len(local.removedPatterns) != 1 || local.removedPatterns[0] != "tag:project:285" {
+		t.Fatalf("expected RemoveByPattern(\"tag:project:285\"), got %v", local.removedPatterns)
+	}
+}
+
+func TestApplyPatternIgnoresEmptyPattern(t *testing.T) {
+	local := &fakeLocal{}
+	c := newTestCoordinator(local)
+
+	c.apply(xMessage(map[string]any{
+		fieldNodeID: "peer-node",
+		fieldReason: reasonPattern,
+	}))
+
+	if len(local.removedPatterns) != 0 {
+		t.Fatalf("expected no RemoveByPattern call for an empty pattern, got %v", local.removedPatterns)
+	}
+}
+
+func TestApplyRefreshedThenRecentlyRefreshed(t *testing.T) {
+	local := &fakeLocal{}
+	c := newTestCoordinator(local)
+
+	if c.RecentlyRefreshed(55) {
+		t.Fatal("expected RecentlyRefreshed to be false before any refreshed broadcast")
+	}
+
+	c.apply(xMessage(map[string]any{
+		fieldNodeID:  "peer-node",
+		fieldReason:  reasonRefreshed,
+		fieldKeyHash: strconv.FormatUint(55, 36),
+	}))
+
+	if !c.RecentlyRefreshed(55) {
+		t.Fatal("expected RecentlyRefreshed to be true right after an applied refreshed broadcast")
+	}
+	if c.RecentlyRefreshed(56) {
+		t.Fatal("expected an unrelated key to stay unaffected")
+	}
+}
+
+func TestRecentlyRefreshedDisabledWhenWindowUnset(t *testing.T) {
+	local := &fakeLocal{}
+	c := newTestCoordinator(local)
+	c.cfg.Cache.Invalidation.RefreshSuppressWindow = 0
+
+	c.apply(xMessage(map[string]any{
+		fieldNodeID:  "peer-node",
+		fieldReason:  reasonRefreshed,
+		fieldKeyHash: strconv.FormatUint(1, 36),
+	}))
+
+	if c.RecentlyRefreshed(1) {
+		t.Fatal("expected RecentlyRefreshed to always report false when RefreshSuppressWindow is 0")
+	}
+}
+
+func TestApplyResyncWithNoDivergenceRemovesNothing(t *testing.T) {
+	local := &fakeLocal{localKeys: []uint64{1, 2, 3}}
+	c := newTestCoordinator(local)
+
+	filter := newBloom()
+	for _, k := range local.localKeys {
+		filter.add(k)
+	}
+
+	// Every local key is already present in the peer's filter, so applyResync must find no
+	// divergence and never touch local.RemoveByKey (which, for a real Coordinator, would also
+	// attempt to re-Publish over the network).
+	c.applyResync(xMessage(map[string]any{
+		fieldNodeID: "peer-node",
+		fieldReason: reasonResync,
+		fieldBloom:  string(filter.bytes()),
+	}))
+
+	if len(local.removedKeys) != 0 {
+		t.Fatalf("expected no removals when every local key is present in the peer's filter, got %v", local.removedKeys)
+	}
+}
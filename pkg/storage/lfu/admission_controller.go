@@ -2,73 +2,101 @@ package lfu
 
 import (
 	"context"
-	"github.com/caddyserver/caddy/v2/pkg/buffer"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/metrics"
 	"github.com/caddyserver/caddy/v2/pkg/model"
-	"time"
+	"github.com/caddyserver/caddy/v2/pkg/prometheus/metrics/keyword"
 )
 
 const (
-	bufferSize    = 1 << 16 // 32MB ring buffer
+	// sketchWidth is 2^15 counters per row, which puts the Count-Min error bound e/width at roughly
+	// 0.008% of all increments; a power of two keeps the modulo in hash64's caller cheap.
 	sketchWidth   = 1 << 15
-	sketchDepth   = 5
+	sketchDepth   = 4 // 4 independent hash functions, one row each
 	doorkeeperCap = 1 << 18
+
+	// defaultAgingWindow is used when NewTinyLFU isn't given a capacity hint (e.g. in tests).
+	defaultAgingWindow = 10 * (1 << 16)
 )
 
 // TinyLFU ties TinyLFU logic into LRU.
 type TinyLFU struct {
-	ctx        context.Context
-	buf        *buffer.Ring
-	sketch     *countMinSketch
-	doorkeeper *doorkeeper
+	ctx         context.Context
+	sketch      *countMinSketch
+	doorkeeper  *doorkeeper
+	increments  int64 // atomic; counts Increment calls since the last Age/Reset
+	agingWindow int64 // Age+Reset once increments reaches this many calls
 }
 
-func NewTinyLFU(ctx context.Context) *TinyLFU {
-	a := &TinyLFU{
-		ctx:        ctx,
-		buf:        buffer.NewRingBuffer(bufferSize),
-		sketch:     newCountMinSketch(),
-		doorkeeper: newDoorkeeper(doorkeeperCap),
+// NewTinyLFU builds a TinyLFU sized for roughly capacityHint cache entries: the sketch ages (and
+// the doorkeeper resets) every 10*capacityHint increments, which is the "reset" that gives
+// W-TinyLFU its recency bias. capacityHint <= 0 falls back to defaultAgingWindow.
+func NewTinyLFU(ctx context.Context, capacityHint int) *TinyLFU {
+	agingWindow := int64(defaultAgingWindow)
+	if capacityHint > 0 {
+		agingWindow = 10 * int64(capacityHint)
+	}
+	return &TinyLFU{
+		ctx:         ctx,
+		sketch:      newCountMinSketch(),
+		doorkeeper:  newDoorkeeper(doorkeeperCap),
+		agingWindow: agingWindow,
 	}
-	go a.runTinyLFURunner()
-	return a
 }
 
-func (t *TinyLFU) runTinyLFURunner() {
-	ticker := time.NewTicker(time.Millisecond * 500)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-t.ctx.Done():
-			return
-		case <-ticker.C:
-			for _, key := range t.buf.Snapshot() {
-				t.sketch.Increment(key)
-			}
-		}
-	}
+// Increment records a visit to resp's key. First-time keys (per the doorkeeper) are only recorded
+// in the doorkeeper, saving sketch capacity for keys that show up more than once; repeat keys get
+// a conservative Count-Min Sketch update. Called from the Storage.Set hot path, so all state here
+// is either atomic (increments) or guarded by the sketch/doorkeeper's own mutex.
+func (t *TinyLFU) Increment(resp *model.Response) {
+	t.increment(resp.Request().MapKey())
 }
 
-func (t *TinyLFU) Increment(key uint64) {
+func (t *TinyLFU) increment(key uint64) {
+	if !t.doorkeeper.Allow(key) {
+		t.maybeAge()
+		return
+	}
 	t.sketch.Increment(key)
-	t.doorkeeper.Allow(key)
+	t.maybeAge()
+}
+
+// maybeAge halves the sketch and clears the doorkeeper once every agingWindow increments. The CAS
+// ensures that, under concurrent callers racing past the threshold, only one of them performs the
+// reset.
+func (t *TinyLFU) maybeAge() {
+	count := atomic.AddInt64(&t.increments, 1)
+	if count < t.agingWindow {
+		return
+	}
+	if atomic.CompareAndSwapInt64(&t.increments, count, 0) {
+		t.sketch.Age()
+		t.doorkeeper.Reset()
+	}
 }
 
 func (t *TinyLFU) Admit(new, evict *model.Response) bool {
 	kNew := new.Request().MapKey()
 	kOld := evict.Request().MapKey()
 
-	// push to getBuf
-	t.buf.Push(kNew)
-
-	// doorkeeper check
-	if !t.doorkeeper.Allow(kNew) {
-		return true // let through only once
-	}
-
-	// estimate frequency
+	// estimate frequency (0 for keys only seen via the doorkeeper so far)
 	newFreq := t.sketch.Estimate(kNew)
 	evictFreq := t.sketch.Estimate(kOld)
-	return newFreq >= evictFreq
+	admitted := newFreq > evictFreq
+	recordAdmitDecision(admitted)
+	return admitted
+}
+
+// recordAdmitDecision counts sketch-driven admit/reject outcomes so operators can watch the ratio
+// (admit / (admit+reject)) and tell whether the sketch/doorkeeper sizes are actually separating hot
+// keys from cold ones, or just thrashing.
+func recordAdmitDecision(admitted bool) {
+	if admitted {
+		metrics.GetOrCreateCounter(keyword.TinyLFUAdmitTotalMetricName).Inc()
+		return
+	}
+	metrics.GetOrCreateCounter(keyword.TinyLFURejectTotalMetricName).Inc()
 }
 
 // simple xor-based hash function for sketches.
@@ -0,0 +1,115 @@
+package lfu
+
+import (
+	"context"
+
+	"github.com/caddyserver/caddy/v2/pkg/config"
+	"github.com/caddyserver/caddy/v2/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+// Policy names accepted by Cache.Eviction.Policy and Rule.Eviction.Policy.
+const (
+	PolicyLRU      = "lru"
+	PolicyLFU      = "lfu"
+	PolicyTinyLFU  = "tinylfu"
+	PolicyWTinyLFU = "w-tinylfu"
+	PolicyARC      = "arc"
+	PolicyS3FIFO   = "s3-fifo"
+)
+
+// Admitter decides, once a Storage is over its memory threshold, whether a newly Set entry should
+// displace the balancer's chosen eviction victim. Increment records a visit so frequency-based
+// policies can build up an estimate before an entry is ever a contender.
+type Admitter interface {
+	Increment(resp *model.Response)
+	Admit(new, evict *model.Response) bool
+}
+
+// AlwaysAdmit implements the "lru" policy: no frequency-based filtering at all, so the balancer's
+// recency-ordered victim is always evicted in favor of whatever was just Set. This is the historic
+// pre-TinyLFU behavior, kept available per rule for workloads where popularity doesn't skew enough
+// to be worth a frequency sketch.
+type AlwaysAdmit struct{}
+
+func (AlwaysAdmit) Increment(*model.Response)                   {}
+func (AlwaysAdmit) Admit(*model.Response, *model.Response) bool { return true }
+
+var (
+	_ Admitter = (*TinyLFU)(nil)
+	_ Admitter = AlwaysAdmit{}
+	_ Admitter = (*WindowTinyLFU)(nil)
+	_ Admitter = (*Composite)(nil)
+)
+
+// NewAdmitter builds the Admitter named by policy, sized for roughly capacityHint entries. An
+// empty policy defaults to "tinylfu" (the module's long-standing default behavior); any other
+// unrecognized name, and the not-yet-implemented "arc"/"s3-fifo", also fall back to "tinylfu", but
+// log once so a config typo doesn't silently change admission behavior unnoticed.
+func NewAdmitter(ctx context.Context, policy string, capacityHint int) Admitter {
+	switch policy {
+	case "", PolicyLFU, PolicyTinyLFU:
+		return NewTinyLFU(ctx, capacityHint)
+	case PolicyLRU:
+		return AlwaysAdmit{}
+	case PolicyWTinyLFU:
+		return NewWindowTinyLFU(ctx, capacityHint)
+	case PolicyARC, PolicyS3FIFO:
+		log.Warn().Str("policy", policy).Msg("[lfu] eviction policy not yet implemented, falling back to tinylfu")
+		return NewTinyLFU(ctx, capacityHint)
+	default:
+		log.Warn().Str("policy", policy).Msg("[lfu] unrecognized eviction policy, falling back to tinylfu")
+		return NewTinyLFU(ctx, capacityHint)
+	}
+}
+
+// Composite dispatches Increment/Admit to a per-Rule Admitter chosen by Rule.Eviction.Policy,
+// falling back to one Admitter built from Cache.Eviction.Policy for any request whose Rule is nil
+// or leaves Eviction unset. It's built once per Storage with one sub-Admitter per distinct policy
+// actually referenced by the loaded rules, so two rules naming the same policy share one
+// sketch/doorkeeper instead of each fragmenting frequency data neither sees enough traffic alone to
+// build a useful estimate from.
+type Composite struct {
+	fallback Admitter
+	byPolicy map[string]Admitter
+}
+
+// NewComposite builds the per-policy Admitters referenced by rules, plus a fallback Admitter for
+// Cache.Eviction.Policy, all sized for roughly capacityHint entries.
+func NewComposite(ctx context.Context, rules []*config.Rule, fallbackPolicy string, capacityHint int) *Composite {
+	c := &Composite{byPolicy: make(map[string]Admitter)}
+	for _, rule := range rules {
+		if rule.Eviction == nil || rule.Eviction.Policy == "" {
+			continue
+		}
+		if _, exists := c.byPolicy[rule.Eviction.Policy]; exists {
+			continue
+		}
+		c.byPolicy[rule.Eviction.Policy] = NewAdmitter(ctx, rule.Eviction.Policy, capacityHint)
+	}
+	c.fallback = NewAdmitter(ctx, fallbackPolicy, capacityHint)
+	return c
+}
+
+func (c *Composite) pick(req *model.Request) Admitter {
+	if req == nil {
+		return c.fallback
+	}
+	rule := req.Rule()
+	if rule == nil || rule.Eviction == nil || rule.Eviction.Policy == "" {
+		return c.fallback
+	}
+	a, ok := c.byPolicy[rule.Eviction.Policy]
+	if !ok {
+		return c.fallback
+	}
+	return a
+}
+
+func (c *Composite) Increment(resp *model.Response) {
+	c.pick(resp.Request()).Increment(resp)
+}
+
+func (c *Composite) Admit(new, evict *model.Response) bool {
+	return c.pick(new.Request()).Admit(new, evict)
+}
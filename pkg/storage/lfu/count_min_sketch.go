@@ -1,10 +1,23 @@
 package lfu
 
-import "math/rand/v2"
+import (
+	"math/rand/v2"
+	"sync"
+)
 
-// countMinSketch is a probabilistic frequency counter (used for admission).
+// counterMax is the saturating ceiling of a single 4-bit counter.
+const counterMax = 15
+
+// countMinSketch is a probabilistic frequency counter (used for admission). Counters are 4-bit
+// and saturating, packed two per byte, so sketchDepth*sketchWidth/2 bytes hold the whole table
+// instead of sketchDepth*sketchWidth (the classic W-TinyLFU space trade-off).
+//
+// mu guards every access to table: Increment/Estimate/Age all run from concurrent Storage.Set/Get
+// callers, and without it a concurrent Age() could halve a row's counters mid-Increment elsewhere,
+// corrupting the packed nibbles (a torn read/write across the two 4-bit halves of the same byte).
 type countMinSketch struct {
-	table [sketchDepth][sketchWidth]uint8
+	mu    sync.Mutex
+	table [sketchDepth][]uint8 // each row holds sketchWidth nibbles packed into sketchWidth/2 bytes
 	seeds [sketchDepth]uint64
 }
 
@@ -12,25 +25,82 @@ func newCountMinSketch() *countMinSketch {
 	c := &countMinSketch{}
 	for i := 0; i < sketchDepth; i++ {
 		c.seeds[i] = rand.Uint64()
+		c.table[i] = make([]uint8, (sketchWidth+1)/2)
 	}
 	return c
 }
 
+func nibble(row []uint8, index int) uint8 {
+	b := row[index/2]
+	if index%2 == 0 {
+		return b & 0x0F
+	}
+	return b >> 4
+}
+
+func setNibble(row []uint8, index int, v uint8) {
+	if v > counterMax {
+		v = counterMax
+	}
+	if index%2 == 0 {
+		row[index/2] = (row[index/2] & 0xF0) | v
+	} else {
+		row[index/2] = (row[index/2] & 0x0F) | (v << 4)
+	}
+}
+
+// Increment applies a conservative update: only the rows currently holding the minimum estimate
+// are bumped, which keeps the sketch's over-counting error down versus bumping every row
+// unconditionally.
 func (c *countMinSketch) Increment(key uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	indexes := [sketchDepth]int{}
+	minimum := uint8(counterMax)
+	for i := 0; i < sketchDepth; i++ {
+		indexes[i] = int(hash64(c.seeds[i], key) % uint64(sketchWidth))
+		if v := nibble(c.table[i], indexes[i]); v < minimum {
+			minimum = v
+		}
+	}
+	if minimum >= counterMax {
+		return
+	}
 	for i := 0; i < sketchDepth; i++ {
-		h := hash64(c.seeds[i], key)
-		c.table[i][h%sketchWidth]++
+		if nibble(c.table[i], indexes[i]) == minimum {
+			setNibble(c.table[i], indexes[i], minimum+1)
+		}
 	}
 }
 
 func (c *countMinSketch) Estimate(key uint64) uint8 {
-	minimum := uint8(255)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	minimum := uint8(counterMax)
 	for i := 0; i < sketchDepth; i++ {
-		h := hash64(c.seeds[i], key)
-		v := c.table[i][h%sketchWidth]
-		if v < minimum {
+		index := int(hash64(c.seeds[i], key) % uint64(sketchWidth))
+		if v := nibble(c.table[i], index); v < minimum {
 			minimum = v
 		}
 	}
 	return minimum
 }
+
+// Age halves every counter in the sketch. Without this, counters only ever grow, so keys that
+// were hot long ago keep outscoring keys that are hot right now (TinyLFU's classic staleness
+// problem). Halving bounds how long a stale high count can keep winning admission.
+func (c *countMinSketch) Age() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := 0; i < sketchDepth; i++ {
+		row := c.table[i]
+		for j := range row {
+			high := (row[j] >> 4) / 2
+			low := (row[j] & 0x0F) / 2
+			row[j] = (high << 4) | low
+		}
+	}
+}
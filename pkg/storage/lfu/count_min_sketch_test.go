@@ -0,0 +1,129 @@
+package lfu
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCountMinSketchIncrementAndEstimate(t *testing.T) {
+	c := newCountMinSketch()
+
+	if got := c.Estimate(1); got != 0 {
+		t.Fatalf("expected estimate 0 for a never-seen key, got %d", got)
+	}
+
+	for i := 0; i < 5; i++ {
+		c.Increment(1)
+	}
+	if got := c.Estimate(1); got != 5 {
+		t.Fatalf("expected estimate 5 after 5 increments, got %d", got)
+	}
+
+	// A different key must not be affected by increments to key 1.
+	if got := c.Estimate(2); got != 0 {
+		t.Fatalf("expected unrelated key's estimate to stay 0, got %d", got)
+	}
+}
+
+func TestCountMinSketchIncrementSaturates(t *testing.T) {
+	c := newCountMinSketch()
+
+	for i := 0; i < counterMax+10; i++ {
+		c.Increment(1)
+	}
+	if got := c.Estimate(1); got != counterMax {
+		t.Fatalf("expected estimate to saturate at %d, got %d", counterMax, got)
+	}
+}
+
+func TestCountMinSketchAgeHalvesCounters(t *testing.T) {
+	c := newCountMinSketch()
+	for i := 0; i < 8; i++ {
+		c.Increment(1)
+	}
+	if got := c.Estimate(1); got != 8 {
+		t.Fatalf("expected estimate 8 before aging, got %d", got)
+	}
+
+	c.Age()
+	if got := c.Estimate(1); got != 4 {
+		t.Fatalf("expected estimate to halve to 4 after one Age(), got %d", got)
+	}
+
+	c.Age()
+	if got := c.Estimate(1); got != 2 {
+		t.Fatalf("expected estimate to halve to 2 after a second Age(), got %d", got)
+	}
+}
+
+func TestDoorkeeperAllowsFirstSeenThenRemembers(t *testing.T) {
+	d := newDoorkeeper(1 << 10)
+
+	if d.Allow(1) {
+		t.Fatal("expected first sighting of a key to report not-yet-seen (Allow returns false)")
+	}
+	if !d.Allow(1) {
+		t.Fatal("expected a key seen once before to be recognized (Allow returns true)")
+	}
+}
+
+func TestDoorkeeperResetForgetsEverything(t *testing.T) {
+	d := newDoorkeeper(1 << 10)
+
+	d.Allow(1)
+	if !d.Allow(1) {
+		t.Fatal("expected key to be recognized before Reset")
+	}
+
+	d.Reset()
+	if d.Allow(1) {
+		t.Fatal("expected Reset to forget a previously seen key")
+	}
+}
+
+// TestCountMinSketchConcurrentIncrementAndAge exercises Increment racing Age/Estimate from many
+// goroutines at once. It doesn't assert on the resulting counts (Age can legitimately interleave
+// with and erase concurrent Increments) — the point is for `go test -race` to catch a torn
+// read-modify-write on the packed nibble table if the mutex added to countMinSketch is ever
+// dropped or narrowed.
+func TestCountMinSketchConcurrentIncrementAndAge(t *testing.T) {
+	c := newCountMinSketch()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(key uint64) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				c.Increment(key)
+				c.Estimate(key)
+				if i%200 == 0 {
+					c.Age()
+				}
+			}
+		}(uint64(g))
+	}
+	wg.Wait()
+}
+
+// TestDoorkeeperConcurrentAllowAndReset exercises Allow racing Reset from many goroutines at once,
+// for go test -race to catch a torn read-modify-write on the bitset if doorkeeper's mutex is ever
+// dropped or narrowed.
+func TestDoorkeeperConcurrentAllowAndReset(t *testing.T) {
+	d := newDoorkeeper(1 << 10)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(key uint64) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				d.Allow(key)
+				if i%200 == 0 {
+					d.Reset()
+				}
+			}
+		}(uint64(g))
+	}
+	wg.Wait()
+}
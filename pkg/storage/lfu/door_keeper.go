@@ -1,9 +1,16 @@
 package lfu
 
-import "math/rand/v2"
+import (
+	"math/rand/v2"
+	"sync"
+)
 
 // doorkeeper is a simple Bloom filter.
+//
+// mu guards bits: Allow and Reset both run from concurrent Storage.Set callers, and without it a
+// concurrent Reset could zero a word while Allow elsewhere is mid read-modify-write on it.
 type doorkeeper struct {
+	mu    sync.Mutex
 	bits  []uint64
 	seeds [2]uint64
 }
@@ -16,6 +23,9 @@ func newDoorkeeper(capacity int) *doorkeeper {
 }
 
 func (d *doorkeeper) Allow(key uint64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	h1 := hash64(d.seeds[0], key)
 	h2 := hash64(d.seeds[1], key)
 	p1 := h1 % uint64(len(d.bits)*64)
@@ -29,3 +39,14 @@ func (d *doorkeeper) Allow(key uint64) bool {
 	d.bits[p2/64] |= 1 << (p2 % 64)
 	return false
 }
+
+// Reset clears every bit, so the "seen once" fact is forgotten. Called alongside countMinSketch.Age
+// so doorkeeper admission doesn't keep waiving through keys that were only ever seen long ago.
+func (d *doorkeeper) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i := range d.bits {
+		d.bits[i] = 0
+	}
+}
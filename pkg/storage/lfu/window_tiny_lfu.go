@@ -0,0 +1,61 @@
+package lfu
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/caddyserver/caddy/v2/pkg/model"
+)
+
+// windowRatio is the fraction of admitted entries W-TinyLFU reserves for its always-admit window
+// segment, matching the classic W-TinyLFU split (1% window / 99% main).
+const windowRatio = 0.01
+
+// WindowTinyLFU implements the "w-tinylfu" policy: a small SLRU-style window segment that always
+// admits, fronting the same Count-Min-Sketch-driven main segment TinyLFU uses. This gives recently
+// arrived keys a chance to accumulate frequency before they ever have to win a sketch comparison,
+// which plain TinyLFU can unfairly reject on arrival (the "one-hit wonder" problem for bursty new
+// keys). A full SLRU would additionally track its own protected/probation list and promote/demote
+// entries between them on every Get; this cache's admission hook only ever sees a boolean
+// allow/deny decision at Set time, with no ownership of the shard's list, so WindowTinyLFU
+// approximates the split purely through the window-vs-main admit ratio rather than a second list.
+type WindowTinyLFU struct {
+	main *TinyLFU
+
+	windowAdmits int64 // atomic
+	mainAdmits   int64 // atomic
+}
+
+// NewWindowTinyLFU builds a WindowTinyLFU sized for roughly capacityHint entries (passed straight
+// through to the main segment's TinyLFU).
+func NewWindowTinyLFU(ctx context.Context, capacityHint int) *WindowTinyLFU {
+	return &WindowTinyLFU{main: NewTinyLFU(ctx, capacityHint)}
+}
+
+// Increment records a visit against the shared main-segment sketch; the window segment has no
+// frequency state of its own to maintain.
+func (w *WindowTinyLFU) Increment(resp *model.Response) {
+	w.main.Increment(resp)
+}
+
+// Admit lets the window segment always win as long as its share of total admissions is still
+// under windowRatio, keeping newcomers from being rejected by the sketch before they've had a
+// chance to prove themselves; once the window's budget is spent, it falls back to the same
+// frequency comparison as plain TinyLFU.
+func (w *WindowTinyLFU) Admit(new, evict *model.Response) bool {
+	windowAdmits := atomic.LoadInt64(&w.windowAdmits)
+	mainAdmits := atomic.LoadInt64(&w.mainAdmits)
+	total := windowAdmits + mainAdmits
+
+	if total == 0 || float64(windowAdmits)/float64(total) < windowRatio {
+		atomic.AddInt64(&w.windowAdmits, 1)
+		recordAdmitDecision(true)
+		return true
+	}
+
+	admitted := w.main.Admit(new, evict)
+	if admitted {
+		atomic.AddInt64(&w.mainAdmits, 1)
+	}
+	return admitted
+}
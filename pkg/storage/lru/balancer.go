@@ -2,18 +2,22 @@ package lru
 
 import (
 	"context"
-	list2 "github.com/caddyserver/caddy/v2/pkg/list"
+	"math/rand/v2"
+	"sync/atomic"
+
 	"github.com/caddyserver/caddy/v2/pkg/model"
+	"github.com/caddyserver/caddy/v2/pkg/skiplist"
 	sharded "github.com/caddyserver/caddy/v2/pkg/storage/map"
-	"math/rand/v2"
 )
 
-// ShardNode represents a single Shard's Storage and accounting info.
-// Each Shard has its own Storage list and a pointer to its element in the balancer's memList.
+// ShardNode represents a single Shard's Storage and accounting info. Shard is itself a
+// linkedmap.Map-backed structure that maintains its own access order (see pkg/storage/map.Shard), so
+// ShardNode only has to track this shard's position in Balance's weight-ordered skip list and
+// whether a reposition is already pending for it.
 type ShardNode struct {
-	lruList     *list2.List[*model.Response]    // Per-Shard Storage list; less used responses at the back
-	memListElem *list2.Element[*ShardNode]      // Pointer to this node's position in Balance.memList
-	Shard       *sharded.Shard[*model.Response] // Reference to the actual Shard (map + sync)
+	Shard    *sharded.Shard[*model.Response] // Reference to the actual Shard (map + sync)
+	skipNode atomic.Pointer[skiplist.Node[*ShardNode]]
+	dirty    atomic.Bool // true while a reposition for this shard is queued in Balance.resort
 }
 
 func (s *ShardNode) RandItem(ctx context.Context) *model.Response {
@@ -30,9 +34,7 @@ func (s *ShardNode) Weight() int64 {
 	return s.Shard.Weight()
 }
 
-func (s *ShardNode) LruList() *list2.List[*model.Response] {
-	return s.lruList
-}
+var _ sharded.WeightObserver = (*Balance)(nil)
 
 type Balancer interface {
 	Rebalance()
@@ -41,36 +43,42 @@ type Balancer interface {
 	Register(shard *sharded.Shard[*model.Response])
 	Set(resp *model.Response)
 	Update(existing *model.Response)
-	Move(shardKey uint64, el *list2.Element[*model.Response])
-	Remove(shardKey uint64, el *list2.Element[*model.Response])
+	Move(shardKey uint64, mapKey uint64)
+	Remove(shardKey uint64, mapKey uint64) (freed int64, isHit bool)
 	MostLoadedSampled(offset int) (*ShardNode, bool)
 	FindVictim(shardKey uint64) (*model.Response, bool)
+	OnWeightChanged(shardID uint64)
 }
 
-// Balance maintains per-Shard Storage lists and provides efficient selection of loaded shards for eviction.
-// - memList orders shardNodes by usage (most loaded in front).
-// - shards is a flat array for O(1) access by Shard index.
-// - shardedMap is the underlying data storage (map of all entries).
+// Balance maintains per-Shard Storage and provides efficient selection of loaded shards for
+// eviction. Shards are kept in a skip list ordered by descending Weight (see pkg/skiplist):
+// OnWeightChanged repositions a shard in O(log N) the moment its Weight changes, instead of the
+// whole set being periodically re-sorted, so MostLoadedSampled never hands back a shard that's
+// drifted out of order in between rebalances.
 type Balance struct {
 	ctx        context.Context
 	shards     [sharded.NumOfShards]*ShardNode // Shard index → *ShardNode
-	memList    *list2.List[*ShardNode]         // Doubly-linked list of shards, ordered by Memory usage (most loaded at front)
+	skip       *skiplist.List[*ShardNode]      // Shards ordered by descending Weight
 	shardedMap *sharded.Map[*model.Response]   // Actual underlying storage of entries
+	resort     chan uint64                     // Shard IDs awaiting a reposition in skip
 }
 
-// NewBalancer creates a new Balance instance and initializes memList.
+// NewBalancer creates a new Balance instance and launches its reposition worker.
 func NewBalancer(ctx context.Context, shardedMap *sharded.Map[*model.Response]) *Balance {
-	return &Balance{
+	b := &Balance{
 		ctx:        ctx,
-		memList:    list2.New[*ShardNode](), // Sorted mode for easier rebalancing
+		skip:       skiplist.New[*ShardNode](),
 		shardedMap: shardedMap,
+		resort:     make(chan uint64, sharded.NumOfShards),
 	}
+	go b.runResort()
+	return b
 }
 
-func (b *Balance) Rebalance() {
-	// sort shardNodes by weight (freedMem)
-	b.memList.Sort(list2.DESC)
-}
+// Rebalance is a no-op: OnWeightChanged keeps every shard's position in skip continuously correct,
+// so there's nothing left to periodically re-sort. Kept so callers that still schedule a periodic
+// rebalance pass (see pkg/storage.Evict) don't need to change.
+func (b *Balance) Rebalance() {}
 
 func (b *Balance) Shards() [sharded.NumOfShards]*ShardNode {
 	return b.shards
@@ -85,60 +93,89 @@ func (b *Balance) RandNode() *ShardNode {
 	}
 }
 
-// Register inserts a new ShardNode for a given Shard, creates its Storage, and adds it to memList and shards array.
+// Register inserts a new ShardNode for a given Shard, adds it to the skip list, and subscribes to
+// its Weight changes.
 func (b *Balance) Register(shard *sharded.Shard[*model.Response]) {
-	n := &ShardNode{
-		Shard:   shard,
-		lruList: list2.New[*model.Response](),
-	}
-	n.memListElem = b.memList.PushBack(n)
+	n := &ShardNode{Shard: shard}
+	n.skipNode.Store(b.skip.Insert(n.Weight(), shard.ID(), n))
 	b.shards[shard.ID()] = n
+	shard.Observe(b)
 }
 
-// Set inserts a response into the appropriate Shard's Storage list and updates counters.
-// Returns the affected ShardNode for further operations.
-func (b *Balance) Set(resp *model.Response) {
-	resp.SetLruListElement(b.shards[resp.Request().ShardKey()].lruList.PushFront(resp))
-}
+// Set is a no-op, kept to satisfy Balancer. lru.Storage.set calls only shardedMap.Set, not this:
+// that already places resp at the front of its shard's own linkedmap.Map and fires
+// OnWeightChanged, so there's nothing left to do here.
+func (b *Balance) Set(resp *model.Response) {}
 
+// Update moves an existing entry to the front of its shard's access order in a single linkedmap call.
 func (b *Balance) Update(existing *model.Response) {
-	b.shards[existing.ShardKey()].lruList.MoveToFront(existing.LruListElement())
+	b.shards[existing.ShardKey()].Shard.Touch(existing.MapKey())
 }
 
-// Move moves an element to the front of the per-Shard Storage list.
+// Move moves mapKey to the front of shardKey's access order.
 // Used for touch/Set operations to mark entries as most recently used.
-func (b *Balance) Move(shardKey uint64, el *list2.Element[*model.Response]) {
-	b.shards[shardKey].lruList.MoveToFront(el)
+func (b *Balance) Move(shardKey uint64, mapKey uint64) {
+	b.shards[shardKey].Shard.Touch(mapKey)
 }
 
-func (b *Balance) Remove(shardKey uint64, el *list2.Element[*model.Response]) {
-	b.shards[shardKey].lruList.Remove(el)
+// Remove deletes mapKey from shardKey's Shard. The Shard fires OnWeightChanged itself, so the skip
+// list is repositioned without Remove having to know anything about it.
+func (b *Balance) Remove(shardKey uint64, mapKey uint64) (freed int64, isHit bool) {
+	return b.shards[shardKey].Shard.Remove(mapKey)
 }
 
-// MostLoadedSampled returns the first non-empty Shard node from the front of memList,
-// optionally skipping a number of nodes by offset (for concurrent eviction fairness).
+// MostLoadedSampled returns the offset-th heaviest shard (0-based) in O(log N), or false if offset
+// is out of range.
 func (b *Balance) MostLoadedSampled(offset int) (*ShardNode, bool) {
-	el, ok := b.memList.Next(offset)
-	if !ok {
-		return nil, false
-	}
-	return el.Value(), ok
+	return b.skip.Sample(offset)
 }
 
 func (b *Balance) FindVictim(shardKey uint64) (*model.Response, bool) {
 	shardKeyInt64 := int64(shardKey)
-	if el := b.shards[shardKeyInt64].lruList.Back(); el != nil {
-		return el.Value(), true
+	if resp, ok := b.shards[shardKeyInt64].Shard.Oldest(); ok {
+		return resp, true
 	}
 	if int64(len(b.shards)) > shardKeyInt64+1 {
-		if el := b.shards[shardKeyInt64+1].lruList.Back(); el != nil {
-			return el.Value(), true
+		if resp, ok := b.shards[shardKeyInt64+1].Shard.Oldest(); ok {
+			return resp, true
 		}
 	}
 	if shardKeyInt64-1 > 0 {
-		if el := b.shards[shardKeyInt64-1].lruList.Back(); el != nil {
-			return el.Value(), true
+		if resp, ok := b.shards[shardKeyInt64-1].Shard.Oldest(); ok {
+			return resp, true
 		}
 	}
 	return nil, false
 }
+
+// OnWeightChanged is called by a Shard (via the sharded.WeightObserver hook set in Register)
+// whenever a Set/Remove may have changed its Weight. Reordering is coalesced rather than done
+// inline: the dirty flag lets at most one reposition be pending per shard at a time, so a shard
+// under heavy concurrent writes doesn't thrash Delete+Insert on every single call. The actual
+// Delete+Insert happens on runResort's single goroutine, serializing skip list writes.
+func (b *Balance) OnWeightChanged(shardID uint64) {
+	n := b.shards[shardID]
+	if n == nil || !n.dirty.CompareAndSwap(false, true) {
+		return
+	}
+	b.resort <- shardID
+}
+
+// runResort drains resort, repositioning each shard in the skip list to reflect its current Weight.
+// resort is sized to sharded.NumOfShards and dirty ensures at most one pending entry per shard, so
+// this send in OnWeightChanged can never block.
+func (b *Balance) runResort() {
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case shardID := <-b.resort:
+			n := b.shards[shardID]
+			n.dirty.Store(false)
+
+			old := n.skipNode.Load()
+			b.skip.Delete(old)
+			n.skipNode.Store(b.skip.Insert(n.Weight(), shardID, n))
+		}
+	}
+}
@@ -6,26 +6,37 @@ import (
 	"math/rand/v2"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/VictoriaMetrics/metrics"
 	"github.com/caddyserver/caddy/v2/pkg/config"
 	"github.com/caddyserver/caddy/v2/pkg/model"
+	"github.com/caddyserver/caddy/v2/pkg/prometheus/metrics/keyword"
 	"github.com/caddyserver/caddy/v2/pkg/repository"
+	"github.com/caddyserver/caddy/v2/pkg/singleflight"
 	sharded "github.com/caddyserver/caddy/v2/pkg/storage/map"
+	"github.com/caddyserver/caddy/v2/pkg/storage/tagindex"
+	"github.com/caddyserver/caddy/v2/pkg/telemetry"
 	"github.com/caddyserver/caddy/v2/pkg/utils"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Storage is a Weight-aware, sharded Storage cache with background eviction and refreshItem support.
 type Storage struct {
-	ctx             context.Context               // Main context for lifecycle control
-	cfg             *config.Cache                 // CacheBox configuration
-	shardedMap      *sharded.Map[*model.Response] // Sharded storage for cache entries
-	tinyLFU         *lfu.TinyLFU                  // Helps hold more frequency used items in cache while eviction
-	backend         repository.Backender          // Remote backend server.
-	balancer        Balancer                      // Helps pick shards to evict from
-	mem             int64                         // Current Weight usage (bytes)
-	memoryThreshold int64                         // Threshold for triggering eviction (bytes)
+	ctx             context.Context                      // Main context for lifecycle control
+	cfg             *config.Cache                        // CacheBox configuration
+	shardedMap      *sharded.Map[*model.Response]        // Sharded storage for cache entries
+	admitter        lfu.Admitter                         // Admission filter consulted during eviction (policy picked per Cache/Rule.Eviction)
+	backend         repository.Backender                 // Remote backend server.
+	balancer        Balancer                             // Helps pick shards to evict from
+	tracer          telemetry.Tracer                     // Traces Get/Set/Remove/ShouldEvict (no-op unless Cache.Telemetry.TracingEnabled)
+	inflight        *singleflight.Group[*model.Response] // Coalesces concurrent GetOrLoad misses on the same key
+	mem             int64                                // Current Weight usage (bytes)
+	memoryThreshold int64                                // Threshold for triggering eviction (bytes)
+	tags            *tagindex.Index                      // Reverse tag -> key index backing RemoveByPattern's "tag:" form
 }
 
 // NewStorage constructs a new Storage cache instance and launches eviction and refreshItem routines.
@@ -34,7 +45,7 @@ func NewStorage(
 	cfg *config.Cache,
 	balancer Balancer,
 	backend repository.Backender,
-	tinyLFU *lfu.TinyLFU,
+	admitter lfu.Admitter,
 	shardedMap *sharded.Map[*model.Response],
 ) *Storage {
 	return (&Storage{
@@ -43,8 +54,11 @@ func NewStorage(
 		shardedMap:      shardedMap,
 		balancer:        balancer,
 		backend:         backend,
-		tinyLFU:         tinyLFU,
+		admitter:        admitter,
+		tracer:          telemetry.New(cfg.Cache.Telemetry.TracingEnabled, "lru.Storage"),
+		inflight:        singleflight.New[*model.Response](),
 		memoryThreshold: int64(float64(cfg.Cache.Storage.Size) * cfg.Cache.Eviction.Threshold),
+		tags:            tagindex.New(),
 	}).init()
 }
 
@@ -61,17 +75,65 @@ func (s *Storage) Run() {
 	s.runLogger()
 }
 
+// Ping always reports healthy: this backend is in-process and has nothing external to fail.
+func (s *Storage) Ping(_ context.Context) error { return nil }
+
 // Get retrieves a response by request and bumps its Storage position.
 // Returns: (response, releaser, found).
 func (s *Storage) Get(req *model.Request) (*model.Response, bool) {
+	_, span := s.tracer.Start(s.ctx, "lru.Storage.Get", requestAttrs(req)...)
+	defer span.End()
+
 	resp, found := s.shardedMap.Get(req.MapKey(), req.ShardKey())
 	if found {
+		span.SetAttributes(attribute.String("outcome", "hit"))
+		metrics.GetOrCreateCounter(keyword.CacheHitsMetricName).Inc()
+		metrics.GetOrCreateCounter(requestsByRuleMetricName(req, "hit")).Inc()
 		s.touch(resp)
 		return resp, true
 	}
+	span.SetAttributes(attribute.String("outcome", "miss"))
+	metrics.GetOrCreateCounter(keyword.CacheMissesMetricName).Inc()
+	metrics.GetOrCreateCounter(requestsByRuleMetricName(req, "miss")).Inc()
 	return nil, false
 }
 
+// requestsByRuleMetricName builds a cache_requests_by_rule_total{rule="...",outcome="..."} series
+// name. req.Rule() is nil for requests matching no configured Rule (the Cache-wide defaults apply
+// instead), labeled "default" so those requests still show up in the same series.
+func requestsByRuleMetricName(req *model.Request, outcome string) string {
+	rulePath := "default"
+	if rule := req.Rule(); rule != nil {
+		rulePath = rule.Path
+	}
+	return keyword.CacheRequestsByRuleTotalMetricName + `{rule="` + rulePath + `",outcome="` + outcome + `"}`
+}
+
+// GetOrLoad closes the thundering-herd window between a Get miss and the eventual Set: concurrent
+// misses for the same req.MapKey() coalesce into a single loader call via s.inflight, and that
+// call's result (on success) is Set exactly once. shared reports whether resp was served from an
+// existing entry or an in-flight/just-finished loader call (true) rather than produced by this
+// call's own loader invocation (false) — callers that stream the loader's side effects directly
+// (e.g. writing straight to an HTTP response writer) use shared to know whether they still need to
+// write resp themselves.
+func (s *Storage) GetOrLoad(req *model.Request, loader func() (*model.Response, error)) (resp *model.Response, shared bool, err error) {
+	if resp, isHit := s.Get(req); isHit {
+		return resp, true, nil
+	}
+
+	resp, err, shared = s.inflight.Do(req.MapKey(), func() (*model.Response, error) {
+		loaded, loadErr := loader()
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		if loaded != nil {
+			s.Set(loaded)
+		}
+		return loaded, nil
+	})
+	return resp, shared, err
+}
+
 func (s *Storage) GetRandom() (resp *model.Response, isFound bool) {
 	s.shardedMap.
 		Shard(sharded.MapShardKey(uint64(rand.IntN(int(sharded.ActiveShards))))).
@@ -86,14 +148,18 @@ func (s *Storage) GetRandom() (resp *model.Response, isFound bool) {
 
 // Set inserts or updates a response in the cache, updating Weight usage and Storage position.
 func (s *Storage) Set(new *model.Response) {
+	_, span := s.tracer.Start(s.ctx, "lru.Storage.Set", requestAttrs(new.Request())...)
+	defer span.End()
+
 	key := new.Request().MapKey()
 	shardKey := new.Request().ShardKey()
 
 	// Track access frequency
-	s.tinyLFU.Increment(key)
+	s.admitter.Increment(new)
 
 	existing, found := s.shardedMap.Get(key, shardKey)
 	if found {
+		span.SetAttributes(attribute.String("outcome", "updated"))
 		s.update(existing)
 		return
 	}
@@ -102,15 +168,20 @@ func (s *Storage) Set(new *model.Response) {
 	if s.ShouldEvict() {
 		victim, ok := s.balancer.FindVictim(shardKey)
 		if !ok {
+			span.SetAttributes(attribute.String("outcome", "rejected"))
+			metrics.GetOrCreateCounter(keyword.CacheAdmissionsRejectedMetric).Inc()
 			return
 		}
-		if victim != nil && !s.tinyLFU.Admit(new, victim) {
+		if victim != nil && !s.admitter.Admit(new, victim) {
 			// New item is less frequent than victim, skip insertion
+			span.SetAttributes(attribute.String("outcome", "rejected"))
+			metrics.GetOrCreateCounter(keyword.CacheAdmissionsRejectedMetric).Inc()
 			return
 		}
 	}
 
 	// Proceed with insert
+	span.SetAttributes(attribute.String("outcome", "admitted"))
 	s.set(new)
 }
 
@@ -119,15 +190,20 @@ func (s *Storage) touch(existing *model.Response) {
 	s.balancer.Update(existing)
 }
 
-// update refreshes Weight accounting and Storage position for an updated entry.
+// update refreshes Weight accounting and Storage position for an updated entry. Tags are re-added
+// (never retroactively removed) under whatever the refreshed Data now carries: a rule's tags rarely
+// change between refreshes, and erring towards over-wide purges is the safe direction if they ever
+// do, since it never leaves a genuinely stale tag unreachable from RemoveByPattern.
 func (s *Storage) update(existing *model.Response) {
+	s.tags.Add(existing.MapKey(), existing.Data().Tags())
 	s.balancer.Update(existing)
 }
 
-// set inserts a new response, updates Weight usage and registers in balancer.
+// set inserts a new response. shardedMap and the balancer share the same per-shard linkedmap.Map, so
+// a single Set places it in Storage and at the front of its shard's access order.
 func (s *Storage) set(new *model.Response) {
+	s.tags.Add(new.MapKey(), new.Data().Tags())
 	s.shardedMap.Set(new)
-	s.balancer.Set(new)
 }
 
 // runLogger emits detailed stats about evictions, Weight, and GC activity every 5 seconds if debugging is enabled.
@@ -140,6 +216,10 @@ func (s *Storage) runLogger() {
 			case <-s.ctx.Done():
 				return
 			case <-ticker:
+				for _, node := range s.balancer.Shards() {
+					metrics.GetOrCreateHistogram(keyword.CacheShardEntriesMetricName).Update(float64(node.Shard.Len()))
+				}
+
 				var m runtime.MemStats
 				runtime.ReadMemStats(&m)
 
@@ -179,8 +259,106 @@ func (s *Storage) runLogger() {
 }
 
 func (s *Storage) Remove(resp *model.Response) (freedBytes int64, isHit bool) {
-	s.balancer.Remove(resp.ShardKey(), resp.LruListElement())
-	return s.shardedMap.Remove(resp.MapKey())
+	_, span := s.tracer.Start(s.ctx, "lru.Storage.Remove", requestAttrs(resp.Request())...)
+	defer span.End()
+
+	freedBytes, isHit = s.balancer.Remove(resp.ShardKey(), resp.MapKey())
+	if isHit {
+		metrics.GetOrCreateCounter(keyword.CacheEvictionsMetricName).Inc()
+		s.tags.Remove(resp.MapKey(), resp.Data().Tags())
+	}
+	span.SetAttributes(attribute.Int64("weight", freedBytes), attribute.Bool("hit", isHit))
+	return freedBytes, isHit
+}
+
+// RemoveByKey removes the entry at mapKey without requiring its *model.Response back from the
+// caller, looking it up first since Remove needs the entry itself (its keys, and its Data's tags to
+// drop from the tag index). Used by pkg/storage/invalidation to apply a peer's purge, which only
+// carries the key hash over the wire.
+func (s *Storage) RemoveByKey(mapKey uint64) (freedBytes int64, isHit bool) {
+	resp, found := s.shardedMap.Get(mapKey, sharded.MapShardKey(mapKey))
+	if !found {
+		return 0, false
+	}
+	return s.Remove(resp)
+}
+
+const (
+	tagPatternPrefix  = "tag:"
+	pathPatternPrefix = "path:"
+)
+
+// RemoveByPattern implements invalidation.PatternRemover, purging every entry matching pattern. The
+// prefix selects how it's interpreted: "tag:<value>" looks the value up in the reverse tag index
+// (see config.Rule.Tags/model.Data.Tags), "path:<value>" walks every shard matching entries whose
+// Rule().Path equals <value> exactly. Any other (or missing) prefix matches nothing, rather than
+// guessing. Both forms are meant for occasional admin-triggered purges (see
+// modules/advancedcache.PurgeHandler), not the hot path.
+func (s *Storage) RemoveByPattern(pattern string) (freedBytes int64, removed int) {
+	switch {
+	case strings.HasPrefix(pattern, tagPatternPrefix):
+		return s.removeByTag(strings.TrimPrefix(pattern, tagPatternPrefix))
+	case strings.HasPrefix(pattern, pathPatternPrefix):
+		return s.removeByRulePath(strings.TrimPrefix(pattern, pathPatternPrefix))
+	default:
+		return 0, 0
+	}
+}
+
+func (s *Storage) removeByTag(tag string) (freedBytes int64, removed int) {
+	for _, key := range s.tags.Keys(tag) {
+		resp, found := s.shardedMap.Get(key, sharded.MapShardKey(key))
+		if !found {
+			continue
+		}
+		if freed, isHit := s.Remove(resp); isHit {
+			freedBytes += freed
+			removed++
+		}
+	}
+	return freedBytes, removed
+}
+
+func (s *Storage) removeByRulePath(path string) (freedBytes int64, removed int) {
+	var mu sync.Mutex
+	s.shardedMap.WalkShards(func(_ uint64, shard *sharded.Shard[*model.Response]) {
+		var matched []*model.Response
+		shard.Walk(s.ctx, func(_ uint64, resp *model.Response) bool {
+			if rule := resp.Request().Rule(); rule != nil && rule.Path == path {
+				matched = append(matched, resp)
+			}
+			return true
+		}, false)
+
+		for _, resp := range matched {
+			if freed, isHit := s.Remove(resp); isHit {
+				mu.Lock()
+				freedBytes += freed
+				removed++
+				mu.Unlock()
+			}
+		}
+	})
+	return freedBytes, removed
+}
+
+// LocalKeys snapshots every key currently held across all shards. It's a full-cache walk, so it's
+// meant for occasional use (today, only pkg/storage/invalidation's startup resync), not the hot
+// path.
+func (s *Storage) LocalKeys() []uint64 {
+	keys := make([]uint64, 0, s.shardedMap.Len())
+	var mu sync.Mutex
+	s.shardedMap.WalkShards(func(_ uint64, shard *sharded.Shard[*model.Response]) {
+		var local []uint64
+		shard.Walk(s.ctx, func(key uint64, _ *model.Response) bool {
+			local = append(local, key)
+			return true
+		}, false)
+		mu.Lock()
+		keys = append(keys, local...)
+		mu.Unlock()
+	})
+	return keys
 }
 
 func (s *Storage) Mem() int64 {
@@ -196,5 +374,22 @@ func (s *Storage) Stat() (bytes int64, length int64) {
 
 // ShouldEvict [HOT PATH METHOD] (max stale value = 25ms) checks if current Weight usage has reached or exceeded the threshold.
 func (s *Storage) ShouldEvict() bool {
-	return s.Mem() >= s.memoryThreshold
+	mem := s.Mem()
+	if s.memoryThreshold > 0 {
+		metrics.GetOrCreateHistogram(keyword.MemoryPressureMetricName).Update(float64(mem) / float64(s.memoryThreshold))
+	}
+	return mem >= s.memoryThreshold
+}
+
+// requestAttrs builds the common span attributes for a cache operation keyed by req.
+func requestAttrs(req *model.Request) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("mapKey", strconv.FormatUint(req.MapKey(), 16)),
+		attribute.String("shardKey", strconv.FormatUint(req.ShardKey(), 16)),
+		attribute.Int64("weight", req.Weight()),
+	}
+	if rule := req.Rule(); rule != nil {
+		attrs = append(attrs, attribute.String("rule.path", rule.Path))
+	}
+	return attrs
 }
@@ -58,28 +58,6 @@ func (smap *Map[V]) Remove(key uint64) (freed int64, isHit bool) {
 	return smap.Shard(key).Remove(key)
 }
 
-// Walk applies fn to all key/value pairs in the shard, optionally locking for writing.
-func (shard *Shard[V]) Walk(ctx context.Context, fn func(uint64, V) bool, lockRead bool) {
-	if lockRead {
-		shard.Lock()
-		defer shard.Unlock()
-	} else {
-		shard.RLock()
-		defer shard.RUnlock()
-	}
-	for k, v := range shard.items {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			ok := fn(k, v)
-			if !ok {
-				return
-			}
-		}
-	}
-}
-
 // Shard returns the shard that stores the given key.
 func (smap *Map[V]) Shard(key uint64) *Shard[V] {
 	return smap.shards[MapShardKey(key)]
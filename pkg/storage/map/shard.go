@@ -1,26 +1,33 @@
 package sharded
 
 import (
-	"sync"
-	"sync/atomic"
+	"context"
+
+	"github.com/caddyserver/caddy/v2/pkg/linkedmap"
 )
 
-// Shard is a single partition of the sharded map.
-// Each shard is an independent concurrent map with its own lock and refCounted pool for releasers.
+// WeightObserver is notified whenever a Shard's Weight() changes, so an external weight-ordered
+// structure (e.g. lru.Balance's skip list of shards) can reposition it without polling. Set via
+// Observe.
+type WeightObserver interface {
+	OnWeightChanged(shardID uint64)
+}
+
+// Shard is a single partition of the sharded map. Each shard is an independent concurrent
+// linked-hashmap: linkedmap.Map already gives it O(1) Get/Set/Remove plus Weight/Len accounting and
+// an access-ordered element chain, so it also backs this shard's LRU position directly -- no side
+// list to keep in sync by hand.
 type Shard[V Value] struct {
-	*sync.RWMutex              // Shard-level RWMutex for concurrency
-	items         map[uint64]V // Actual storage: key -> Value
-	id            uint64       // Shard ID (index)
-	mem           int64        // Weight usage in bytes (atomic)
-	len           int64        // Length as int64 for use it as atomic
+	id  uint64 // Shard ID (index)
+	lm  *linkedmap.Map[uint64, V]
+	obs WeightObserver
 }
 
-// NewShard creates a new shard with its own lock, value map, and releaser pool.
+// NewShard creates a new shard with its own linked-hashmap.
 func NewShard[V Value](id uint64, defaultLen int) *Shard[V] {
 	return &Shard[V]{
-		id:      id,
-		RWMutex: &sync.RWMutex{},
-		items:   make(map[uint64]V, defaultLen),
+		id: id,
+		lm: linkedmap.New[uint64, V](defaultLen),
 	}
 }
 
@@ -29,62 +36,75 @@ func (shard *Shard[V]) ID() uint64 {
 	return shard.id
 }
 
+// Observe registers obs to be notified every time this shard's Weight() changes.
+func (shard *Shard[V]) Observe(obs WeightObserver) {
+	shard.obs = obs
+}
+
 // Weight returns an approximate total memory usage for this shard (including overhead).
 func (shard *Shard[V]) Weight() int64 {
-	return atomic.LoadInt64(&shard.mem)
+	return shard.lm.Weight()
 }
 
 func (shard *Shard[V]) Len() int64 {
-	return atomic.LoadInt64(&shard.len)
+	return int64(shard.lm.Len())
 }
 
-// Set inserts or updates a value by key, resets refCount, and updates counters.
-// Returns a releaser for the inserted value.
+// Set inserts or updates a value by key, moving it to the front of this shard's access order, and
+// notifies the registered WeightObserver (if any) that this shard's Weight() may have changed.
 func (shard *Shard[V]) Set(key uint64, value V) (takenMem int64) {
-	shard.Lock()
-	var memDiff int64
-	found, ok := shard.items[key]
-	if ok {
-		memDiff = value.Weight() - found.Weight()
-	} else {
-		memDiff = value.Weight()
+	shard.lm.Put(key, value)
+	if shard.obs != nil {
+		shard.obs.OnWeightChanged(shard.id)
 	}
-	shard.items[key] = value
-	shard.Unlock()
-
-	takenMem = value.Weight()
-	atomic.AddInt64(&shard.len, 1)
-	atomic.AddInt64(&shard.mem, memDiff)
-
-	// Return a releaser for this value (for the user to release later).
-	return takenMem
+	return value.Weight()
 }
 
-// Get retrieves a value and returns a releaser for it, incrementing its refCount.
-// Returns (value, releaser, true) if found; otherwise (zero, nil, false).
+// Get retrieves a value by key without touching its position in the access order.
 func (shard *Shard[V]) Get(key uint64) (val V, isHit bool) {
-	shard.RLock()
-	value, ok := shard.items[key]
-	shard.RUnlock()
-	return value, ok
+	return shard.lm.Get(key)
 }
 
-// Remove removes a value from the shard, decrements counters, and may trigger full resource cleanup.
-// Returns (memory_freed, pointer_to_list_element, was_found).
+// Remove removes a value from the shard, returns the memory freed, and notifies the registered
+// WeightObserver (if any) that this shard's Weight() may have changed.
 func (shard *Shard[V]) Remove(key uint64) (freed int64, isHit bool) {
-	shard.Lock()
-	v, ok := shard.items[key]
-	if ok {
-		delete(shard.items, key)
-		shard.Unlock()
+	value, ok := shard.lm.Delete(key)
+	if !ok {
+		return 0, false
+	}
+	if shard.obs != nil {
+		shard.obs.OnWeightChanged(shard.id)
+	}
+	return value.Weight(), true
+}
 
-		weight := v.Weight()
-		atomic.AddInt64(&shard.len, -1)
-		atomic.AddInt64(&shard.mem, -weight)
+// Touch moves key to the front of this shard's access order without changing its value. Used by
+// lru.Balance.Update to record a cache hit.
+func (shard *Shard[V]) Touch(key uint64) bool {
+	return shard.lm.MoveToFront(key)
+}
 
-		return weight, true
-	}
-	shard.Unlock()
+// Oldest returns the least recently touched value in the shard -- the natural eviction candidate.
+func (shard *Shard[V]) Oldest() (val V, found bool) {
+	return shard.lm.Oldest()
+}
+
+// Next returns the value at the given offset from the front of this shard's access order (0-based).
+// Used by background eviction/evacuation sampling to step through a shard's entries by offset.
+func (shard *Shard[V]) Next(offset int) (val V, found bool) {
+	return shard.lm.Next(offset)
+}
 
-	return 0, false
+// Walk applies fn to every key/value pair in the shard, in access order, until fn returns false or
+// ctx is done. lockRead is accepted for API compatibility with callers that used to choose between a
+// write-lock and a read-lock walk; linkedmap.Map.Walk always takes its own read lock, so it's unused.
+func (shard *Shard[V]) Walk(ctx context.Context, fn func(uint64, V) bool, _ bool) {
+	shard.lm.Walk(func(key uint64, value V) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		default:
+			return fn(key, value)
+		}
+	})
 }
@@ -0,0 +1,220 @@
+// Package memcached is a storage.Storage implementation backed by a remote Memcached cluster, so
+// several Caddy instances can share one cache and entries survive a process restart without relying
+// on storage.Dump file recovery.
+package memcached
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/caddyserver/caddy/v2/pkg/config"
+	"github.com/caddyserver/caddy/v2/pkg/model"
+	"github.com/caddyserver/caddy/v2/pkg/repository"
+	"github.com/caddyserver/caddy/v2/pkg/singleflight"
+	"github.com/caddyserver/caddy/v2/pkg/storage"
+	"github.com/rs/zerolog/log"
+)
+
+func init() {
+	storage.RegisterDriver("memcached", func(ctx context.Context, cfg *config.Cache, backend repository.Backender) (storage.Storage, error) {
+		return NewStorage(cfg, backend), nil
+	})
+}
+
+// sampleRingCapacity bounds how many recently-Set keys Storage remembers for GetRandom: the
+// memcached protocol has no RANDOMKEY/SCAN equivalent, so a true uniform sample isn't possible
+// without an external key index. Sampling from the most recently written keys is a deliberately
+// approximate stand-in, good enough for the callers that use GetRandom today (background refresh
+// sampling, shard evacuation previews) but not a statistically uniform sample of the whole cache.
+const sampleRingCapacity = 4096
+
+// Storage caches *model.Response in Memcached, keyed by "<namespace>:<mapKey base36>", encoded via
+// storage.EncodeResponse/DecodeResponse (the same compact msgpack form Dump writes to disk).
+type Storage struct {
+	cfg       *config.Cache
+	backend   repository.Backender
+	client    *memcache.Client
+	namespace string
+	inflight  *singleflight.Group[*model.Response]
+
+	mu         sync.Mutex
+	sampleKeys []string // ring buffer of recently-Set keys, oldest overwritten first
+	sampleNext int
+
+	mem    int64 // approximate: sum of Weight() across everything this instance has Set
+	length int64 // approximate: net Set/Remove count from this instance
+}
+
+// NewStorage connects to cfg.Cache.Storage.Memcached.Addrs. Connection errors surface lazily, on
+// the first failing command.
+func NewStorage(cfg *config.Cache, backend repository.Backender) *Storage {
+	return &Storage{
+		cfg:        cfg,
+		backend:    backend,
+		client:     memcache.New(cfg.Cache.Storage.Memcached.Addrs...),
+		namespace:  cfg.Cache.Storage.Memcached.Namespace,
+		inflight:   singleflight.New[*model.Response](),
+		sampleKeys: make([]string, 0, sampleRingCapacity),
+	}
+}
+
+var _ storage.Storage = (*Storage)(nil)
+
+func (s *Storage) Run() {}
+
+// Ping checks connectivity against whichever configured server the reserved health-check key
+// hashes to (the gomemcache client picks a server per key). The client has no dedicated PING verb,
+// so a no-op-ish Get on that key stands in for one; a cache-miss (item not found) still means the
+// round-trip succeeded.
+func (s *Storage) Ping(_ context.Context) error {
+	_, err := s.client.Get(s.namespace + ":__ping__")
+	if err == memcache.ErrCacheMiss {
+		return nil
+	}
+	return err
+}
+
+func (s *Storage) key(mapKey uint64) string {
+	return s.namespace + ":" + strconv.FormatUint(mapKey, 36)
+}
+
+func (s *Storage) Get(req *model.Request) (*model.Response, bool) {
+	item, err := s.client.Get(s.key(req.MapKey()))
+	if err != nil {
+		return nil, false
+	}
+
+	resp, err := storage.DecodeResponse(s.cfg, s.backend, item.Value)
+	if err != nil {
+		log.Error().Err(err).Msg("[storage/memcached] decode error")
+		return nil, false
+	}
+	return resp, true
+}
+
+// GetOrLoad coalesces concurrent misses on the same req.MapKey() within this instance; it does not
+// coordinate across instances sharing the same Memcached cluster (pair it with a
+// storage.RefreshCoordinator for that).
+func (s *Storage) GetOrLoad(req *model.Request, loader func() (*model.Response, error)) (resp *model.Response, shared bool, err error) {
+	if resp, isHit := s.Get(req); isHit {
+		return resp, true, nil
+	}
+
+	resp, err, shared = s.inflight.Do(req.MapKey(), func() (*model.Response, error) {
+		loaded, loadErr := loader()
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		if loaded != nil {
+			s.Set(loaded)
+		}
+		return loaded, nil
+	})
+	return resp, shared, err
+}
+
+// GetRandom picks uniformly among the recently-Set keys remembered in sampleKeys; see
+// sampleRingCapacity's doc comment for why this is approximate rather than a true random sample.
+func (s *Storage) GetRandom() (resp *model.Response, isFound bool) {
+	s.mu.Lock()
+	if len(s.sampleKeys) == 0 {
+		s.mu.Unlock()
+		return nil, false
+	}
+	key := s.sampleKeys[rand.IntN(len(s.sampleKeys))]
+	s.mu.Unlock()
+
+	item, err := s.client.Get(key)
+	if err != nil {
+		return nil, false
+	}
+	resp, err = storage.DecodeResponse(s.cfg, s.backend, item.Value)
+	if err != nil {
+		return nil, false
+	}
+	return resp, true
+}
+
+func (s *Storage) Set(resp *model.Response) {
+	payload, err := storage.EncodeResponse(resp)
+	if err != nil {
+		log.Error().Err(err).Msg("[storage/memcached] encode error")
+		return
+	}
+
+	expiry := s.cfg.Cache.Refresh.TTL
+	if rule := resp.Request().Rule(); rule != nil && rule.TTL != 0 {
+		expiry = rule.TTL
+	}
+
+	key := s.key(resp.Request().MapKey())
+	_, getErr := s.client.Get(key)
+	existed := getErr == nil
+
+	item := &memcache.Item{Key: key, Value: payload, Expiration: int32(expiry.Seconds())}
+	if err := s.client.Set(item); err != nil {
+		log.Error().Err(err).Msg("[storage/memcached] set error")
+		return
+	}
+
+	s.rememberKey(key)
+	atomic.AddInt64(&s.mem, resp.Weight())
+	if !existed {
+		atomic.AddInt64(&s.length, 1)
+	}
+}
+
+func (s *Storage) rememberKey(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.sampleKeys) < sampleRingCapacity {
+		s.sampleKeys = append(s.sampleKeys, key)
+		return
+	}
+	s.sampleKeys[s.sampleNext] = key
+	s.sampleNext = (s.sampleNext + 1) % sampleRingCapacity
+}
+
+func (s *Storage) Remove(resp *model.Response) (freedBytes int64, isHit bool) {
+	key := s.key(resp.Request().MapKey())
+	if err := s.client.Delete(key); err != nil {
+		return 0, false
+	}
+	freedBytes = resp.Weight()
+	atomic.AddInt64(&s.mem, -freedBytes)
+	atomic.AddInt64(&s.length, -1)
+	return freedBytes, true
+}
+
+// RemoveByKey removes the entry at mapKey without the caller having its *model.Response in hand,
+// by decoding it first so Weight-based bookkeeping (s.mem) stays accurate. Used by
+// pkg/storage/invalidation to apply a peer's purge, which only carries the key hash over the wire.
+func (s *Storage) RemoveByKey(mapKey uint64) (freedBytes int64, isHit bool) {
+	item, err := s.client.Get(s.key(mapKey))
+	if err != nil {
+		return 0, false
+	}
+	resp, err := storage.DecodeResponse(s.cfg, s.backend, item.Value)
+	if err != nil {
+		return 0, false
+	}
+	return s.Remove(resp)
+}
+
+var _ storage.KeyRemover = (*Storage)(nil)
+
+func (s *Storage) Stat() (bytes int64, length int64) {
+	return atomic.LoadInt64(&s.mem), atomic.LoadInt64(&s.length)
+}
+
+// Mem returns the locally-tracked Weight total: Memcached exposes only cluster-wide slab stats, not
+// a per-namespace figure cheap enough to poll per request.
+func (s *Storage) Mem() int64 { return atomic.LoadInt64(&s.mem) }
+
+// RealMem is Mem: unlike the in-process "malloc" backend there's no cheaper, staler estimate to
+// fall back to here.
+func (s *Storage) RealMem() int64 { return s.Mem() }
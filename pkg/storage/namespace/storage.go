@@ -0,0 +1,181 @@
+// Package namespace lets many independently configured Caddy sites (or tenants) share one physical
+// storage.Storage backend (typically redis or pebble) without their cache keys colliding, by mixing
+// a per-instance namespace hash into every key before delegating to the wrapped Storage.
+package namespace
+
+import (
+	"context"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2/pkg/model"
+	"github.com/caddyserver/caddy/v2/pkg/storage"
+	sharded "github.com/caddyserver/caddy/v2/pkg/storage/map"
+	"github.com/zeebo/xxh3"
+)
+
+// entry is what Storage indexes locally per namespaced key, since next has no notion of namespaces
+// of its own and so can't answer "which keys belong to this namespace" on its own: req is the
+// original (unmixed) request, needed to re-fetch through Get for GetRandom/RemoveNamespace, and
+// weight backs Stat/Mem without round-tripping to next.
+type entry struct {
+	req    *model.Request
+	weight int64
+}
+
+// Storage wraps next, mixing every request's MapKey with a hash of ns before delegating, and
+// restoring the original (unmixed) request on every Response handed back to the caller so layers
+// above this one never observe the namespaced keyspace.
+type Storage struct {
+	next   storage.Storage
+	ns     string
+	nsHash uint64
+
+	mu    sync.RWMutex
+	index map[uint64]entry // namespaced MapKey -> entry
+}
+
+// Wrap decorates next so every key it sees is namespaced under ns.
+func Wrap(next storage.Storage, ns string) *Storage {
+	return &Storage{
+		next:   next,
+		ns:     ns,
+		nsHash: xxh3.HashString(ns),
+		index:  make(map[uint64]entry),
+	}
+}
+
+var _ storage.Storage = (*Storage)(nil)
+
+func (s *Storage) Run()                           { s.next.Run() }
+func (s *Storage) Ping(ctx context.Context) error { return s.next.Ping(ctx) }
+
+// namespaced returns req remapped into this namespace's slice of next's keyspace. XOR-combining the
+// namespace hash with the key (rather than, say, hashing the pair together) keeps the mapping cheap
+// and trivially reversible, though nothing here relies on reversing it: callers always have the
+// original req in hand to restore via Response.WithRequest/this req itself.
+func (s *Storage) namespaced(req *model.Request) *model.Request {
+	key := req.MapKey() ^ s.nsHash
+	return req.WithMapKey(key, sharded.MapShardKey(key))
+}
+
+func (s *Storage) Get(req *model.Request) (*model.Response, bool) {
+	resp, isHit := s.next.Get(s.namespaced(req))
+	if !isHit {
+		return nil, false
+	}
+	return resp.WithRequest(req), true
+}
+
+func (s *Storage) GetOrLoad(req *model.Request, loader func() (*model.Response, error)) (*model.Response, bool, error) {
+	nsReq := s.namespaced(req)
+
+	resp, shared, err := s.next.GetOrLoad(nsReq, func() (*model.Response, error) {
+		loaded, loadErr := loader()
+		if loadErr != nil || loaded == nil {
+			return loaded, loadErr
+		}
+		return loaded.WithRequest(nsReq), nil
+	})
+	if resp == nil {
+		return nil, shared, err
+	}
+	s.track(req, nsReq.MapKey(), resp.Weight())
+	return resp.WithRequest(req), shared, err
+}
+
+// GetRandom picks an arbitrary entry out of this namespace's own index (Go's randomized map
+// iteration order stands in for real sampling here) and re-fetches it through Get, so the returned
+// Response reflects next's current state rather than a possibly-stale cached entry weight.
+func (s *Storage) GetRandom() (*model.Response, bool) {
+	s.mu.RLock()
+	var req *model.Request
+	for _, e := range s.index {
+		req = e.req
+		break
+	}
+	s.mu.RUnlock()
+
+	if req == nil {
+		return nil, false
+	}
+	return s.Get(req)
+}
+
+func (s *Storage) Set(resp *model.Response) {
+	req := resp.Request()
+	nsReq := s.namespaced(req)
+	s.next.Set(resp.WithRequest(nsReq))
+	s.track(req, nsReq.MapKey(), resp.Weight())
+}
+
+func (s *Storage) Remove(resp *model.Response) (freedBytes int64, isHit bool) {
+	nsReq := s.namespaced(resp.Request())
+	freedBytes, isHit = s.next.Remove(resp.WithRequest(nsReq))
+	if isHit {
+		s.untrack(nsReq.MapKey())
+	}
+	return freedBytes, isHit
+}
+
+// RemoveNamespace purges every entry this Storage instance currently indexes. ns must match the
+// namespace it was constructed with — a guard against an accidental purge via the wrong instance if
+// two namespaces' Storages are ever mixed up by a caller — and is a no-op (returning 0) otherwise.
+func (s *Storage) RemoveNamespace(ns string) (removed int) {
+	if ns != s.ns {
+		return 0
+	}
+
+	s.mu.RLock()
+	reqs := make([]*model.Request, 0, len(s.index))
+	for _, e := range s.index {
+		reqs = append(reqs, e.req)
+	}
+	s.mu.RUnlock()
+
+	for _, req := range reqs {
+		resp, isHit := s.Get(req)
+		if !isHit {
+			continue
+		}
+		if _, ok := s.Remove(resp); ok {
+			removed++
+		}
+	}
+	return removed
+}
+
+// Stat reports only this namespace's slice of next's usage, tallied from the local index rather
+// than asked of next (which has no notion of namespaces to slice by in the first place).
+func (s *Storage) Stat() (bytes int64, length int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, e := range s.index {
+		bytes += e.weight
+	}
+	return bytes, int64(len(s.index))
+}
+
+func (s *Storage) Mem() int64 {
+	bytes, _ := s.Stat()
+	return bytes
+}
+
+func (s *Storage) RealMem() int64 {
+	bytes, _ := s.Stat()
+	return bytes
+}
+
+// track records weight for physicalKey (the namespaced MapKey actually stored in next), keyed
+// against origReq (the caller-visible, unmixed request) so GetRandom/RemoveNamespace can re-fetch
+// through the normal Get path rather than double-namespacing an already-mixed key.
+func (s *Storage) track(origReq *model.Request, physicalKey uint64, weight int64) {
+	s.mu.Lock()
+	s.index[physicalKey] = entry{req: origReq, weight: weight}
+	s.mu.Unlock()
+}
+
+func (s *Storage) untrack(mapKey uint64) {
+	s.mu.Lock()
+	delete(s.index, mapKey)
+	s.mu.Unlock()
+}
@@ -0,0 +1,18 @@
+package storage
+
+import "context"
+
+// NoopRunner satisfies both Evictor and Refresher for Storage backends that manage their own
+// eviction/expiry out of process (Redis, Memcached, Pebble) and therefore have no balancer/shard
+// model for this package's threshold-driven eviction or sampling-based refresh to operate on.
+type NoopRunner struct{}
+
+func (NoopRunner) Run() {}
+
+// NoopDumper satisfies Dumper for Storage backends that persist themselves (Redis, Memcached,
+// Pebble): storage.Dump's shard-file format assumes the in-process sharded map, so these backends
+// skip it rather than faking a dump cycle that would duplicate data already durable in the backend.
+type NoopDumper struct{}
+
+func (NoopDumper) Dump(_ context.Context) error { return dumpIsNotEnabledErr }
+func (NoopDumper) Load(_ context.Context) error { return dumpIsNotEnabledErr }
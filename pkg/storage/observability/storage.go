@@ -0,0 +1,182 @@
+// Package observability wraps any storage.Storage with Prometheus metrics, so operators get hit
+// ratios, per-operation tail latencies, and size gauges for whichever backend cfg.Cache.Storage.Type
+// (or pkg/storage/tiered chain) actually picked, without each backend package instrumenting itself.
+package observability
+
+import (
+	"context"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/caddyserver/caddy/v2/pkg/model"
+	"github.com/caddyserver/caddy/v2/pkg/prometheus/metrics/keyword"
+	"github.com/caddyserver/caddy/v2/pkg/storage"
+	"github.com/caddyserver/caddy/v2/pkg/storage/invalidation"
+)
+
+// Storage wraps an underlying storage.Storage, emitting:
+//   - cache_ops_total{op,result} — one of "hit"/"miss"/"error" per call
+//   - cache_op_duration_seconds{op} — a histogram per operation
+//   - cache_bytes / cache_items — gauges pulled from the wrapped Mem()/Stat()
+type Storage struct {
+	next storage.Storage
+}
+
+// Wrap decorates next with Prometheus instrumentation. It's transparent: every call is forwarded
+// to next unchanged, only timed and counted around it.
+func Wrap(next storage.Storage) *Storage {
+	return &Storage{next: next}
+}
+
+var _ storage.Storage = (*Storage)(nil)
+
+const (
+	opGet       = "get"
+	opGetOrLoad = "get_or_load"
+	opGetRandom = "get_random"
+	opSet       = "set"
+	opRemove    = "remove"
+
+	resultHit   = "hit"
+	resultMiss  = "miss"
+	resultError = "error"
+)
+
+func observe(op string, start time.Time, result string) {
+	metrics.GetOrCreateHistogram(labeled(keyword.CacheOpDurationSecondsMetricName, "op", op)).Update(time.Since(start).Seconds())
+	metrics.GetOrCreateCounter(labeled2(keyword.CacheOpsTotalMetricName, "op", op, "result", result)).Inc()
+}
+
+func labeled(metricName, labelName, labelValue string) string {
+	buf := make([]byte, 0, len(metricName)+len(labelName)+len(labelValue)+8)
+	buf = append(buf, metricName...)
+	buf = append(buf, '{')
+	buf = append(buf, labelName...)
+	buf = append(buf, `="`...)
+	buf = append(buf, labelValue...)
+	buf = append(buf, `"}`...)
+	return string(buf)
+}
+
+func labeled2(metricName, label1Name, label1Value, label2Name, label2Value string) string {
+	buf := make([]byte, 0, len(metricName)+len(label1Name)+len(label1Value)+len(label2Name)+len(label2Value)+12)
+	buf = append(buf, metricName...)
+	buf = append(buf, '{')
+	buf = append(buf, label1Name...)
+	buf = append(buf, `="`...)
+	buf = append(buf, label1Value...)
+	buf = append(buf, `",`...)
+	buf = append(buf, label2Name...)
+	buf = append(buf, `="`...)
+	buf = append(buf, label2Value...)
+	buf = append(buf, `"}`...)
+	return string(buf)
+}
+
+func (s *Storage) Run() { s.next.Run() }
+
+func (s *Storage) Ping(ctx context.Context) error { return s.next.Ping(ctx) }
+
+func (s *Storage) Get(req *model.Request) (resp *model.Response, isHit bool) {
+	start := time.Now()
+	resp, isHit = s.next.Get(req)
+	result := resultMiss
+	if isHit {
+		result = resultHit
+	}
+	observe(opGet, start, result)
+	return resp, isHit
+}
+
+func (s *Storage) GetOrLoad(req *model.Request, loader func() (*model.Response, error)) (resp *model.Response, shared bool, err error) {
+	start := time.Now()
+	resp, shared, err = s.next.GetOrLoad(req, loader)
+	result := resultMiss
+	switch {
+	case err != nil:
+		result = resultError
+	case shared:
+		result = resultHit
+	}
+	observe(opGetOrLoad, start, result)
+	return resp, shared, err
+}
+
+func (s *Storage) GetRandom() (resp *model.Response, isFound bool) {
+	start := time.Now()
+	resp, isFound = s.next.GetRandom()
+	result := resultMiss
+	if isFound {
+		result = resultHit
+	}
+	observe(opGetRandom, start, result)
+	return resp, isFound
+}
+
+func (s *Storage) Set(resp *model.Response) {
+	start := time.Now()
+	s.next.Set(resp)
+	observe(opSet, start, resultHit)
+	s.reportGauges()
+}
+
+func (s *Storage) Remove(resp *model.Response) (freedBytes int64, isHit bool) {
+	start := time.Now()
+	freedBytes, isHit = s.next.Remove(resp)
+	result := resultMiss
+	if isHit {
+		result = resultHit
+	}
+	observe(opRemove, start, result)
+	s.reportGauges()
+	return freedBytes, isHit
+}
+
+// RemoveByKey forwards to next if it implements storage.KeyRemover, instrumented the same as
+// Remove; it reports a miss if next doesn't support key-based removal at all.
+func (s *Storage) RemoveByKey(mapKey uint64) (freedBytes int64, isHit bool) {
+	kr, ok := s.next.(storage.KeyRemover)
+	if !ok {
+		return 0, false
+	}
+	start := time.Now()
+	freedBytes, isHit = kr.RemoveByKey(mapKey)
+	result := resultMiss
+	if isHit {
+		result = resultHit
+	}
+	observe(opRemove, start, result)
+	s.reportGauges()
+	return freedBytes, isHit
+}
+
+// RemoveByPattern forwards to next if it implements invalidation.PatternRemover (lru.Storage, and
+// the tiered/invalidation decorators, which forward in turn), reporting a no-op removal if next
+// doesn't support pattern-based removal at all.
+func (s *Storage) RemoveByPattern(pattern string) (freedBytes int64, removed int) {
+	pr, ok := s.next.(invalidation.PatternRemover)
+	if !ok {
+		return 0, 0
+	}
+	start := time.Now()
+	freedBytes, removed = pr.RemoveByPattern(pattern)
+	result := resultMiss
+	if removed > 0 {
+		result = resultHit
+	}
+	observe(opRemove, start, result)
+	s.reportGauges()
+	return freedBytes, removed
+}
+
+func (s *Storage) reportGauges() {
+	bytes, length := s.next.Stat()
+	metrics.GetOrCreateCounter(keyword.CacheBytesMetricName).Set(uint64(bytes))
+	metrics.GetOrCreateCounter(keyword.CacheItemsMetricName).Set(uint64(length))
+}
+
+func (s *Storage) Stat() (bytes int64, length int64) { return s.next.Stat() }
+
+func (s *Storage) Mem() int64 { return s.next.Mem() }
+
+func (s *Storage) RealMem() int64 { return s.next.RealMem() }
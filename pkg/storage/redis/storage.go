@@ -0,0 +1,189 @@
+// Package redis is a storage.Storage implementation backed by a remote Redis instance, so several
+// Caddy instances can share one cache and entries survive a process restart without relying on
+// storage.Dump file recovery.
+package redis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/caddyserver/caddy/v2/pkg/config"
+	"github.com/caddyserver/caddy/v2/pkg/model"
+	"github.com/caddyserver/caddy/v2/pkg/repository"
+	"github.com/caddyserver/caddy/v2/pkg/singleflight"
+	"github.com/caddyserver/caddy/v2/pkg/storage"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+func init() {
+	storage.RegisterDriver("redis", func(ctx context.Context, cfg *config.Cache, backend repository.Backender) (storage.Storage, error) {
+		return NewStorage(ctx, cfg, backend), nil
+	})
+}
+
+// randomKeyAttempts bounds how many times Storage.GetRandom re-rolls client.RandomKey() looking for
+// a key under this instance's namespace before giving up; RANDOMKEY has no notion of a prefix, so a
+// shared Redis with other namespaces (or an empty one) can otherwise spin forever.
+const randomKeyAttempts = 8
+
+// Storage caches *model.Response in Redis, keyed by "<namespace>:<mapKey base36>", encoded via
+// storage.EncodeResponse/DecodeResponse (the same compact msgpack form Dump writes to disk).
+type Storage struct {
+	ctx       context.Context
+	cfg       *config.Cache
+	backend   repository.Backender
+	client    *redis.Client
+	namespace string
+	inflight  *singleflight.Group[*model.Response]
+	mem       int64 // approximate: sum of Weight() across everything this instance has Set, see Mem
+	length    int64 // approximate: net Set/Remove count from this instance
+}
+
+// NewStorage dials cfg.Cache.Storage.Redis.Addr. Connection errors surface lazily, on the first
+// failing command, matching storage.coordinator.RedisCoordinator's style.
+func NewStorage(ctx context.Context, cfg *config.Cache, backend repository.Backender) *Storage {
+	return &Storage{
+		ctx:       ctx,
+		cfg:       cfg,
+		backend:   backend,
+		client:    redis.NewClient(&redis.Options{Addr: cfg.Cache.Storage.Redis.Addr}),
+		namespace: cfg.Cache.Storage.Redis.Namespace,
+		inflight:  singleflight.New[*model.Response](),
+	}
+}
+
+var _ storage.Storage = (*Storage)(nil)
+
+func (s *Storage) Run() {}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+func (s *Storage) key(mapKey uint64) string {
+	return s.namespace + ":" + strconv.FormatUint(mapKey, 36)
+}
+
+func (s *Storage) Get(req *model.Request) (*model.Response, bool) {
+	payload, err := s.client.Get(s.ctx, s.key(req.MapKey())).Bytes()
+	if err != nil {
+		return nil, false
+	}
+
+	resp, err := storage.DecodeResponse(s.cfg, s.backend, payload)
+	if err != nil {
+		log.Error().Err(err).Msg("[storage/redis] decode error")
+		return nil, false
+	}
+	return resp, true
+}
+
+// GetOrLoad coalesces concurrent misses on the same req.MapKey() within this instance; it does not
+// coordinate across instances sharing the same Redis (pair it with a storage.RefreshCoordinator for
+// that).
+func (s *Storage) GetOrLoad(req *model.Request, loader func() (*model.Response, error)) (resp *model.Response, shared bool, err error) {
+	if resp, isHit := s.Get(req); isHit {
+		return resp, true, nil
+	}
+
+	resp, err, shared = s.inflight.Do(req.MapKey(), func() (*model.Response, error) {
+		loaded, loadErr := loader()
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		if loaded != nil {
+			s.Set(loaded)
+		}
+		return loaded, nil
+	})
+	return resp, shared, err
+}
+
+// GetRandom re-rolls RANDOMKEY up to randomKeyAttempts times looking for a key under this
+// instance's namespace, since RANDOMKEY itself can't be scoped to a prefix.
+func (s *Storage) GetRandom() (resp *model.Response, isFound bool) {
+	prefix := s.namespace + ":"
+	for i := 0; i < randomKeyAttempts; i++ {
+		key, err := s.client.RandomKey(s.ctx).Result()
+		if err != nil || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		payload, err := s.client.Get(s.ctx, key).Bytes()
+		if err != nil {
+			continue
+		}
+		resp, err = storage.DecodeResponse(s.cfg, s.backend, payload)
+		if err != nil {
+			continue
+		}
+		return resp, true
+	}
+	return nil, false
+}
+
+func (s *Storage) Set(resp *model.Response) {
+	payload, err := storage.EncodeResponse(resp)
+	if err != nil {
+		log.Error().Err(err).Msg("[storage/redis] encode error")
+		return
+	}
+
+	expiry := s.cfg.Cache.Refresh.TTL
+	if rule := resp.Request().Rule(); rule != nil && rule.TTL != 0 {
+		expiry = rule.TTL
+	}
+
+	key := s.key(resp.Request().MapKey())
+	existed := s.client.Exists(s.ctx, key).Val() == 1
+	if err := s.client.Set(s.ctx, key, payload, expiry).Err(); err != nil {
+		log.Error().Err(err).Msg("[storage/redis] set error")
+		return
+	}
+	atomic.AddInt64(&s.mem, resp.Weight())
+	if !existed {
+		atomic.AddInt64(&s.length, 1)
+	}
+}
+
+func (s *Storage) Remove(resp *model.Response) (freedBytes int64, isHit bool) {
+	n, err := s.client.Del(s.ctx, s.key(resp.Request().MapKey())).Result()
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	freedBytes = resp.Weight()
+	atomic.AddInt64(&s.mem, -freedBytes)
+	atomic.AddInt64(&s.length, -1)
+	return freedBytes, true
+}
+
+// RemoveByKey removes the entry at mapKey without the caller having its *model.Response in hand,
+// by decoding it first so Weight-based bookkeeping (s.mem) stays accurate. Used by
+// pkg/storage/invalidation to apply a peer's purge, which only carries the key hash over the wire.
+func (s *Storage) RemoveByKey(mapKey uint64) (freedBytes int64, isHit bool) {
+	payload, err := s.client.Get(s.ctx, s.key(mapKey)).Bytes()
+	if err != nil {
+		return 0, false
+	}
+	resp, err := storage.DecodeResponse(s.cfg, s.backend, payload)
+	if err != nil {
+		return 0, false
+	}
+	return s.Remove(resp)
+}
+
+var _ storage.KeyRemover = (*Storage)(nil)
+
+func (s *Storage) Stat() (bytes int64, length int64) {
+	return atomic.LoadInt64(&s.mem), atomic.LoadInt64(&s.length)
+}
+
+// Mem returns the locally-tracked Weight total rather than Redis's own memory usage (INFO MEMORY
+// reflects the whole instance, not just this namespace, and is too expensive to poll per request).
+func (s *Storage) Mem() int64 { return atomic.LoadInt64(&s.mem) }
+
+// RealMem is Mem: unlike the in-process "malloc" backend there's no cheaper, staler estimate to
+// fall back to here.
+func (s *Storage) RealMem() int64 { return s.Mem() }
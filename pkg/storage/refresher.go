@@ -8,41 +8,76 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/VictoriaMetrics/metrics"
 	"github.com/caddyserver/caddy/v2/pkg/config"
 	"github.com/caddyserver/caddy/v2/pkg/model"
+	"github.com/caddyserver/caddy/v2/pkg/prometheus/metrics/keyword"
+	"github.com/caddyserver/caddy/v2/pkg/telemetry"
 	"github.com/caddyserver/caddy/v2/pkg/utils"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Refresher interface {
 	Run()
 }
 
+// RefreshCoordinator lets several Caddy instances refreshing the same origin avoid independently
+// revalidating the same key. Acquire is called once per candidate, right before Revalidate; a
+// false return means some other node already owns (or is mid-flight on) the key, and refreshItem
+// skips it without treating that as an error.
+type RefreshCoordinator interface {
+	Acquire(ctx context.Context, key uint64) bool
+}
+
+// RefreshBroadcaster lets several Caddy instances sharing the same origin avoid redoing each
+// other's background revalidation. PublishRefreshed is called once a refresh of key completes
+// successfully (a full replace or a 304); RecentlyRefreshed is checked before attempting a refresh
+// at all, analogous to how RefreshCoordinator.Acquire gates the lease for who's allowed to
+// refresh, except here any peer having recently refreshed the key is reason enough to skip it,
+// without needing an explicit ownership handoff. Satisfied structurally by
+// invalidation.Coordinator; declared here instead, since invalidation already imports storage and
+// the reverse import would cycle.
+type RefreshBroadcaster interface {
+	PublishRefreshed(ctx context.Context, key uint64) error
+	RecentlyRefreshed(key uint64) bool
+}
+
 // Refresh is responsible for background refreshing of cache entries.
 // It periodically samples random shards and randomly selects "cold" entries
 // (from the end of each shard's Storage list) to refreshItem if necessary.
 type Refresh struct {
-	ctx                 context.Context
-	cfg                 *config.Cache
-	balancer            lru.Balancer
-	scansRateLimiter    *rate.Limiter
-	requestRateLimiter  *rate.Limiter
-	refreshSuccessNumCh chan struct{}
-	refreshErroredNumCh chan struct{}
-	refreshItemsCh      chan *model.Response
+	ctx                     context.Context
+	cfg                     *config.Cache
+	balancer                lru.Balancer
+	coordinator             RefreshCoordinator
+	broadcaster             RefreshBroadcaster
+	tracer                  telemetry.Tracer
+	scansRateLimiter        *rate.Limiter
+	requestRateLimiter      *rate.Limiter
+	refreshRevalidatedNumCh chan struct{}
+	refreshReplacedNumCh    chan struct{}
+	refreshErroredNumCh     chan struct{}
+	refreshItemsCh          chan *model.Response
 }
 
-// NewRefresher constructs a Refresh.
-func NewRefresher(ctx context.Context, cfg *config.Cache, balancer lru.Balancer) *Refresh {
+// NewRefresher constructs a Refresh. coordinator may be nil, meaning this instance refreshes every
+// candidate it samples itself (the historic, single-node behavior). broadcaster may also be nil,
+// meaning this instance never tells peers about its refreshes and never skips one on their say-so.
+func NewRefresher(ctx context.Context, cfg *config.Cache, balancer lru.Balancer, coordinator RefreshCoordinator, broadcaster RefreshBroadcaster) *Refresh {
 	return &Refresh{
-		ctx:                 ctx,
-		cfg:                 cfg,
-		balancer:            balancer,
-		scansRateLimiter:    rate.NewLimiter(ctx, cfg.Cache.Refresh.ScanRate, cfg.Cache.Refresh.ScanRate/10),
-		requestRateLimiter:  rate.NewLimiter(ctx, cfg.Cache.Refresh.Rate, cfg.Cache.Refresh.Rate/10),
-		refreshSuccessNumCh: make(chan struct{}, cfg.Cache.Refresh.Rate),        // Successful refreshes counter channel
-		refreshErroredNumCh: make(chan struct{}, cfg.Cache.Refresh.Rate),        // Failed refreshes counter channel
-		refreshItemsCh:      make(chan *model.Response, cfg.Cache.Refresh.Rate), // Failed refreshes counter channel
+		ctx:                     ctx,
+		cfg:                     cfg,
+		balancer:                balancer,
+		coordinator:             coordinator,
+		broadcaster:             broadcaster,
+		tracer:                  telemetry.New(cfg.Cache.Telemetry.TracingEnabled, "storage.Refresh"),
+		scansRateLimiter:        rate.NewLimiter(ctx, cfg.Cache.Refresh.ScanRate, cfg.Cache.Refresh.ScanRate/10),
+		requestRateLimiter:      rate.NewLimiter(ctx, cfg.Cache.Refresh.Rate, cfg.Cache.Refresh.Rate/10),
+		refreshRevalidatedNumCh: make(chan struct{}, cfg.Cache.Refresh.Rate), // 304 Not Modified counter channel
+		refreshReplacedNumCh:    make(chan struct{}, cfg.Cache.Refresh.Rate), // full-fetch-and-replace counter channel
+		refreshErroredNumCh:     make(chan struct{}, cfg.Cache.Refresh.Rate), // Failed refreshes counter channel
+		refreshItemsCh:          make(chan *model.Response, cfg.Cache.Refresh.Rate),
 	}
 }
 
@@ -62,7 +97,11 @@ func (r *Refresh) runProducer() {
 			case <-r.ctx.Done():
 				return
 			case <-r.scansRateLimiter.Chan():
-				if item := r.balancer.RandNode().RandItem(r.ctx); item.ShouldBeRefreshed() {
+				queueLoad := float64(len(r.refreshItemsCh)) / float64(cap(r.refreshItemsCh))
+				// Stored as permille (0..1000), matching the rest of this package's integer-gauge
+				// convention (see pkg/storage/observability.Storage's cache_bytes/cache_items).
+				metrics.GetOrCreateCounter(keyword.RefreshQueueDepthMetricName).Set(uint64(queueLoad * 1000))
+				if item := r.balancer.RandNode().RandItem(r.ctx); item.ShouldBeRefreshed(queueLoad) {
 					r.refreshItemsCh <- item
 				}
 			}
@@ -78,30 +117,108 @@ func (r *Refresh) runConsumer() {
 	}()
 }
 
-// refreshItem attempts to refreshItem the given response via Revalidate.
-// If successful, increments the refreshItem metric (in debug mode); otherwise increments the error metric.
+// refreshItem attempts to refreshItem the given response via RevalidateConditional.
+// If successful, increments the revalidated or replaced metric (in debug mode); otherwise increments the error metric.
 func (r *Refresh) refreshItem(resp *model.Response) {
 	select {
 	case <-r.ctx.Done():
 		return
 	case <-r.requestRateLimiter.Chan():
 		go func() {
-			// IMPORTANT: r.ctx used in resp.Revalidate(r.ctx) is a correct ctx due to be able to await requests through previous iterations.
+			req := resp.Request()
+
+			// The span is a child of the trace that originally cached this entry (if any), so a
+			// client-initiated trace stays linked across the async refresh; it never governs
+			// cancellation of the refresh itself (see the r.ctx note below).
+			_, span := r.tracer.Start(resp.TraceContext(), "storage.Refresh.refreshItem",
+				attribute.String("mapKey", strconv.FormatUint(req.MapKey(), 16)),
+				attribute.String("shardKey", strconv.FormatUint(req.ShardKey(), 16)),
+				attribute.Int64("weight", resp.Weight()),
+			)
+			defer span.End()
+			if rule := req.Rule(); rule != nil {
+				span.SetAttributes(attribute.String("rule.path", rule.Path))
+			}
+
+			start := time.Now()
+
+			// Skip items some other node already owns the lease on. Not counted as an error: it's
+			// the coordinator working as intended, not a failed refresh.
+			if r.coordinator != nil && !r.coordinator.Acquire(r.ctx, req.MapKey()) {
+				span.SetAttributes(attribute.String("outcome", "skipped"))
+				return
+			}
+
+			// Skip items a peer already revalidated within Cache.Invalidation.RefreshSuppressWindow:
+			// same intent as the lease above, but driven by a "someone just did it" broadcast rather
+			// than an upfront ownership grant, so it costs nothing when no peer has refreshed recently.
+			if r.broadcaster != nil && r.broadcaster.RecentlyRefreshed(req.MapKey()) {
+				span.SetAttributes(attribute.String("outcome", "skipped_peer_refreshed"))
+				return
+			}
+
+			// IMPORTANT: r.ctx used in resp.RevalidateConditional(r.ctx) is a correct ctx due to be able to await requests through previous iterations.
 			// Otherwise, you will have a lot of request errors (context cancelled), because in parent method ctx (from arg) has a timeout in milliseconds
 			// for be able to stop cycles in current iteration and start a new one.
-			if err := resp.Revalidate(r.ctx); err != nil {
+			revalidateCtx, revalidateSpan := r.tracer.Start(r.ctx, "cache.revalidate",
+				attribute.String("mapKey", strconv.FormatUint(req.MapKey(), 16)),
+			)
+			notModified, err := resp.RevalidateConditional(revalidateCtx)
+			revalidateSpan.SetAttributes(attribute.Bool("error", err != nil), attribute.Bool("notModified", notModified))
+			revalidateSpan.End()
+			if err != nil {
+				span.SetAttributes(attribute.String("outcome", "error"))
+				metrics.GetOrCreateHistogram(keyword.RefreshLatencyMsMetricName).Update(time.Since(start).Seconds() * 1000)
+				metrics.GetOrCreateCounter(refreshByRuleMetricName(req, "error")).Inc()
 				if r.cfg.Cache.Logs.Stats {
 					r.refreshErroredNumCh <- struct{}{}
 				}
+				// Past the origin's stale-if-error window (RFC 5861), keep serving the stale entry
+				// regardless (this module has no separate "serve an error" path) but surface it so
+				// operators can tell an entry that's still within tolerance apart from one the origin
+				// never promised to keep serving this long.
+				if !resp.WithinStaleIfError() {
+					log.Warn().Msgf("[refresher] mapKey=%s exceeded its stale-if-error window; still serving stale data", strconv.FormatUint(req.MapKey(), 16))
+				}
 				return
 			}
+
+			metrics.GetOrCreateHistogram(keyword.RefreshLatencyMsMetricName).Update(time.Since(start).Seconds() * 1000)
+			if r.broadcaster != nil {
+				if err := r.broadcaster.PublishRefreshed(r.ctx, req.MapKey()); err != nil {
+					log.Error().Err(err).Msg("[refresher] failed to broadcast refresh completion")
+				}
+			}
+			if notModified {
+				// 304 Not Modified: cheaper than a replace, since it skipped re-caching a body that
+				// hasn't actually changed at the origin.
+				span.SetAttributes(attribute.String("outcome", "revalidated"))
+				metrics.GetOrCreateCounter(refreshByRuleMetricName(req, "revalidated")).Inc()
+				if r.cfg.Cache.Logs.Stats {
+					r.refreshRevalidatedNumCh <- struct{}{}
+				}
+				return
+			}
+			span.SetAttributes(attribute.String("outcome", "replaced"))
+			metrics.GetOrCreateCounter(refreshByRuleMetricName(req, "replaced")).Inc()
 			if r.cfg.Cache.Logs.Stats {
-				r.refreshSuccessNumCh <- struct{}{}
+				r.refreshReplacedNumCh <- struct{}{}
 			}
 		}()
 	}
 }
 
+// refreshByRuleMetricName builds a cache_requests_by_rule_total{rule="...",outcome="..."} series
+// name for background refresh outcomes, sharing pkg/storage/lru.Storage's hit/miss series so
+// operators see hits, misses, and refresh outcomes broken down by the same rule label.
+func refreshByRuleMetricName(req *model.Request, outcome string) string {
+	rulePath := "default"
+	if rule := req.Rule(); rule != nil {
+		rulePath = rule.Path
+	}
+	return keyword.CacheRequestsByRuleTotalMetricName + `{rule="` + rulePath + `",outcome="` + outcome + `"}`
+}
+
 // runLogger periodically logs the number of successful and failed refreshItem attempts.
 // This runs only if debugging is enabled in the config.
 func (r *Refresh) runLogger() {
@@ -111,7 +228,8 @@ func (r *Refresh) runLogger() {
 
 	go func() {
 		erroredNumPer5Sec := 0
-		refreshesNumPer5Sec := 0
+		revalidatedNumPer5Sec := 0
+		replacedNumPer5Sec := 0
 		ticker := utils.NewTicker(r.ctx, 5*time.Second)
 
 	loop:
@@ -119,21 +237,25 @@ func (r *Refresh) runLogger() {
 			select {
 			case <-r.ctx.Done():
 				return
-			case <-r.refreshSuccessNumCh:
-				refreshesNumPer5Sec++
+			case <-r.refreshRevalidatedNumCh:
+				revalidatedNumPer5Sec++
+				runtime.Gosched()
+			case <-r.refreshReplacedNumCh:
+				replacedNumPer5Sec++
 				runtime.Gosched()
 			case <-r.refreshErroredNumCh:
 				erroredNumPer5Sec++
 				runtime.Gosched()
 			case <-ticker:
-				if refreshesNumPer5Sec <= 0 && erroredNumPer5Sec <= 0 {
+				if revalidatedNumPer5Sec <= 0 && replacedNumPer5Sec <= 0 && erroredNumPer5Sec <= 0 {
 					runtime.Gosched()
 					continue loop
 				}
 
 				var (
-					errorsNum  = strconv.Itoa(erroredNumPer5Sec)
-					successNum = strconv.Itoa(refreshesNumPer5Sec)
+					errorsNum      = strconv.Itoa(erroredNumPer5Sec)
+					revalidatedNum = strconv.Itoa(revalidatedNumPer5Sec)
+					replacedNum    = strconv.Itoa(replacedNumPer5Sec)
 				)
 
 				logEvent := log.Info()
@@ -141,13 +263,15 @@ func (r *Refresh) runLogger() {
 				if r.cfg.IsProd() {
 					logEvent.
 						Str("target", "refresher").
-						Str("refreshes", successNum).
+						Str("revalidated", revalidatedNum).
+						Str("replaced", replacedNum).
 						Str("errors", errorsNum)
 				}
 
-				logEvent.Msgf("[refresher][5s] updated %s items, errors: %s", successNum, errorsNum)
+				logEvent.Msgf("[refresher][5s] revalidated: %s, replaced: %s, errors: %s", revalidatedNum, replacedNum, errorsNum)
 
-				refreshesNumPer5Sec = 0
+				revalidatedNumPer5Sec = 0
+				replacedNumPer5Sec = 0
 				erroredNumPer5Sec = 0
 				runtime.Gosched()
 			}
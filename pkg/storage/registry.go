@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2/pkg/config"
+	"github.com/caddyserver/caddy/v2/pkg/repository"
+)
+
+// Driver constructs a Storage backend named by Cache.Storage.Type (or a TierConfig.Type entry).
+// Each backend package (redis, memcached, pebble) registers its own Driver from an init(), so
+// adding a new backend never requires touching this package or
+// modules/advancedcache/setupper.go's dispatch -- only importing the new package for its
+// registration side effect. The in-process "malloc" backend is deliberately not registered here:
+// it needs the balancer/evictor/refresher/dumper wiring setupper.go gives it directly, which this
+// generic three-argument factory signature has no room for.
+type Driver func(ctx context.Context, cfg *config.Cache, backend repository.Backender) (Storage, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+)
+
+// RegisterDriver registers factory under name. Meant to be called from a backend package's
+// init(), the same way database/sql drivers register themselves; a duplicate name panics at
+// startup instead of silently shadowing, since that almost always means two versions of the same
+// package got linked in by accident.
+func RegisterDriver(name string, factory Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if _, exists := drivers[name]; exists {
+		panic("storage: driver already registered: " + name)
+	}
+	drivers[name] = factory
+}
+
+// NewStorage builds the Storage backend registered under name.
+func NewStorage(ctx context.Context, name string, cfg *config.Cache, backend repository.Backender) (Storage, error) {
+	driversMu.RLock()
+	factory, ok := drivers[name]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("storage: unknown driver %q", name)
+	}
+	return factory(ctx, cfg, backend)
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2/pkg/config"
+	"github.com/caddyserver/caddy/v2/pkg/model"
+	"github.com/caddyserver/caddy/v2/pkg/repository"
+)
+
+// EncodeResponse serializes resp into the same compact msgpack form Dump already writes to shard
+// files, so remote Storage backends (pkg/storage/redis, pkg/storage/memcached, pkg/storage/pebble)
+// share one wire format with on-disk dumps instead of each inventing its own.
+func EncodeResponse(resp *model.Response) ([]byte, error) {
+	e := dumpEntryPool.Get().(*dumpEntry)
+	defer func() {
+		*e = dumpEntry{}
+		dumpEntryPool.Put(e)
+	}()
+
+	*e = dumpEntry{
+		Unique:       fmt.Sprintf("%d-%d", resp.ShardKey(), resp.MapKey()),
+		StatusCode:   resp.Data().StatusCode(),
+		Headers:      resp.Data().Headers(),
+		Body:         resp.Data().Body(),
+		Query:        resp.Request().ToQuery(),
+		QueryHeaders: resp.Request().Headers(),
+		Path:         resp.Request().Path(),
+		MapKey:       resp.Request().MapKey(),
+		ShardKey:     resp.Request().ShardKey(),
+	}
+
+	return e.MarshalMsg(nil)
+}
+
+// DecodeResponse is EncodeResponse's inverse: it rebuilds a *model.Response (wired with cfg's rule
+// matching and backend's revalidators) from bytes an earlier EncodeResponse call produced.
+func DecodeResponse(cfg *config.Cache, backend repository.Backender, payload []byte) (*model.Response, error) {
+	e := dumpEntryPool.Get().(*dumpEntry)
+	defer func() {
+		*e = dumpEntry{}
+		dumpEntryPool.Put(e)
+	}()
+
+	if _, err := e.UnmarshalMsg(payload); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	req := model.NewRawRequest(cfg, e.MapKey, e.ShardKey, e.Query, e.Path, e.QueryHeaders)
+	data := model.NewData(req.Rule(), e.StatusCode, e.Headers, e.Body)
+	resp, err := model.NewResponse(data, req, cfg, backend.RevalidatorMaker(req), backend.ConditionalRevalidatorMaker(req))
+	if err != nil {
+		return nil, err
+	}
+	if resp.ShardKey() != e.ShardKey {
+		return nil, fmt.Errorf("invalid response shardKey: %d", resp.ShardKey())
+	}
+	if resp.MapKey() != e.MapKey {
+		return nil, fmt.Errorf("invalid response mapKey: %d", resp.MapKey())
+	}
+	return resp, nil
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"context"
+
 	"github.com/caddyserver/caddy/v2/pkg/model"
 )
 
@@ -10,10 +12,22 @@ type Storage interface {
 	// Run starts storage background worker (just logging at now).
 	Run()
 
+	// Ping reports whether this Storage is currently healthy. The in-process "malloc" backend is
+	// always healthy (nil); redis and memcached perform a real network round-trip, pebble a point
+	// lookup against its on-disk database.
+	// pkg/storage/tiered uses repeated Ping failures to drive its per-tier circuit breaker.
+	Ping(ctx context.Context) error
+
 	// Get attempts to retrieve a cached response for the given request.
 	// Returns the response, a releaser for safe concurrent access, and a hit/miss flag.
 	Get(req *model.Request) (resp *model.Response, isHit bool)
 
+	// GetOrLoad is Get plus singleflight coalescing: concurrent misses on the same req.MapKey()
+	// share a single loader call, whose successful result is Set exactly once. shared reports
+	// whether resp came from an existing entry or a shared/in-flight loader call, as opposed to
+	// this call's own loader invocation.
+	GetOrLoad(req *model.Request, loader func() (*model.Response, error)) (resp *model.Response, shared bool, err error)
+
 	// GetRandom attempts to retrieve any one cached response.
 	GetRandom() (resp *model.Response, isFound bool)
 
@@ -32,3 +46,14 @@ type Storage interface {
 	// RealMem - calculates and return value.
 	RealMem() int64
 }
+
+// KeyRemover is an optional capability a Storage can implement to remove an entry it has never
+// been handed back as a *model.Response — e.g. pkg/storage/invalidation applying a peer's purge,
+// which only carries the key hash over the wire. Implemented by every concrete backend (malloc,
+// redis, memcached, pebble). The observability, tiered and invalidation decorators always implement
+// it, forwarding to their wrapped Storage where that supports it and reporting a miss otherwise;
+// the namespace decorator doesn't implement it at all. Callers should type-assert for KeyRemover
+// rather than assume every Storage has it.
+type KeyRemover interface {
+	RemoveByKey(mapKey uint64) (freedBytes int64, isHit bool)
+}
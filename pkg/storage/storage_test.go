@@ -87,8 +87,8 @@ func BenchmarkReadFromStorage1000TimesPerIter(b *testing.B) {
 
 	shardedMap := sharded.NewMap[*model.Response](ctx, cfg.Cache.Preallocate.PerShard)
 	balancer := lru.NewBalancer(ctx, shardedMap)
-	backend := repository.NewBackend(cfg)
-	tinyLFU := lfu.NewTinyLFU(ctx)
+	backend := repository.NewBackend(ctx, cfg)
+	tinyLFU := lfu.NewTinyLFU(ctx, 0)
 	db := lru.NewStorage(ctx, cfg, balancer, backend, tinyLFU, shardedMap)
 
 	responses := mock.GenerateRandomResponses(cfg, path, b.N+1)
@@ -118,8 +118,8 @@ func BenchmarkWriteIntoStorage1000TimesPerIter(b *testing.B) {
 
 	shardedMap := sharded.NewMap[*model.Response](ctx, cfg.Cache.Preallocate.PerShard)
 	balancer := lru.NewBalancer(ctx, shardedMap)
-	backend := repository.NewBackend(cfg)
-	tinyLFU := lfu.NewTinyLFU(ctx)
+	backend := repository.NewBackend(ctx, cfg)
+	tinyLFU := lfu.NewTinyLFU(ctx, 0)
 	db := lru.NewStorage(ctx, cfg, balancer, backend, tinyLFU, shardedMap)
 
 	responses := mock.GenerateRandomResponses(cfg, path, b.N+1)
@@ -140,14 +140,62 @@ func BenchmarkWriteIntoStorage1000TimesPerIter(b *testing.B) {
 	reportMemAndAdvancedCache(b, shardedMap.Mem())
 }
 
+// BenchmarkMostLoadedSampledUnderWrites measures the O(log N) skip-list-backed
+// Balancer.MostLoadedSampled lookup (see pkg/skiplist and pkg/storage/lru.Balance) while writers are
+// concurrently mutating shard weights via db.Set, i.e. the victim-selection query Evict runs against
+// a live, continuously-reordered population instead of the old O(n) Sort + offset-walk.
+func BenchmarkMostLoadedSampledUnderWrites(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	shardedMap := sharded.NewMap[*model.Response](ctx, cfg.Cache.Preallocate.PerShard)
+	balancer := lru.NewBalancer(ctx, shardedMap)
+	backend := repository.NewBackend(ctx, cfg)
+	tinyLFU := lfu.NewTinyLFU(ctx, 0)
+	db := lru.NewStorage(ctx, cfg, balancer, backend, tinyLFU, shardedMap)
+
+	responses := mock.GenerateRandomResponses(cfg, path, b.N+1)
+	length := len(responses)
+	for _, resp := range responses {
+		db.Set(resp)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		i := 0
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				db.Set(responses[i%length])
+				i++
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			balancer.MostLoadedSampled(i % sharded.NumOfShards)
+			i++
+		}
+	})
+	b.StopTimer()
+
+	reportMemAndAdvancedCache(b, shardedMap.Mem())
+}
+
 func BenchmarkGetAllocs(b *testing.B) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	shardedMap := sharded.NewMap[*model.Response](ctx, cfg.Cache.Preallocate.PerShard)
 	balancer := lru.NewBalancer(ctx, shardedMap)
-	backend := repository.NewBackend(cfg)
-	tinyLFU := lfu.NewTinyLFU(ctx)
+	backend := repository.NewBackend(ctx, cfg)
+	tinyLFU := lfu.NewTinyLFU(ctx, 0)
 	db := lru.NewStorage(ctx, cfg, balancer, backend, tinyLFU, shardedMap)
 
 	resp := mock.GenerateRandomResponses(cfg, path, 1)[0]
@@ -168,8 +216,8 @@ func BenchmarkSetAllocs(b *testing.B) {
 
 	shardedMap := sharded.NewMap[*model.Response](ctx, cfg.Cache.Preallocate.PerShard)
 	balancer := lru.NewBalancer(ctx, shardedMap)
-	backend := repository.NewBackend(cfg)
-	tinyLFU := lfu.NewTinyLFU(ctx)
+	backend := repository.NewBackend(ctx, cfg)
+	tinyLFU := lfu.NewTinyLFU(ctx, 0)
 	db := lru.NewStorage(ctx, cfg, balancer, backend, tinyLFU, shardedMap)
 
 	resp := mock.GenerateRandomResponses(cfg, path, 1)[0]
@@ -0,0 +1,68 @@
+// Package tagindex maintains a tag -> cache-key reverse index for tag-based purges (see
+// pkg/storage/lru.Storage.RemoveByPattern and modules/advancedcache.PurgeHandler). It is
+// deliberately independent of the sharded.Map the actual cache entries live in: a purge needs to go
+// FROM a tag TO every key carrying it, the opposite direction sharded.Map is optimized for.
+package tagindex
+
+import "sync"
+
+// Index is a concurrent-safe tag -> set-of-key-hashes reverse index.
+type Index struct {
+	mu   sync.RWMutex
+	tags map[string]map[uint64]struct{}
+}
+
+// New returns an empty Index.
+func New() *Index {
+	return &Index{tags: make(map[string]map[uint64]struct{})}
+}
+
+// Add records that key carries every tag in tags. A no-op if tags is empty, so callers can pass
+// model.Data.Tags() unconditionally without a len check of their own.
+func (idx *Index) Add(key uint64, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, tag := range tags {
+		keys := idx.tags[tag]
+		if keys == nil {
+			keys = make(map[uint64]struct{}, 1)
+			idx.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// Remove forgets key under every tag in tags, pruning any tag left with no keys behind it.
+func (idx *Index) Remove(key uint64, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, tag := range tags {
+		keys := idx.tags[tag]
+		if keys == nil {
+			continue
+		}
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(idx.tags, tag)
+		}
+	}
+}
+
+// Keys returns every key hash currently recorded under tag (a snapshot, safe to range over even as
+// the caller starts removing the keys it names).
+func (idx *Index) Keys(tag string) []uint64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	keys := idx.tags[tag]
+	out := make([]uint64, 0, len(keys))
+	for key := range keys {
+		out = append(out, key)
+	}
+	return out
+}
@@ -0,0 +1,383 @@
+// Package tiered composes an ordered chain of storage.Storage backends (typically a fast in-process
+// L1 in front of one or more slower, shared/persistent tiers) behind the single storage.Storage
+// interface, so CacheMiddleware doesn't need to branch on which tier actually served or stored an
+// entry.
+package tiered
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/caddyserver/caddy/v2/pkg/config"
+	"github.com/caddyserver/caddy/v2/pkg/model"
+	"github.com/caddyserver/caddy/v2/pkg/prometheus/metrics/keyword"
+	"github.com/caddyserver/caddy/v2/pkg/singleflight"
+	"github.com/caddyserver/caddy/v2/pkg/storage"
+	"github.com/caddyserver/caddy/v2/pkg/storage/invalidation"
+	"github.com/caddyserver/caddy/v2/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// TierOption configures one level of the chain NewStorage builds, in the same order as the
+// corresponding storage.Storage in the stores slice.
+type TierOption struct {
+	// Label identifies this tier in logs/metrics (e.g. "l1-malloc", "l2-redis").
+	Label string
+	// Async writes this tier in the background instead of blocking Set/Remove on it.
+	Async bool
+	// Breaker governs when this tier is temporarily skipped after repeated Ping failures; the zero
+	// value disables circuit breaking (the tier is always probed).
+	Breaker config.CircuitBreaker
+}
+
+type tier struct {
+	label   string
+	store   storage.Storage
+	async   bool
+	breaker *circuitBreaker
+}
+
+// Storage probes tiers in order on Get (promoting a hit found below the top tier back into every
+// hotter tier), write-throughs Set/Remove to every tier, and skips a tier whose circuit breaker is
+// open in favor of the next one.
+type Storage struct {
+	ctx      context.Context
+	cfg      *config.Cache
+	tiers    []*tier
+	inflight *singleflight.Group[*model.Response]
+}
+
+// NewStorage composes stores (ordered hottest-first) into a single storage.Storage. opts[i]
+// configures stores[i]; a short opts slice leaves trailing tiers at their zero-value TierOption
+// (synchronous writes, no circuit breaker).
+func NewStorage(ctx context.Context, cfg *config.Cache, stores []storage.Storage, opts []TierOption) *Storage {
+	tiers := make([]*tier, len(stores))
+	for i, s := range stores {
+		var opt TierOption
+		if i < len(opts) {
+			opt = opts[i]
+		}
+		if opt.Label == "" {
+			opt.Label = fmt.Sprintf("tier-%d", i)
+		}
+		tiers[i] = &tier{
+			label:   opt.Label,
+			store:   s,
+			async:   opt.Async,
+			breaker: newCircuitBreaker(opt.Breaker),
+		}
+	}
+	return &Storage{
+		ctx:      ctx,
+		cfg:      cfg,
+		tiers:    tiers,
+		inflight: singleflight.New[*model.Response](),
+	}
+}
+
+var _ storage.Storage = (*Storage)(nil)
+
+// Run launches the health-check loop that feeds every tier's circuit breaker, plus (if stats
+// logging is enabled) periodic per-tier stat reporting.
+func (s *Storage) Run() {
+	go s.runHealthChecks()
+	if s.cfg.Cache.Logs.Stats {
+		go s.runLogger()
+	}
+}
+
+func (s *Storage) runHealthChecks() {
+	ticker := utils.NewTicker(s.ctx, time.Second)
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker:
+			for _, t := range s.tiers {
+				t.breaker.record(t.store.Ping(s.ctx))
+			}
+		}
+	}
+}
+
+func (s *Storage) runLogger() {
+	ticker := utils.NewTicker(s.ctx, 5*time.Second)
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker:
+			for _, t := range s.tiers {
+				bytes, length := t.store.Stat()
+				metrics.GetOrCreateCounter(tierMetricName(keyword.CacheTierBytesMetricName, t.label)).Set(uint64(bytes))
+				metrics.GetOrCreateCounter(tierMetricName(keyword.CacheTierLenMetricName, t.label)).Set(uint64(length))
+
+				logEvent := log.Info()
+				if s.cfg.IsProd() {
+					logEvent.Str("tier", t.label).Bool("open", !t.breaker.allow())
+				}
+				logEvent.Msgf("[storage/tiered][5s] tier=%s bytes=%s len=%d open=%t", t.label, utils.FmtMem(bytes), length, !t.breaker.allow())
+			}
+		}
+	}
+}
+
+func tierMetricName(metricName, tierLabel string) string {
+	buf := make([]byte, 0, 48)
+	buf = append(buf, metricName...)
+	buf = append(buf, `{tier="`...)
+	buf = append(buf, tierLabel...)
+	buf = append(buf, `"}`...)
+	return string(buf)
+}
+
+// Ping reports the top tier's health: it's what actually serves the hot path, and an operator
+// probing overall liveness cares most about that.
+func (s *Storage) Ping(ctx context.Context) error {
+	if len(s.tiers) == 0 {
+		return nil
+	}
+	return s.tiers[0].store.Ping(ctx)
+}
+
+// Get probes tiers in order and, on a hit below the top tier, promotes the entry back into every
+// hotter tier it wasn't found in ("promote on read") so the next Get for this key is served by L1.
+func (s *Storage) Get(req *model.Request) (resp *model.Response, isHit bool) {
+	for i, t := range s.tiers {
+		if !t.breaker.allow() {
+			continue
+		}
+		found, ok := t.store.Get(req)
+		if !ok {
+			continue
+		}
+		s.promote(found, i)
+		return found, true
+	}
+	return nil, false
+}
+
+// promote write-throughs found into every tier above foundAt (the tier it was actually served
+// from), synchronously: a promotion is small, already-encoded work compared to the loader it's
+// saving future requests from repeating, so it isn't worth the bookkeeping of tracking per-tier
+// Async for this path separately.
+func (s *Storage) promote(found *model.Response, foundAt int) {
+	for i := 0; i < foundAt; i++ {
+		if !s.tiers[i].breaker.allow() {
+			continue
+		}
+		s.tiers[i].store.Set(found)
+	}
+}
+
+// GetOrLoad coalesces concurrent misses (across every tier) on the same req.MapKey() within this
+// instance; the loader's result is written through every tier via Set, same as a direct Set call.
+func (s *Storage) GetOrLoad(req *model.Request, loader func() (*model.Response, error)) (resp *model.Response, shared bool, err error) {
+	if resp, isHit := s.Get(req); isHit {
+		return resp, true, nil
+	}
+
+	resp, err, shared = s.inflight.Do(req.MapKey(), func() (*model.Response, error) {
+		loaded, loadErr := loader()
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		if loaded != nil {
+			s.Set(loaded)
+		}
+		return loaded, nil
+	})
+	return resp, shared, err
+}
+
+// GetRandom returns the first result found probing tiers in order; it does not merge samples
+// across tiers.
+func (s *Storage) GetRandom() (resp *model.Response, isFound bool) {
+	for _, t := range s.tiers {
+		if !t.breaker.allow() {
+			continue
+		}
+		if found, ok := t.store.GetRandom(); ok {
+			return found, true
+		}
+	}
+	return nil, false
+}
+
+// Set write-throughs resp to every tier whose breaker currently allows it, synchronously unless
+// that tier's TierOption.Async requested otherwise.
+func (s *Storage) Set(resp *model.Response) {
+	for _, t := range s.tiers {
+		if !t.breaker.allow() {
+			continue
+		}
+		if t.async {
+			go t.store.Set(resp)
+			continue
+		}
+		t.store.Set(resp)
+	}
+}
+
+// Remove deletes resp from every tier, returning the largest freedBytes reported (tiers rarely
+// agree exactly on Weight once variant/compression state diverges between them) and whether any
+// tier actually had it.
+func (s *Storage) Remove(resp *model.Response) (freedBytes int64, isHit bool) {
+	for _, t := range s.tiers {
+		if !t.breaker.allow() {
+			continue
+		}
+		if freed, ok := t.store.Remove(resp); ok {
+			isHit = true
+			if freed > freedBytes {
+				freedBytes = freed
+			}
+		}
+	}
+	return freedBytes, isHit
+}
+
+// RemoveByKey deletes mapKey from every tier that implements storage.KeyRemover (a tier backed by
+// a remote/on-disk store missing it is simply skipped, not treated as an error).
+func (s *Storage) RemoveByKey(mapKey uint64) (freedBytes int64, isHit bool) {
+	for _, t := range s.tiers {
+		if !t.breaker.allow() {
+			continue
+		}
+		kr, ok := t.store.(storage.KeyRemover)
+		if !ok {
+			continue
+		}
+		if freed, ok := kr.RemoveByKey(mapKey); ok {
+			isHit = true
+			if freed > freedBytes {
+				freedBytes = freed
+			}
+		}
+	}
+	return freedBytes, isHit
+}
+
+// RemoveByPattern purges pattern from every tier that implements invalidation.PatternRemover,
+// summing freed bytes/removed counts across tiers (unlike RemoveByKey, which reports the largest
+// freedBytes of any one tier), so an entry held in two tiers is counted twice.
+func (s *Storage) RemoveByPattern(pattern string) (freedBytes int64, removed int) {
+	for _, t := range s.tiers {
+		if !t.breaker.allow() {
+			continue
+		}
+		pr, ok := t.store.(invalidation.PatternRemover)
+		if !ok {
+			continue
+		}
+		freed, n := pr.RemoveByPattern(pattern)
+		freedBytes += freed
+		removed += n
+	}
+	return freedBytes, removed
+}
+
+// Stat sums bytes/length across every tier; see TierStats for a per-tier breakdown.
+func (s *Storage) Stat() (bytes int64, length int64) {
+	for _, t := range s.tiers {
+		b, l := t.store.Stat()
+		bytes += b
+		length += l
+	}
+	return bytes, length
+}
+
+// Mem sums every tier's Mem().
+func (s *Storage) Mem() int64 {
+	var total int64
+	for _, t := range s.tiers {
+		total += t.store.Mem()
+	}
+	return total
+}
+
+// RealMem sums every tier's RealMem().
+func (s *Storage) RealMem() int64 {
+	var total int64
+	for _, t := range s.tiers {
+		total += t.store.RealMem()
+	}
+	return total
+}
+
+// TierStat is one tier's point-in-time stats, labeled for an operator comparing tiers.
+type TierStat struct {
+	Label  string
+	Bytes  int64
+	Length int64
+	Open   bool // true if this tier's circuit breaker currently short-circuits calls to it
+}
+
+// TierStats returns a per-tier breakdown, in the same hottest-first order tiers were configured.
+func (s *Storage) TierStats() []TierStat {
+	stats := make([]TierStat, len(s.tiers))
+	for i, t := range s.tiers {
+		bytes, length := t.store.Stat()
+		stats[i] = TierStat{Label: t.label, Bytes: bytes, Length: length, Open: !t.breaker.allow()}
+	}
+	return stats
+}
+
+// minBreakerSamples is the fewest Ping results recorded within one Window before a breaker will
+// consider opening; without it, a single failed Ping right after startup could open the breaker on
+// a 100% (1-of-1) failure rate.
+const minBreakerSamples = 5
+
+// circuitBreaker opens (causing allow to return false) once the fraction of failed Ping calls
+// within the rolling Window reaches FailureThreshold, and stays open for Cooldown before allowing
+// calls through again. A zero-value config (FailureThreshold <= 0) disables it: allow always
+// returns true.
+type circuitBreaker struct {
+	cfg config.CircuitBreaker
+
+	mu          sync.Mutex
+	windowStart time.Time
+	attempts    int
+	failures    int
+	openUntil   time.Time
+}
+
+func newCircuitBreaker(cfg config.CircuitBreaker) *circuitBreaker {
+	return &circuitBreaker{cfg: cfg, windowStart: time.Now()}
+}
+
+func (b *circuitBreaker) allow() bool {
+	if b.cfg.FailureThreshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Now().After(b.openUntil)
+}
+
+func (b *circuitBreaker) record(err error) {
+	if b.cfg.FailureThreshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.cfg.Window > 0 && now.Sub(b.windowStart) > b.cfg.Window {
+		b.windowStart = now
+		b.attempts = 0
+		b.failures = 0
+	}
+
+	b.attempts++
+	if err != nil {
+		b.failures++
+	}
+
+	if b.attempts >= minBreakerSamples && float64(b.failures)/float64(b.attempts) >= b.cfg.FailureThreshold {
+		b.openUntil = now.Add(b.cfg.Cooldown)
+	}
+}
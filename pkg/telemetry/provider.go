@@ -0,0 +1,76 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/pkg/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// instrumentationServiceName identifies this process in whatever backend Configure exports spans
+// to (Jaeger, Tempo, etc.), distinguishing it from other services sharing the same collector.
+const instrumentationServiceName = "advancedcache"
+
+// otlpDialTimeout bounds how long Configure waits for the initial gRPC connection to
+// Observability.OTLPEndpoint before giving up, so a misconfigured or unreachable collector delays
+// startup by seconds, not indefinitely.
+const otlpDialTimeout = 5 * time.Second
+
+// Configure installs a real OTLP/gRPC-exporting TracerProvider as the OpenTelemetry global
+// provider when obs.OTLPEndpoint is set, so every existing telemetry.New(enabled, name) call site
+// across this module starts producing spans an external collector actually receives, without
+// those call sites changing at all. obs.OTLPEndpoint == "" makes Configure a no-op: the global
+// provider (and therefore every enabled Tracer) is left on the SDK's default no-op implementation.
+//
+// The returned shutdown func flushes any buffered spans and closes the exporter; callers should
+// defer it (or call it from their own shutdown path) so a process restart doesn't drop in-flight
+// spans. It's always safe to call, even when Configure was a no-op.
+func Configure(ctx context.Context, obs config.Observability) (shutdown func(context.Context) error, err error) {
+	noop := func(context.Context) error { return nil }
+
+	if obs.OTLPEndpoint == "" {
+		return noop, nil
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, otlpDialTimeout)
+	defer cancel()
+
+	exporter, err := otlptracegrpc.New(dialCtx,
+		otlptracegrpc.WithEndpoint(obs.OTLPEndpoint),
+		otlptracegrpc.WithInsecure(),
+	)
+	if err != nil {
+		return noop, err
+	}
+
+	res, err := resource.New(ctx, resource.WithAttributes(
+		semconv.ServiceName(instrumentationServiceName),
+	))
+	if err != nil {
+		return noop, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRate(obs.SampleRate)))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// sampleRate defaults an unset/invalid Observability.SampleRate to 1 (sample everything): an
+// operator turning tracing on at all almost always wants full visibility until they've found a
+// concrete reason to sample down.
+func sampleRate(rate float64) float64 {
+	if rate <= 0 || rate > 1 {
+		return 1
+	}
+	return rate
+}
@@ -0,0 +1,45 @@
+// Package telemetry wires OpenTelemetry tracing through the cache's hot paths (storage
+// gets/sets/evictions, background refresh, cache-key construction) behind a config toggle, with a
+// zero-cost no-op Tracer when tracing is disabled so the hot path pays nothing for it.
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer starts spans for the cache's hot paths.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span)
+}
+
+// noopTracer returns ctx unchanged together with a non-recording no-op span, without touching the
+// OpenTelemetry SDK at all. A span already attached to ctx is never handed back, so the caller's
+// span.End can't end a span some other component started.
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...attribute.KeyValue) (context.Context, trace.Span) {
+	return ctx, trace.SpanFromContext(context.Background())
+}
+
+// otelTracer delegates to a real tracer obtained from the global TracerProvider.
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+func (t *otelTracer) Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// New returns an otelTracer reading from the global TracerProvider when enabled, or a noopTracer
+// otherwise. instrumentationName identifies the caller (e.g. "lru.Storage", "storage.Refresh") in
+// emitted spans.
+func New(enabled bool, instrumentationName string) Tracer {
+	if !enabled {
+		return noopTracer{}
+	}
+	return &otelTracer{tracer: otel.Tracer(instrumentationName)}
+}